@@ -0,0 +1,9 @@
+// Package api holds the definitions of the APIs served by quibbble
+package api
+
+import _ "embed"
+
+// OpenAPI is the OpenAPI specification of the REST API
+//
+//go:embed openapi.json
+var OpenAPI []byte
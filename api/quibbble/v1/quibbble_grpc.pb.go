@@ -0,0 +1,412 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v4.25.3
+// source: quibbble/v1/quibbble.proto
+
+package quibbblev1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Quibbble_CreateGame_FullMethodName  = "/quibbble.v1.Quibbble/CreateGame"
+	Quibbble_LoadGame_FullMethodName    = "/quibbble.v1.Quibbble/LoadGame"
+	Quibbble_GetSnapshot_FullMethodName = "/quibbble.v1.Quibbble/GetSnapshot"
+	Quibbble_GetBGN_FullMethodName      = "/quibbble.v1.Quibbble/GetBGN"
+	Quibbble_GetStats_FullMethodName    = "/quibbble.v1.Quibbble/GetStats"
+	Quibbble_GetInfo_FullMethodName     = "/quibbble.v1.Quibbble/GetInfo"
+	Quibbble_ListGames_FullMethodName   = "/quibbble.v1.Quibbble/ListGames"
+	Quibbble_WatchGame_FullMethodName   = "/quibbble.v1.Quibbble/WatchGame"
+)
+
+// QuibbbleClient is the client API for Quibbble service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type QuibbbleClient interface {
+	// CreateGame creates a new game with a generated game ID if none is set
+	CreateGame(ctx context.Context, in *CreateGameRequest, opts ...grpc.CallOption) (*CreateGameResponse, error)
+	// LoadGame creates a game from BGN with a generated game ID if none is set
+	LoadGame(ctx context.Context, in *LoadGameRequest, opts ...grpc.CallOption) (*LoadGameResponse, error)
+	// GetSnapshot returns the current state of a game, as seen by a team if set
+	GetSnapshot(ctx context.Context, in *GetSnapshotRequest, opts ...grpc.CallOption) (*GetSnapshotResponse, error)
+	// GetBGN returns the BGN of a game
+	GetBGN(ctx context.Context, in *GetBGNRequest, opts ...grpc.CallOption) (*GetBGNResponse, error)
+	// GetStats returns stats of stored and running games by game key
+	GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*GetStatsResponse, error)
+	// GetInfo returns information about a game key
+	GetInfo(ctx context.Context, in *GetInfoRequest, opts ...grpc.CallOption) (*GetInfoResponse, error)
+	// ListGames returns a summary of every running game
+	ListGames(ctx context.Context, in *ListGamesRequest, opts ...grpc.CallOption) (*ListGamesResponse, error)
+	// WatchGame streams every message sent to players of a game, as seen by a team if set, until the game closes
+	WatchGame(ctx context.Context, in *WatchGameRequest, opts ...grpc.CallOption) (Quibbble_WatchGameClient, error)
+}
+
+type quibbbleClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewQuibbbleClient(cc grpc.ClientConnInterface) QuibbbleClient {
+	return &quibbbleClient{cc}
+}
+
+func (c *quibbbleClient) CreateGame(ctx context.Context, in *CreateGameRequest, opts ...grpc.CallOption) (*CreateGameResponse, error) {
+	out := new(CreateGameResponse)
+	err := c.cc.Invoke(ctx, Quibbble_CreateGame_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *quibbbleClient) LoadGame(ctx context.Context, in *LoadGameRequest, opts ...grpc.CallOption) (*LoadGameResponse, error) {
+	out := new(LoadGameResponse)
+	err := c.cc.Invoke(ctx, Quibbble_LoadGame_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *quibbbleClient) GetSnapshot(ctx context.Context, in *GetSnapshotRequest, opts ...grpc.CallOption) (*GetSnapshotResponse, error) {
+	out := new(GetSnapshotResponse)
+	err := c.cc.Invoke(ctx, Quibbble_GetSnapshot_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *quibbbleClient) GetBGN(ctx context.Context, in *GetBGNRequest, opts ...grpc.CallOption) (*GetBGNResponse, error) {
+	out := new(GetBGNResponse)
+	err := c.cc.Invoke(ctx, Quibbble_GetBGN_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *quibbbleClient) GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*GetStatsResponse, error) {
+	out := new(GetStatsResponse)
+	err := c.cc.Invoke(ctx, Quibbble_GetStats_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *quibbbleClient) GetInfo(ctx context.Context, in *GetInfoRequest, opts ...grpc.CallOption) (*GetInfoResponse, error) {
+	out := new(GetInfoResponse)
+	err := c.cc.Invoke(ctx, Quibbble_GetInfo_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *quibbbleClient) ListGames(ctx context.Context, in *ListGamesRequest, opts ...grpc.CallOption) (*ListGamesResponse, error) {
+	out := new(ListGamesResponse)
+	err := c.cc.Invoke(ctx, Quibbble_ListGames_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *quibbbleClient) WatchGame(ctx context.Context, in *WatchGameRequest, opts ...grpc.CallOption) (Quibbble_WatchGameClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Quibbble_ServiceDesc.Streams[0], Quibbble_WatchGame_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &quibbbleWatchGameClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Quibbble_WatchGameClient interface {
+	Recv() (*GameEvent, error)
+	grpc.ClientStream
+}
+
+type quibbbleWatchGameClient struct {
+	grpc.ClientStream
+}
+
+func (x *quibbbleWatchGameClient) Recv() (*GameEvent, error) {
+	m := new(GameEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// QuibbbleServer is the server API for Quibbble service.
+// All implementations must embed UnimplementedQuibbbleServer
+// for forward compatibility
+type QuibbbleServer interface {
+	// CreateGame creates a new game with a generated game ID if none is set
+	CreateGame(context.Context, *CreateGameRequest) (*CreateGameResponse, error)
+	// LoadGame creates a game from BGN with a generated game ID if none is set
+	LoadGame(context.Context, *LoadGameRequest) (*LoadGameResponse, error)
+	// GetSnapshot returns the current state of a game, as seen by a team if set
+	GetSnapshot(context.Context, *GetSnapshotRequest) (*GetSnapshotResponse, error)
+	// GetBGN returns the BGN of a game
+	GetBGN(context.Context, *GetBGNRequest) (*GetBGNResponse, error)
+	// GetStats returns stats of stored and running games by game key
+	GetStats(context.Context, *GetStatsRequest) (*GetStatsResponse, error)
+	// GetInfo returns information about a game key
+	GetInfo(context.Context, *GetInfoRequest) (*GetInfoResponse, error)
+	// ListGames returns a summary of every running game
+	ListGames(context.Context, *ListGamesRequest) (*ListGamesResponse, error)
+	// WatchGame streams every message sent to players of a game, as seen by a team if set, until the game closes
+	WatchGame(*WatchGameRequest, Quibbble_WatchGameServer) error
+	mustEmbedUnimplementedQuibbbleServer()
+}
+
+// UnimplementedQuibbbleServer must be embedded to have forward compatible implementations.
+type UnimplementedQuibbbleServer struct {
+}
+
+func (UnimplementedQuibbbleServer) CreateGame(context.Context, *CreateGameRequest) (*CreateGameResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateGame not implemented")
+}
+func (UnimplementedQuibbbleServer) LoadGame(context.Context, *LoadGameRequest) (*LoadGameResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LoadGame not implemented")
+}
+func (UnimplementedQuibbbleServer) GetSnapshot(context.Context, *GetSnapshotRequest) (*GetSnapshotResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSnapshot not implemented")
+}
+func (UnimplementedQuibbbleServer) GetBGN(context.Context, *GetBGNRequest) (*GetBGNResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBGN not implemented")
+}
+func (UnimplementedQuibbbleServer) GetStats(context.Context, *GetStatsRequest) (*GetStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStats not implemented")
+}
+func (UnimplementedQuibbbleServer) GetInfo(context.Context, *GetInfoRequest) (*GetInfoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetInfo not implemented")
+}
+func (UnimplementedQuibbbleServer) ListGames(context.Context, *ListGamesRequest) (*ListGamesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListGames not implemented")
+}
+func (UnimplementedQuibbbleServer) WatchGame(*WatchGameRequest, Quibbble_WatchGameServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchGame not implemented")
+}
+func (UnimplementedQuibbbleServer) mustEmbedUnimplementedQuibbbleServer() {}
+
+// UnsafeQuibbbleServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to QuibbbleServer will
+// result in compilation errors.
+type UnsafeQuibbbleServer interface {
+	mustEmbedUnimplementedQuibbbleServer()
+}
+
+func RegisterQuibbbleServer(s grpc.ServiceRegistrar, srv QuibbbleServer) {
+	s.RegisterService(&Quibbble_ServiceDesc, srv)
+}
+
+func _Quibbble_CreateGame_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateGameRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QuibbbleServer).CreateGame(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Quibbble_CreateGame_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QuibbbleServer).CreateGame(ctx, req.(*CreateGameRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Quibbble_LoadGame_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LoadGameRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QuibbbleServer).LoadGame(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Quibbble_LoadGame_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QuibbbleServer).LoadGame(ctx, req.(*LoadGameRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Quibbble_GetSnapshot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSnapshotRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QuibbbleServer).GetSnapshot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Quibbble_GetSnapshot_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QuibbbleServer).GetSnapshot(ctx, req.(*GetSnapshotRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Quibbble_GetBGN_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBGNRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QuibbbleServer).GetBGN(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Quibbble_GetBGN_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QuibbbleServer).GetBGN(ctx, req.(*GetBGNRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Quibbble_GetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QuibbbleServer).GetStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Quibbble_GetStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QuibbbleServer).GetStats(ctx, req.(*GetStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Quibbble_GetInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetInfoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QuibbbleServer).GetInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Quibbble_GetInfo_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QuibbbleServer).GetInfo(ctx, req.(*GetInfoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Quibbble_ListGames_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListGamesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QuibbbleServer).ListGames(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Quibbble_ListGames_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QuibbbleServer).ListGames(ctx, req.(*ListGamesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Quibbble_WatchGame_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchGameRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(QuibbbleServer).WatchGame(m, &quibbbleWatchGameServer{stream})
+}
+
+type Quibbble_WatchGameServer interface {
+	Send(*GameEvent) error
+	grpc.ServerStream
+}
+
+type quibbbleWatchGameServer struct {
+	grpc.ServerStream
+}
+
+func (x *quibbbleWatchGameServer) Send(m *GameEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Quibbble_ServiceDesc is the grpc.ServiceDesc for Quibbble service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Quibbble_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "quibbble.v1.Quibbble",
+	HandlerType: (*QuibbbleServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateGame",
+			Handler:    _Quibbble_CreateGame_Handler,
+		},
+		{
+			MethodName: "LoadGame",
+			Handler:    _Quibbble_LoadGame_Handler,
+		},
+		{
+			MethodName: "GetSnapshot",
+			Handler:    _Quibbble_GetSnapshot_Handler,
+		},
+		{
+			MethodName: "GetBGN",
+			Handler:    _Quibbble_GetBGN_Handler,
+		},
+		{
+			MethodName: "GetStats",
+			Handler:    _Quibbble_GetStats_Handler,
+		},
+		{
+			MethodName: "GetInfo",
+			Handler:    _Quibbble_GetInfo_Handler,
+		},
+		{
+			MethodName: "ListGames",
+			Handler:    _Quibbble_ListGames_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchGame",
+			Handler:       _Quibbble_WatchGame_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "quibbble/v1/quibbble.proto",
+}
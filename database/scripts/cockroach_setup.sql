@@ -12,6 +12,34 @@ CREATE TABLE IF NOT EXISTS quibbble.games (
     CONSTRAINT id PRIMARY KEY (game_key, game_id)
 );
 
+-- add the searchable summary columns to the games table
+ALTER TABLE quibbble.games ADD COLUMN IF NOT EXISTS action_count INT;
+ALTER TABLE quibbble.games ADD COLUMN IF NOT EXISTS winners STRING[];
+ALTER TABLE quibbble.games ADD COLUMN IF NOT EXISTS participants JSONB;
+CREATE INDEX IF NOT EXISTS games_updated_at ON quibbble.games (updated_at DESC, game_key, game_id);
+CREATE INVERTED INDEX IF NOT EXISTS games_participants ON quibbble.games (participants);
+
+-- add the encoded bgn columns where the first byte of bgn_data gives its format (0 raw, 1 gzip)
+-- legacy rows keep their text bgn until re-encoded in the background by the service
+ALTER TABLE quibbble.games ADD COLUMN IF NOT EXISTS bgn_data BYTES;
+ALTER TABLE quibbble.games ADD COLUMN IF NOT EXISTS bgn_size INT;
+ALTER TABLE quibbble.games ADD COLUMN IF NOT EXISTS bgn_hash BYTES;
+
+-- create the playthroughs table which archives completed plays of a game before it is reset
+CREATE TABLE IF NOT EXISTS quibbble.playthroughs (
+    game_key STRING NOT NULL,
+    game_id STRING NOT NULL,
+    play_index INT NOT NULL,
+    bgn STRING,
+    winners STRING[],
+    participants JSONB,
+    completed_at TIMESTAMP,
+    CONSTRAINT playthrough_id PRIMARY KEY (game_key, game_id, play_index)
+);
+ALTER TABLE quibbble.playthroughs ADD COLUMN IF NOT EXISTS bgn_data BYTES;
+ALTER TABLE quibbble.playthroughs ADD COLUMN IF NOT EXISTS bgn_size INT;
+ALTER TABLE quibbble.playthroughs ADD COLUMN IF NOT EXISTS bgn_hash BYTES;
+
 -- get a game from the games table
 SELECT * FROM quibbble.games
 WHERE game_key=$1
@@ -20,3 +48,9 @@ AND game_id=$2
 -- insert a game into the games table
 INSERT INTO quibbble.games (game_key, game_id, bgn, created_at, updated_at, play_count)
 VALUES ($1, $2, $3, $4, $5, $6)
+
+-- get the playthroughs of a game from the playthroughs table
+SELECT * FROM quibbble.playthroughs
+WHERE game_key=$1
+AND game_id=$2
+ORDER BY play_index
@@ -0,0 +1,381 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quibbble/go-quibbble/pkg/logger"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// ForwardedHeader marks requests already forwarded by another node so they are always served locally
+	ForwardedHeader = "X-Quibbble-Forwarded-By"
+
+	// NodePath is where each node reports its NodeState to its peers
+	NodePath = "/cluster/node"
+
+	defaultHeartbeatInterval = 5 * time.Second
+	defaultMemberTTL         = 15 * time.Second
+	defaultVirtualNodes      = 64
+	defaultHandoffWait       = 10 * time.Second
+	handoffPollInterval      = 100 * time.Millisecond
+	probeTimeout             = 2 * time.Second
+)
+
+// NodeState is what a node reports to its peers
+type NodeState struct {
+	// Left is whether the node has left the cluster and no longer owns any games
+	Left bool
+
+	// HandedOff is the membership the node has finished handing off games for
+	HandedOff []string
+}
+
+// Cluster assigns each game to a single owning node and forwards requests for games owned by other nodes
+type Cluster struct {
+	addr              string
+	registry          Registry
+	heartbeatInterval time.Duration
+	memberTTL         time.Duration
+	virtualNodes      int
+	redirect          bool
+	handoffWait       time.Duration
+	client            *http.Client
+	redis             *redis.Client // shared with the other nodes for state that must be the same on every node, nil unless redis is configured
+	keyPrefix         string
+
+	mu          sync.RWMutex
+	ring        *ring
+	previous    *ring           // ring before the last membership change, nil until the first change
+	unconfirmed map[string]bool // previous owners yet to confirm they handed off games for the current membership
+	handedOff   []string        // membership this node has finished handing off games for, behind the ring while a handoff is retried
+	refreshed   bool            // whether the membership has been listed since starting
+	left        bool
+	proxies     map[string]*httputil.ReverseProxy // mapping from node address to proxy
+	onChange    []func() error
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewCluster(config *Config) (*Cluster, error) {
+	registry, err := newRegistry(config)
+	if err != nil {
+		return nil, err
+	}
+	return NewClusterWithRegistry(config, registry)
+}
+
+// NewClusterWithRegistry creates a cluster using the given registry instead of the configured one
+func NewClusterWithRegistry(config *Config, registry Registry) (*Cluster, error) {
+	if config.Addr == "" {
+		return nil, ErrNoAddr
+	}
+	heartbeatInterval := defaultHeartbeatInterval
+	if config.HeartbeatInterval > 0 {
+		heartbeatInterval = config.HeartbeatInterval
+	}
+	memberTTL := defaultMemberTTL
+	if config.MemberTTL > 0 {
+		memberTTL = config.MemberTTL
+	}
+	virtualNodes := defaultVirtualNodes
+	if config.VirtualNodes > 0 {
+		virtualNodes = config.VirtualNodes
+	}
+	handoffWait := defaultHandoffWait
+	if config.HandoffWait > 0 {
+		handoffWait = config.HandoffWait
+	}
+	var client *redis.Client
+	// the redis registry connects to the default address when none is set
+	if config.Registry == RegistryRedis || config.Redis.Addr != "" {
+		client = NewRedisClient(&config.Redis)
+	}
+	return &Cluster{
+		addr:              strings.TrimSuffix(config.Addr, "/"),
+		registry:          registry,
+		heartbeatInterval: heartbeatInterval,
+		memberTTL:         memberTTL,
+		virtualNodes:      virtualNodes,
+		redirect:          config.Redirect,
+		handoffWait:       handoffWait,
+		client:            &http.Client{Timeout: probeTimeout},
+		redis:             client,
+		keyPrefix:         config.Redis.KeyPrefix,
+		ring:              newRing([]string{strings.TrimSuffix(config.Addr, "/")}, virtualNodes),
+		unconfirmed:       make(map[string]bool),
+		proxies:           make(map[string]*httputil.ReverseProxy),
+		stop:              make(chan struct{}),
+		done:              make(chan struct{}),
+	}, nil
+}
+
+// Start registers this node and keeps its registration and view of the membership up to date until Leave is called
+func (c *Cluster) Start(ctx context.Context) error {
+	if err := c.registry.Register(ctx, c.addr, c.memberTTL); err != nil {
+		return err
+	}
+	c.refresh(ctx)
+	go c.heartbeat()
+	return nil
+}
+
+// OnChange adds a callback that is run whenever the membership changes
+// the node only confirms handing off games for the membership once every callback succeeds and retries them until they do
+func (c *Cluster) OnChange(fn func() error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onChange = append(c.onChange, fn)
+}
+
+// Addr returns the address of this node
+func (c *Cluster) Addr() string {
+	return c.addr
+}
+
+// Members returns the addresses of all nodes in this node's view of the cluster
+func (c *Cluster) Members() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ring.members
+}
+
+// Redis returns the client of the redis shared by every node and the prefix its keys must start with
+// nodes keep state in it that must not depend on which node serves a request such as idempotent responses
+// the client is nil unless the registry is redis or a redis address is configured
+func (c *Cluster) Redis() (*redis.Client, string) {
+	return c.redis, c.keyPrefix
+}
+
+// Owner returns the address of the node that owns the game
+func (c *Cluster) Owner(gameKey, gameID string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ring.owner(gameKey + "/" + gameID)
+}
+
+// IsOwner returns whether this node owns the game
+func (c *Cluster) IsOwner(gameKey, gameID string) bool {
+	return c.Owner(gameKey, gameID) == c.addr
+}
+
+// Await blocks until the node that owned the game before the last membership change confirms it has handed the game off
+// the previous owner stores the game before confirming so this node does not load a stale copy while the game is still played there
+func (c *Cluster) Await(ctx context.Context, gameKey, gameID string) error {
+	key := gameKey + "/" + gameID
+	ctx, cancel := context.WithTimeout(ctx, c.handoffWait)
+	defer cancel()
+	ticker := time.NewTicker(handoffPollInterval)
+	defer ticker.Stop()
+	for {
+		c.mu.RLock()
+		previous := ""
+		if c.previous != nil {
+			previous = c.previous.owner(key)
+		}
+		pending := c.unconfirmed[previous]
+		members := c.ring.members
+		c.mu.RUnlock()
+		if !pending {
+			return nil
+		}
+		if state, err := probe(ctx, c.client, previous); err == nil && (state.Left || equal(state.HandedOff, members)) {
+			c.mu.Lock()
+			if equal(c.ring.members, members) {
+				delete(c.unconfirmed, previous)
+			}
+			c.mu.Unlock()
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ErrHandoffPending(previous)
+		}
+	}
+}
+
+// ServeNode reports this node's NodeState
+func (c *Cluster) ServeNode(w http.ResponseWriter, r *http.Request) {
+	c.mu.RLock()
+	state := NodeState{Left: c.left, HandedOff: c.handedOff}
+	c.mu.RUnlock()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(state)
+}
+
+// Forward proxies or redirects the request to the owning node
+func (c *Cluster) Forward(w http.ResponseWriter, r *http.Request, owner string) {
+	if c.redirect {
+		http.Redirect(w, r, owner+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+		return
+	}
+	proxy, err := c.proxy(owner)
+	if err != nil {
+		logger.Log.Error().Caller().Err(err).Msgf("failed to proxy request to '%s'", owner)
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+	r.Header.Set(ForwardedHeader, c.addr)
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		// proxied websockets outlive the request timeout so must not be cancelled with it
+		r = r.WithContext(context.WithoutCancel(r.Context()))
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+// Leave deregisters this node so that other nodes take ownership of its games
+// games must be stored before leaving as the other nodes load them from the game store straight away
+func (c *Cluster) Leave(ctx context.Context) error {
+	select {
+	case <-c.stop:
+	default:
+		close(c.stop)
+		<-c.done
+	}
+	c.mu.Lock()
+	c.left = true
+	c.mu.Unlock()
+	if err := c.registry.Deregister(ctx, c.addr); err != nil {
+		return err
+	}
+	return c.registry.Close()
+}
+
+// Close closes the shared redis client
+// it is called once requests have finished rather than on leaving as requests still being served may use it
+func (c *Cluster) Close() error {
+	if c.redis == nil {
+		return nil
+	}
+	return c.redis.Close()
+}
+
+func (c *Cluster) proxy(owner string) (*httputil.ReverseProxy, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if proxy, ok := c.proxies[owner]; ok {
+		return proxy, nil
+	}
+	target, err := url.Parse(owner)
+	if err != nil {
+		return nil, err
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	c.proxies[owner] = proxy
+	return proxy, nil
+}
+
+func (c *Cluster) heartbeat() {
+	defer close(c.done)
+	ticker := time.NewTicker(c.heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), c.heartbeatInterval)
+			if err := c.registry.Register(ctx, c.addr, c.memberTTL); err != nil {
+				logger.Log.Error().Caller().Err(err).Msg("failed to renew cluster registration")
+			}
+			c.refresh(ctx)
+			cancel()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// refresh rebuilds the hash ring if the membership has changed and notifies listeners
+func (c *Cluster) refresh(ctx context.Context) {
+	members, err := c.registry.Members(ctx)
+	if err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to list cluster members")
+		return
+	}
+	// copied as registries may return a list they still hold
+	members = append([]string(nil), members...)
+	// this node keeps serving its own games even if its registration briefly lapses
+	if !contains(members, c.addr) {
+		members = append(members, c.addr)
+	}
+	sort.Strings(members)
+
+	c.mu.Lock()
+	previous := c.ring
+	if !c.refreshed {
+		// games were owned by the other members before this node joined
+		previous = newRing(without(members, c.addr), c.virtualNodes)
+		c.refreshed = true
+	}
+	if equal(members, c.ring.members) {
+		if c.handedOff == nil {
+			c.handedOff = members
+		}
+		if equal(c.handedOff, members) {
+			c.mu.Unlock()
+			return
+		}
+		// handing off games for the membership failed before so is retried
+	} else {
+		logger.Log.Info().Msgf("cluster membership changed to %v", members)
+		c.ring = newRing(members, c.virtualNodes)
+		c.previous = previous
+		c.unconfirmed = make(map[string]bool)
+		for _, member := range previous.members {
+			// members that left stored their games before leaving
+			if member != c.addr && contains(members, member) {
+				c.unconfirmed[member] = true
+			}
+		}
+	}
+	onChange := c.onChange
+	c.mu.Unlock()
+
+	failed := false
+	for _, fn := range onChange {
+		if err := fn(); err != nil {
+			logger.Log.Error().Caller().Err(err).Msgf("failed to hand off games for cluster membership %v", members)
+			failed = true
+		}
+	}
+	if failed {
+		// the new owners keep waiting on this node rather than load games it may still be playing
+		return
+	}
+
+	c.mu.Lock()
+	if equal(members, c.ring.members) {
+		c.handedOff = members
+	}
+	c.mu.Unlock()
+}
+
+// probe asks the node at addr for its NodeState
+func probe(ctx context.Context, client *http.Client, addr string) (*NodeState, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr+NodePath, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, ErrProbeStatus(addr, resp.StatusCode)
+	}
+	var state NodeState
+	if err := json.NewDecoder(resp.Body).Decode(&state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
@@ -0,0 +1,151 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestCluster returns a cluster sharing the registry that is only refreshed when the test calls refresh
+func newTestCluster(t *testing.T, addr string, registry Registry) *Cluster {
+	t.Helper()
+	c, err := NewClusterWithRegistry(&Config{
+		Addr:              addr,
+		HeartbeatInterval: time.Hour,
+		MemberTTL:         time.Hour,
+		HandoffWait:       200 * time.Millisecond,
+	}, registry)
+	if err != nil {
+		t.Fatalf("failed to create cluster: %s", err)
+	}
+	return c
+}
+
+func TestClusterRefresh(t *testing.T) {
+	ctx := context.Background()
+	registry := NewMemoryRegistry()
+	a := newTestCluster(t, "http://a", registry)
+	b := newTestCluster(t, "http://b", registry)
+	if err := a.Start(ctx); err != nil {
+		t.Fatalf("failed to start cluster: %s", err)
+	}
+	defer a.Leave(ctx)
+	if err := b.Start(ctx); err != nil {
+		t.Fatalf("failed to start cluster: %s", err)
+	}
+	a.refresh(ctx)
+	for _, c := range []*Cluster{a, b} {
+		if members := c.Members(); !equal(members, []string{"http://a", "http://b"}) {
+			t.Fatalf("got members %v on '%s', want both nodes", members, c.Addr())
+		}
+	}
+	for i := 0; i < 100; i++ {
+		gameID := strconv.Itoa(i)
+		if a.Owner("tictactoe", gameID) != b.Owner("tictactoe", gameID) {
+			t.Fatalf("got nodes disagreeing on the owner of game '%s'", gameID)
+		}
+	}
+
+	if err := b.Leave(ctx); err != nil {
+		t.Fatalf("failed to leave cluster: %s", err)
+	}
+	a.refresh(ctx)
+	if members := a.Members(); !equal(members, []string{"http://a"}) {
+		t.Fatalf("got members %v once a node left, want only the remaining node", members)
+	}
+	if owner := a.Owner("tictactoe", "0"); owner != "http://a" {
+		t.Errorf("got owner '%s', want the remaining node to own every game", owner)
+	}
+}
+
+func TestClusterHandoffFencing(t *testing.T) {
+	ctx := context.Background()
+	registry := NewMemoryRegistry()
+	// the previous owner is served over http so the new owner can probe whether it handed off its games
+	server := httptest.NewUnstartedServer(nil)
+	a := newTestCluster(t, "http://"+server.Listener.Addr().String(), registry)
+	server.Config.Handler = http.HandlerFunc(a.ServeNode)
+	server.Start()
+	defer server.Close()
+	var handoffs int
+	a.OnChange(func() error {
+		handoffs++
+		if handoffs == 1 {
+			return errors.New("failed to store game")
+		}
+		return nil
+	})
+	if err := a.Start(ctx); err != nil {
+		t.Fatalf("failed to start cluster: %s", err)
+	}
+	defer a.Leave(ctx)
+
+	b := newTestCluster(t, "http://b.invalid", registry)
+	if err := b.Start(ctx); err != nil {
+		t.Fatalf("failed to start cluster: %s", err)
+	}
+	defer b.Leave(ctx)
+	// a game owned by the new node was owned by the previous node before it joined
+	gameID := ""
+	for i := 0; gameID == ""; i++ {
+		if b.IsOwner("tictactoe", strconv.Itoa(i)) {
+			gameID = strconv.Itoa(i)
+		}
+	}
+
+	// the first handoff fails so the new owner must not load the game
+	a.refresh(ctx)
+	if err := b.Await(ctx, "tictactoe", gameID); err == nil {
+		t.Fatalf("got no error awaiting a failed handoff, want it to stay pending")
+	}
+
+	// the handoff is retried on the next refresh even though the membership is unchanged
+	a.refresh(ctx)
+	if err := b.Await(ctx, "tictactoe", gameID); err != nil {
+		t.Fatalf("got %v awaiting a retried handoff, want it confirmed", err)
+	}
+	a.refresh(ctx)
+	if handoffs != 2 {
+		t.Errorf("got %d handoffs, want a completed handoff not to be repeated", handoffs)
+	}
+}
+
+func TestClusterRedis(t *testing.T) {
+	ctx := context.Background()
+	c := newTestCluster(t, "http://a", NewMemoryRegistry())
+	if client, _ := c.Redis(); client != nil {
+		t.Fatalf("got a redis client without a redis address, want none")
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("got %v closing without a redis client", err)
+	}
+
+	mr := miniredis.RunT(t)
+	c, err := NewClusterWithRegistry(&Config{Addr: "http://a", HeartbeatInterval: time.Hour, Redis: RedisConfig{Addr: mr.Addr()}}, NewMemoryRegistry())
+	if err != nil {
+		t.Fatalf("failed to create cluster: %s", err)
+	}
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("failed to start cluster: %s", err)
+	}
+	// requests still being served after leaving may use redis until the cluster is closed
+	if err := c.Leave(ctx); err != nil {
+		t.Fatalf("failed to leave cluster: %s", err)
+	}
+	client, _ := c.Redis()
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Fatalf("got %v using redis after leaving, want it open until closed", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("failed to close cluster: %s", err)
+	}
+	if err := client.Ping(ctx).Err(); err == nil {
+		t.Fatalf("got redis still open once closed")
+	}
+}
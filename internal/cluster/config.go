@@ -0,0 +1,51 @@
+package cluster
+
+import "time"
+
+const (
+	RegistryStatic = "static"
+	RegistryMemory = "memory"
+	RegistryRedis  = "redis"
+)
+
+type Config struct {
+	Enabled bool
+
+	// Addr is the base url other nodes and redirected clients use to reach this node e.g. http://10.0.0.1:8080
+	Addr string
+
+	// Registry is where nodes find each other - one of static, memory or redis
+	// static uses the fixed Peers list, memory is an in process stand-in for a shared store and redis shares membership through redis keys
+	Registry string
+
+	// Peers is the list of node addresses, including this node, used by the static registry
+	// each peer is probed on every heartbeat and only those that answer and have not left are members
+	Peers []string
+
+	// Redis holds the connection settings for the redis registry and for state shared by every node such as idempotent responses
+	// that state is only shared when the registry is redis or an Addr is set
+	Redis RedisConfig
+
+	// HeartbeatInterval is how often this node renews its registration and refreshes the membership list
+	HeartbeatInterval time.Duration
+
+	// MemberTTL is how long a registration lasts without being renewed
+	MemberTTL time.Duration
+
+	// VirtualNodes is the number of points each node is given on the hash ring
+	VirtualNodes int
+
+	// HandoffWait is how long a request for a game taken over from another node waits for that node to confirm it handed the game off
+	HandoffWait time.Duration
+
+	// Redirect replies with a temporary redirect to the owning node instead of proxying the request
+	Redirect bool
+}
+
+type RedisConfig struct {
+	Addr      string
+	Username  string
+	Password  string
+	DB        int
+	KeyPrefix string
+}
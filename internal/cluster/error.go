@@ -0,0 +1,23 @@
+package cluster
+
+import "fmt"
+
+var (
+	ErrUnknownRegistry = func(registry string) error {
+		return fmt.Errorf("unknown cluster registry '%s'", registry)
+	}
+
+	ErrNoAddr = fmt.Errorf("cluster address is required")
+
+	ErrNotAPeer = func(addr string) error {
+		return fmt.Errorf("cluster address '%s' is not in the list of static peers", addr)
+	}
+
+	ErrHandoffPending = func(addr string) error {
+		return fmt.Errorf("node '%s' has not confirmed handing off its games", addr)
+	}
+
+	ErrProbeStatus = func(addr string, status int) error {
+		return fmt.Errorf("node '%s' answered probe with status %d", addr, status)
+	}
+)
@@ -0,0 +1,232 @@
+package cluster
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Registry keeps track of which nodes are currently members of the cluster
+type Registry interface {
+	// Register adds or renews the node for the ttl
+	Register(ctx context.Context, addr string, ttl time.Duration) error
+
+	// Deregister removes the node so that others stop routing to it
+	Deregister(ctx context.Context, addr string) error
+
+	// Members returns the addresses of all registered nodes
+	Members(ctx context.Context) ([]string, error)
+
+	Close() error
+}
+
+func newRegistry(config *Config) (Registry, error) {
+	switch config.Registry {
+	case RegistryStatic, "":
+		peers := make([]string, 0, len(config.Peers))
+		for _, peer := range config.Peers {
+			peers = append(peers, strings.TrimSuffix(peer, "/"))
+		}
+		if !contains(peers, strings.TrimSuffix(config.Addr, "/")) {
+			return nil, ErrNotAPeer(config.Addr)
+		}
+		return newStaticRegistry(peers), nil
+	case RegistryMemory:
+		return NewMemoryRegistry(), nil
+	case RegistryRedis:
+		return newRedisRegistry(&config.Redis), nil
+	default:
+		return nil, ErrUnknownRegistry(config.Registry)
+	}
+}
+
+// staticRegistry is a fixed list of peers where only peers that answer a probe and have not left are members
+// nodes registered in this process are members until they deregister and are not probed
+type staticRegistry struct {
+	peers  []string
+	client *http.Client
+
+	mu    sync.Mutex
+	local map[string]bool // mapping from address of a node in this process to whether it is registered
+}
+
+func newStaticRegistry(peers []string) *staticRegistry {
+	return &staticRegistry{
+		peers:  peers,
+		client: &http.Client{Timeout: probeTimeout},
+		local:  make(map[string]bool),
+	}
+}
+
+func (r *staticRegistry) Register(ctx context.Context, addr string, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.local[addr] = true
+	return nil
+}
+
+func (r *staticRegistry) Deregister(ctx context.Context, addr string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.local[addr] = false
+	return nil
+}
+
+func (r *staticRegistry) Members(ctx context.Context) ([]string, error) {
+	r.mu.Lock()
+	local := make(map[string]bool, len(r.local))
+	for addr, registered := range r.local {
+		local[addr] = registered
+	}
+	r.mu.Unlock()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		members = make([]string, 0, len(r.peers))
+	)
+	for _, peer := range r.peers {
+		if registered, ok := local[peer]; ok {
+			if registered {
+				members = append(members, peer)
+			}
+			continue
+		}
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+			if state, err := probe(ctx, r.client, peer); err != nil || state.Left {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			members = append(members, peer)
+		}(peer)
+	}
+	wg.Wait()
+	return members, nil
+}
+
+func (r *staticRegistry) Close() error {
+	return nil
+}
+
+// MemoryRegistry is an in process stand-in for a shared membership store
+// it may be shared between clusters running in the same process
+type MemoryRegistry struct {
+	mu      sync.Mutex
+	members map[string]time.Time // mapping from node address to registration expiry
+}
+
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{
+		members: make(map[string]time.Time),
+	}
+}
+
+func (r *MemoryRegistry) Register(ctx context.Context, addr string, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.members[addr] = time.Now().Add(ttl)
+	return nil
+}
+
+func (r *MemoryRegistry) Deregister(ctx context.Context, addr string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.members, addr)
+	return nil
+}
+
+func (r *MemoryRegistry) Members(ctx context.Context) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	members := make([]string, 0, len(r.members))
+	for addr, expiry := range r.members {
+		if now.After(expiry) {
+			delete(r.members, addr)
+			continue
+		}
+		members = append(members, addr)
+	}
+	return members, nil
+}
+
+func (r *MemoryRegistry) Close() error {
+	return nil
+}
+
+// redisRegistry stores each node under its own key that expires unless renewed
+type redisRegistry struct {
+	client *redis.Client
+	prefix string
+}
+
+func newRedisRegistry(config *RedisConfig) *redisRegistry {
+	return &redisRegistry{
+		client: NewRedisClient(config),
+		prefix: config.KeyPrefix + "members:",
+	}
+}
+
+// NewRedisClient returns a client for the configured redis, it connects on first use
+func NewRedisClient(config *RedisConfig) *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:     config.Addr,
+		Username: config.Username,
+		Password: config.Password,
+		DB:       config.DB,
+	})
+}
+
+func (r *redisRegistry) Register(ctx context.Context, addr string, ttl time.Duration) error {
+	return r.client.Set(ctx, r.prefix+addr, time.Now().UTC().Format(time.RFC3339), ttl).Err()
+}
+
+func (r *redisRegistry) Deregister(ctx context.Context, addr string) error {
+	return r.client.Del(ctx, r.prefix+addr).Err()
+}
+
+func (r *redisRegistry) Members(ctx context.Context) ([]string, error) {
+	members := make([]string, 0)
+	iter := r.client.Scan(ctx, 0, r.prefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		members = append(members, strings.TrimPrefix(iter.Val(), r.prefix))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func (r *redisRegistry) Close() error {
+	return r.client.Close()
+}
+
+func contains(items []string, item string) bool {
+	for _, it := range items {
+		if it == item {
+			return true
+		}
+	}
+	return false
+}
+
+func without(items []string, item string) []string {
+	remaining := make([]string, 0, len(items))
+	for _, it := range items {
+		if it != item {
+			remaining = append(remaining, it)
+		}
+	}
+	return remaining
+}
+
+func equal(a, b []string) bool {
+	return strings.Join(a, ",") == strings.Join(b, ",")
+}
@@ -0,0 +1,54 @@
+package cluster
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+	"strconv"
+)
+
+// ring assigns keys to members using consistent hashing so that membership changes only move a small share of keys
+type ring struct {
+	members []string
+	hashes  []uint32
+	owners  map[uint32]string // mapping from point on the ring to member
+}
+
+func newRing(members []string, virtualNodes int) *ring {
+	r := &ring{
+		members: members,
+		hashes:  make([]uint32, 0, len(members)*virtualNodes),
+		owners:  make(map[uint32]string),
+	}
+	for _, member := range members {
+		for i := 0; i < virtualNodes; i++ {
+			hash := hashKey(member + "#" + strconv.Itoa(i))
+			if _, ok := r.owners[hash]; ok {
+				continue
+			}
+			r.owners[hash] = member
+			r.hashes = append(r.hashes, hash)
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+	return r
+}
+
+// owner returns the member responsible for the key or an empty string if there are no members
+func (r *ring) owner(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	hash := hashKey(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= hash })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.owners[r.hashes[i]]
+}
+
+// hashKey uses sha256 rather than a faster hash as keys differ only slightly and must still spread evenly
+func hashKey(key string) uint32 {
+	sum := sha256.Sum256([]byte(key))
+	return binary.BigEndian.Uint32(sum[:4])
+}
@@ -0,0 +1,38 @@
+package cluster
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestRingOwner(t *testing.T) {
+	members := []string{"http://a", "http://b", "http://c"}
+	r := newRing(members, defaultVirtualNodes)
+	if owner := newRing(nil, defaultVirtualNodes).owner("game"); owner != "" {
+		t.Errorf("got owner '%s' of an empty ring, want none", owner)
+	}
+
+	owned := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		key := "tictactoe/" + strconv.Itoa(i)
+		owner := r.owner(key)
+		if other := newRing(members, defaultVirtualNodes).owner(key); other != owner {
+			t.Fatalf("got owners '%s' and '%s' of '%s' from rings with the same members", owner, other, key)
+		}
+		owned[owner]++
+	}
+	for _, member := range members {
+		if owned[member] < 500 {
+			t.Errorf("got %d of 3000 keys owned by '%s', want them spread evenly", owned[member], member)
+		}
+	}
+
+	// only keys owned by a member that leaves move
+	smaller := newRing([]string{"http://a", "http://b"}, defaultVirtualNodes)
+	for i := 0; i < 3000; i++ {
+		key := "tictactoe/" + strconv.Itoa(i)
+		if owner := r.owner(key); owner != "http://c" && smaller.owner(key) != owner {
+			t.Fatalf("got '%s' moved from '%s' to '%s' when another member left", key, owner, smaller.owner(key))
+		}
+	}
+}
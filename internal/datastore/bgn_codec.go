@@ -0,0 +1,68 @@
+package datastore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"io"
+)
+
+// Formats of an encoded bgn payload given by its first byte
+const (
+	bgnFormatRaw  byte = 0x00
+	bgnFormatGzip byte = 0x01
+)
+
+// encodedBGN is a bgn payload as stored in the game store
+type encodedBGN struct {
+	Data []byte   // format byte followed by the payload
+	Size int      // length of the uncompressed bgn
+	Hash [32]byte // hash of the uncompressed bgn used to skip rewriting unchanged games
+}
+
+func encodeBGN(raw string) (*encodedBGN, error) {
+	buf := bytes.NewBuffer([]byte{bgnFormatGzip})
+	writer, err := gzip.NewWriterLevel(buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write([]byte(raw)); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	data := buf.Bytes()
+	// tiny games may grow when compressed so store them as is
+	if len(data) >= len(raw)+1 {
+		data = append([]byte{bgnFormatRaw}, raw...)
+	}
+	return &encodedBGN{
+		Data: data,
+		Size: len(raw),
+		Hash: sha256.Sum256([]byte(raw)),
+	}, nil
+}
+
+func decodeBGN(data []byte) (string, error) {
+	if len(data) == 0 {
+		return "", ErrGameStoreBGNFormat
+	}
+	switch data[0] {
+	case bgnFormatRaw:
+		return string(data[1:]), nil
+	case bgnFormatGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data[1:]))
+		if err != nil {
+			return "", err
+		}
+		defer reader.Close()
+		raw, err := io.ReadAll(reader)
+		if err != nil {
+			return "", err
+		}
+		return string(raw), nil
+	default:
+		return "", ErrGameStoreBGNFormat
+	}
+}
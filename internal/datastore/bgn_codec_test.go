@@ -0,0 +1,63 @@
+package datastore
+
+import (
+	"crypto/sha256"
+	"strings"
+	"testing"
+)
+
+func TestBGNCodecRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		raw    string
+		format byte
+	}{
+		{"empty", "", bgnFormatRaw},
+		{"tiny", "[Game \"Tic-Tac-Toe\"]", bgnFormatRaw},
+		{"large", "[Game \"Tic-Tac-Toe\"][Teams \"red, blue\"]\n\n" + strings.Repeat("0m&1.1 1m&0.0 ", 200), bgnFormatGzip},
+	} {
+		encoded, err := encodeBGN(test.raw)
+		if err != nil {
+			t.Fatalf("failed to encode %s bgn: %s", test.name, err)
+		}
+		if encoded.Data[0] != test.format {
+			t.Errorf("got format %d encoding %s bgn, want %d", encoded.Data[0], test.name, test.format)
+		}
+		if encoded.Size != len(test.raw) || encoded.Hash != sha256.Sum256([]byte(test.raw)) {
+			t.Errorf("got size %d and a different hash encoding %s bgn, want size %d", encoded.Size, test.name, len(test.raw))
+		}
+		decoded, err := decodeBGN(encoded.Data)
+		if err != nil {
+			t.Fatalf("failed to decode %s bgn: %s", test.name, err)
+		}
+		if decoded != test.raw {
+			t.Errorf("got %q decoding %s bgn, want %q", decoded, test.name, test.raw)
+		}
+	}
+}
+
+func TestDecodeBGNInvalid(t *testing.T) {
+	for _, data := range [][]byte{nil, {0x02, 'a'}} {
+		if _, err := decodeBGN(data); err != ErrGameStoreBGNFormat {
+			t.Errorf("got %v decoding %v, want %v", err, data, ErrGameStoreBGNFormat)
+		}
+	}
+	if _, err := decodeBGN([]byte{bgnFormatGzip, 'a'}); err == nil {
+		t.Errorf("got no error decoding corrupt gzip bgn")
+	}
+}
+
+func TestStoredBGN(t *testing.T) {
+	legacy := "[Game \"Tic-Tac-Toe\"]"
+	encoded, _ := encodeBGN("[Game \"Connect4\"]")
+	// the text column is preferred as older releases only update it
+	if raw, err := storedBGN(&legacy, encoded.Data); err != nil || raw != legacy {
+		t.Errorf("got %q and %v reading both columns, want the text column", raw, err)
+	}
+	if raw, err := storedBGN(nil, encoded.Data); err != nil || raw != "[Game \"Connect4\"]" {
+		t.Errorf("got %q and %v reading only bgn_data", raw, err)
+	}
+	if _, err := storedBGN(nil, nil); err != ErrGameStoreBGNFormat {
+		t.Errorf("got %v reading neither column, want %v", err, ErrGameStoreBGNFormat)
+	}
+}
@@ -0,0 +1,70 @@
+package datastore
+
+import (
+	"context"
+	"time"
+
+	"github.com/quibbble/go-quibbble/pkg/logger"
+)
+
+const defaultCacheTTL = time.Minute * 10
+
+// CachedGameStore wraps any game store with a redis read-through cache of games
+// so repeated lookups of inactive games do not hit the underlying store each time
+type CachedGameStore struct {
+	GameStore
+	cache *RedisClient
+	ttl   time.Duration
+}
+
+func NewCachedGameStore(store GameStore, cache *RedisClient, ttl time.Duration) *CachedGameStore {
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	return &CachedGameStore{
+		GameStore: store,
+		cache:     cache,
+		ttl:       ttl,
+	}
+}
+
+func (c *CachedGameStore) GetGame(ctx context.Context, gameKey, gameID string) (*Game, error) {
+	if game, err := c.cache.GetGame(ctx, gameKey, gameID); err == nil {
+		return game, nil
+	} else if err != ErrGameStoreNotFound {
+		logger.Log.Warn().Err(err).Msgf("failed to read '%s' with id '%s' from cache", gameKey, gameID)
+	}
+	game, err := c.GameStore.GetGame(ctx, gameKey, gameID)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.cache.store(ctx, game, c.ttl); err != nil {
+		logger.Log.Warn().Err(err).Msgf("failed to cache '%s' with id '%s'", gameKey, gameID)
+	}
+	return game, nil
+}
+
+func (c *CachedGameStore) Store(ctx context.Context, game *Game) error {
+	if err := c.GameStore.Store(ctx, game); err != nil {
+		return err
+	}
+	if err := c.cache.store(ctx, game, c.ttl); err != nil {
+		logger.Log.Warn().Err(err).Msgf("failed to cache '%s' with id '%s'", game.GameKey, game.GameID)
+	}
+	return nil
+}
+
+// Ping only checks the underlying store as the game store keeps working without its cache
+func (c *CachedGameStore) Ping(ctx context.Context) error {
+	if err := c.cache.Ping(ctx); err != nil {
+		logger.Log.Warn().Err(err).Msg("failed to ping cache")
+	}
+	return c.GameStore.Ping(ctx)
+}
+
+func (c *CachedGameStore) Close(ctx context.Context) error {
+	if err := c.cache.Close(ctx); err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to close cache")
+	}
+	return c.GameStore.Close(ctx)
+}
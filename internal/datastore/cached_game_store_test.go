@@ -0,0 +1,103 @@
+package datastore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestCachedGameStore(t *testing.T, ttl time.Duration) (*CachedGameStore, *MemoryGameStore, *miniredis.Miniredis) {
+	t.Helper()
+	cache, mr := newTestRedisClient(t)
+	store := NewMemoryGameStore()
+	return NewCachedGameStore(store, cache, ttl), store, mr
+}
+
+func TestCachedGameStoreReadThrough(t *testing.T) {
+	cached, store, _ := newTestCachedGameStore(t, time.Minute)
+	ctx := context.Background()
+
+	if _, err := cached.GetGame(ctx, "Tic-Tac-Toe", "missing"); err != ErrGameStoreNotFound {
+		t.Fatalf("got %v, want %v", err, ErrGameStoreNotFound)
+	}
+
+	game := newTestGame(t, "Tic-Tac-Toe", "example", time.Now().UTC())
+	if err := store.Store(ctx, game); err != nil {
+		t.Fatalf("failed to store game: %s", err)
+	}
+	before := store.Reads()
+	for i := 0; i < 3; i++ {
+		got, err := cached.GetGame(ctx, game.GameKey, game.GameID)
+		if err != nil {
+			t.Fatalf("failed to get game: %s", err)
+		}
+		assertGame(t, game, got)
+	}
+	if reads := store.Reads() - before; reads != 1 {
+		t.Errorf("got %d reads from the game store, want 1", reads)
+	}
+}
+
+func TestCachedGameStoreStoreUpdatesCache(t *testing.T) {
+	cached, store, _ := newTestCachedGameStore(t, time.Minute)
+	ctx := context.Background()
+
+	game := newTestGame(t, "Tic-Tac-Toe", "example", time.Now().UTC())
+	if err := cached.Store(ctx, game); err != nil {
+		t.Fatalf("failed to store game: %s", err)
+	}
+	if _, err := cached.GetGame(ctx, game.GameKey, game.GameID); err != nil {
+		t.Fatalf("failed to get game: %s", err)
+	}
+
+	// a stored update replaces the cached game rather than leaving a stale copy
+	game.PlayCount = 2
+	game.Winners = []string{"blue"}
+	game.UpdatedAt = game.UpdatedAt.Add(time.Minute)
+	if err := cached.Store(ctx, game); err != nil {
+		t.Fatalf("failed to store game: %s", err)
+	}
+	before := store.Reads()
+	got, err := cached.GetGame(ctx, game.GameKey, game.GameID)
+	if err != nil {
+		t.Fatalf("failed to get game: %s", err)
+	}
+	assertGame(t, game, got)
+	if reads := store.Reads() - before; reads != 0 {
+		t.Errorf("got %d reads from the game store, want 0", reads)
+	}
+	stored, err := store.GetGame(ctx, game.GameKey, game.GameID)
+	if err != nil {
+		t.Fatalf("failed to get game: %s", err)
+	}
+	assertGame(t, game, stored)
+}
+
+func TestCachedGameStoreExpiry(t *testing.T) {
+	cached, store, mr := newTestCachedGameStore(t, time.Minute)
+	ctx := context.Background()
+
+	game := newTestGame(t, "Tic-Tac-Toe", "example", time.Now().UTC())
+	if err := cached.Store(ctx, game); err != nil {
+		t.Fatalf("failed to store game: %s", err)
+	}
+	mr.FastForward(time.Minute + time.Second)
+	if _, err := cached.cache.GetGame(ctx, game.GameKey, game.GameID); err != ErrGameStoreNotFound {
+		t.Fatalf("got %v from the cache, want %v", err, ErrGameStoreNotFound)
+	}
+
+	before := store.Reads()
+	got, err := cached.GetGame(ctx, game.GameKey, game.GameID)
+	if err != nil {
+		t.Fatalf("failed to get game: %s", err)
+	}
+	assertGame(t, game, got)
+	if reads := store.Reads() - before; reads != 1 {
+		t.Errorf("got %d reads from the game store, want 1", reads)
+	}
+	if _, err := cached.cache.GetGame(ctx, game.GameKey, game.GameID); err != nil {
+		t.Errorf("got %v from the cache, want the game to be cached again", err)
+	}
+}
@@ -2,16 +2,37 @@ package datastore
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/quibbble/go-boardgame/pkg/bgn"
 	"github.com/quibbble/go-quibbble/pkg/logger"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultMaxConns          = 3
+	defaultMaxConnLifetime   = time.Hour
+	defaultMaxConnIdleTime   = time.Minute * 30
+	defaultHealthCheckPeriod = time.Minute
+	defaultQueryTimeout      = time.Second * 5
+
+	// serializationFailure is the error code cockroach returns when a transaction must be retried
+	serializationFailure = "40001"
+	retryBackoff         = time.Millisecond * 50
 )
 
 type CockroachClient struct {
-	pool *pgxpool.Pool
+	pool         *pgxpool.Pool
+	queryTimeout time.Duration
+	maxRetries   int
+	clearLegacy  bool // whether the text bgn column is no longer written
+	stop         chan struct{}
 }
 
 func NewCockroachClient(config *CockroachConfig) (*CockroachClient, error) {
@@ -25,50 +46,86 @@ func NewCockroachClient(config *CockroachConfig) (*CockroachClient, error) {
 		return nil, ErrGameStoreConnection
 	}
 
-	cfg.MaxConns = 3
-	cfg.MinConns = 0
-	cfg.MaxConnLifetime = time.Hour
-	cfg.MaxConnIdleTime = time.Minute * 30
-	cfg.HealthCheckPeriod = time.Minute
+	cfg.MaxConns = defaultMaxConns
+	if config.MaxConns > 0 {
+		cfg.MaxConns = config.MaxConns
+	}
+	cfg.MinConns = config.MinConns
+	cfg.MaxConnLifetime = defaultMaxConnLifetime
+	if config.MaxConnLifetime > 0 {
+		cfg.MaxConnLifetime = config.MaxConnLifetime
+	}
+	cfg.MaxConnIdleTime = defaultMaxConnIdleTime
+	if config.MaxConnIdleTime > 0 {
+		cfg.MaxConnIdleTime = config.MaxConnIdleTime
+	}
+	cfg.HealthCheckPeriod = defaultHealthCheckPeriod
+	if config.HealthCheckPeriod > 0 {
+		cfg.HealthCheckPeriod = config.HealthCheckPeriod
+	}
+
+	queryTimeout := defaultQueryTimeout
+	if config.QueryTimeout > 0 {
+		queryTimeout = config.QueryTimeout
+	}
 
-	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
 	if err != nil {
 		logger.Log.Error().Caller().Err(err).Msg("failed to connect to cockroach")
 		return nil, ErrGameStoreConnection
 	}
 
-	return &CockroachClient{
-		pool: pool,
-	}, nil
+	client := &CockroachClient{
+		pool:         pool,
+		queryTimeout: queryTimeout,
+		maxRetries:   config.MaxRetries,
+		clearLegacy:  config.ClearLegacyBGN,
+		stop:         make(chan struct{}),
+	}
+	if config.ReencodeBatchSize > 0 {
+		go client.reencode(config.ReencodeBatchSize, config.ReencodeInterval)
+	}
+	return client, nil
 }
 
-func (c *CockroachClient) GetGame(gameKey, gameID string) (*Game, error) {
+func (c *CockroachClient) GetGame(ctx context.Context, gameKey, gameID string) (*Game, error) {
 	if c.pool == nil {
 		return nil, ErrGameStoreNotEnabled
 	}
 
 	sql := `
-		SELECT bgn, created_at, updated_at, play_count FROM quibbble.games
+		SELECT bgn, bgn_data, created_at, updated_at, play_count,
+			COALESCE(action_count, 0), COALESCE(winners, ARRAY[]::STRING[]), COALESCE(participants, '{}'::JSONB)
+		FROM quibbble.games
 		WHERE game_key=$1
 		AND game_id=$2
 	`
-	row := c.pool.QueryRow(context.Background(), sql, gameKey, gameID)
 
 	var (
-		raw                  string
+		legacy               *string
+		data                 []byte
 		createdAt, updatedAt time.Time
 		playCount            int
+		actionCount          int
+		winners              []string
+		participants         map[string]string
 	)
 
-	if err := row.Scan(&raw, &createdAt, &updatedAt, &playCount); err != nil {
-		if err == pgx.ErrNoRows {
-			return nil, ErrGameStoreNotFound
-		}
-		return nil, ErrGameStoreSelect
+	if err := c.do(ctx, func(ctx context.Context) error {
+		return c.pool.QueryRow(ctx, sql, gameKey, gameID).Scan(&legacy, &data, &createdAt, &updatedAt, &playCount,
+			&actionCount, &winners, &participants)
+	}); err != nil {
+		return nil, selectError(err)
 	}
 
 	logger.Log.Debug().Msgf("found '%s' with id '%s' in game store", gameKey, gameID)
 
+	raw, err := storedBGN(legacy, data)
+	if err != nil {
+		return nil, err
+	}
 	game, err := bgn.Parse(raw)
 	if err != nil {
 		return nil, err
@@ -81,83 +138,527 @@ func (c *CockroachClient) GetGame(gameKey, gameID string) (*Game, error) {
 		CreatedAt: createdAt,
 		UpdatedAt: updatedAt,
 		PlayCount: playCount,
+
+		ActionCount:  actionCount,
+		Winners:      winners,
+		Participants: participants,
 	}, nil
 }
 
-func (c *CockroachClient) GetStats(games []string) (*Stats, error) {
+func (c *CockroachClient) GetStats(ctx context.Context, games []string) (*Stats, error) {
 	if c.pool == nil {
 		return nil, ErrGameStoreNotEnabled
 	}
 
 	sql := `
-		SELECT game_key, COUNT(game_id) AS games_created, SUM(play_count) AS games_played FROM quibbble.games
+		SELECT game_key, COUNT(game_id) AS games_created, SUM(play_count) AS games_played,
+			COALESCE(SUM(COALESCE(length(bgn_data), length(bgn))), 0) AS stored_bytes,
+			COALESCE(SUM(COALESCE(bgn_size, length(bgn))), 0) AS raw_bytes
+		FROM quibbble.games
 		GROUP BY game_key
 	`
 
-	rows, err := c.pool.Query(context.Background(), sql)
-	if err != nil {
-		logger.Log.Error().Caller().Err(err).Msg("failed to query cockroach")
-		if err == pgx.ErrNoRows {
-			return nil, ErrGameStoreNotFound
+	var stats *Stats
+	if err := c.do(ctx, func(ctx context.Context) error {
+		stats = &Stats{
+			GamesCreated: make(map[string]int),
+			GamesPlayed:  make(map[string]int),
+			StoredBytes:  make(map[string]int),
+			RawBytes:     make(map[string]int),
+		}
+		for _, game := range games {
+			stats.GamesCreated[game] = 0
+			stats.GamesPlayed[game] = 0
+			stats.StoredBytes[game] = 0
+			stats.RawBytes[game] = 0
+		}
+
+		rows, err := c.pool.Query(ctx, sql)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var (
+			gameKey                   string
+			gamesCreated, gamesPlayed int
+			storedBytes, rawBytes     int
+		)
+		for rows.Next() {
+			if err := rows.Scan(&gameKey, &gamesCreated, &gamesPlayed, &storedBytes, &rawBytes); err != nil {
+				return err
+			}
+			stats.GamesCreated[gameKey] = gamesCreated
+			stats.GamesPlayed[gameKey] = gamesPlayed
+			stats.StoredBytes[gameKey] = storedBytes
+			stats.RawBytes[gameKey] = rawBytes
 		}
-		return nil, ErrGameStoreSelect
+		return rows.Err()
+	}); err != nil {
+		return nil, selectError(err)
 	}
 
-	stats := &Stats{
-		GamesCreated: make(map[string]int),
-		GamesPlayed:  make(map[string]int),
+	return stats, nil
+}
+
+func (c *CockroachClient) Store(ctx context.Context, game *Game) error {
+	if c.pool == nil {
+		return ErrGameStoreNotEnabled
+	}
+
+	// rows are only rewritten if something changed to avoid storing duplicate versions of the same game
+	sql := `
+		INSERT INTO quibbble.games AS g (game_key, game_id, bgn, bgn_data, bgn_size, bgn_hash, created_at, updated_at, play_count, action_count, winners, participants)
+		VALUES ($1, $2, $12, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (game_key, game_id) DO UPDATE SET
+			bgn = excluded.bgn, bgn_data = excluded.bgn_data, bgn_size = excluded.bgn_size, bgn_hash = excluded.bgn_hash,
+			created_at = excluded.created_at, updated_at = excluded.updated_at, play_count = excluded.play_count,
+			action_count = excluded.action_count, winners = excluded.winners, participants = excluded.participants
+		WHERE g.bgn_hash IS DISTINCT FROM excluded.bgn_hash
+		OR g.updated_at IS DISTINCT FROM excluded.updated_at
+		OR g.play_count IS DISTINCT FROM excluded.play_count
+		OR g.winners IS DISTINCT FROM excluded.winners
+		OR g.participants IS DISTINCT FROM excluded.participants
+	`
+
+	raw := game.BGN.String()
+	encoded, err := encodeBGN(raw)
+	if err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to encode bgn")
+		return ErrGameStoreInsert
 	}
 
-	for _, game := range games {
-		stats.GamesCreated[game] = 0
-		stats.GamesPlayed[game] = 0
+	if err := c.do(ctx, func(ctx context.Context) error {
+		_, err := c.pool.Exec(ctx, sql, game.GameKey, game.GameID, encoded.Data, encoded.Size, encoded.Hash[:],
+			game.CreatedAt, game.UpdatedAt, game.PlayCount, len(game.BGN.Actions), game.Winners, game.Participants, c.legacyBGN(raw))
+		return err
+	}); err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to exec on cockroach")
+		return ErrGameStoreInsert
+	}
+
+	logger.Log.Debug().Msgf("stored '%s' with id '%s' in game store", game.GameKey, game.GameID)
+
+	return nil
+}
+
+const (
+	defaultSearchLimit = 25
+	maxSearchLimit     = 100
+)
+
+func (c *CockroachClient) SearchGames(ctx context.Context, query *GameQuery) (*GamePage, error) {
+	if c.pool == nil {
+		return nil, ErrGameStoreNotEnabled
 	}
 
 	var (
-		gameKey                   string
-		gamesCreated, gamesPlayed int
+		conditions = make([]string, 0)
+		args       = make([]interface{}, 0)
 	)
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if len(query.GameKeys) > 0 {
+		conditions = append(conditions, fmt.Sprintf("game_key = ANY(%s)", arg(query.GameKeys)))
+	}
+	if query.UpdatedAfter != nil {
+		conditions = append(conditions, fmt.Sprintf("updated_at >= %s", arg(*query.UpdatedAfter)))
+	}
+	if query.UpdatedBefore != nil {
+		conditions = append(conditions, fmt.Sprintf("updated_at < %s", arg(*query.UpdatedBefore)))
+	}
+	if query.MinActions > 0 {
+		conditions = append(conditions, fmt.Sprintf("action_count >= %s", arg(query.MinActions)))
+	}
+	if len(query.Participants) > 0 {
+		conditions = append(conditions, fmt.Sprintf("participants ?& %s", arg(query.Participants)))
+	}
+	switch query.Result {
+	case ResultAny:
+	case ResultCompleted:
+		conditions = append(conditions, "cardinality(winners) > 0")
+	case ResultInProgress:
+		conditions = append(conditions, "(winners IS NULL OR cardinality(winners) = 0)")
+	default:
+		return nil, fmt.Errorf("invalid result '%s'", query.Result)
+	}
+	if query.Winner != "" {
+		conditions = append(conditions, fmt.Sprintf("%s = ANY(winners)", arg(query.Winner)))
+	}
+
+	order, comparison := "DESC", "<"
+	if query.Ascending {
+		order, comparison = "ASC", ">"
+	}
+	if query.Cursor != "" {
+		cursor, err := decodeCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, fmt.Sprintf("(updated_at, game_key, game_id) %s (%s, %s, %s)",
+			comparison, arg(cursor.UpdatedAt), arg(cursor.GameKey), arg(cursor.GameID)))
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	} else if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, "\n\t\tAND ")
+	}
+	sql := fmt.Sprintf(`
+		SELECT game_key, game_id, created_at, updated_at, play_count,
+			COALESCE(action_count, 0), COALESCE(winners, ARRAY[]::STRING[]), COALESCE(participants, '{}'::JSONB)
+		FROM quibbble.games
+		%s
+		ORDER BY updated_at %s, game_key %s, game_id %s
+		LIMIT %s
+	`, where, order, order, order, arg(limit+1))
 
-	for rows.Next() {
-		if err := rows.Scan(&gameKey, &gamesCreated, &gamesPlayed); err != nil {
-			logger.Log.Error().Caller().Err(err).Msg("failed to query cockroach")
-			if err == pgx.ErrNoRows {
-				return nil, ErrGameStoreNotFound
+	var games []*Game
+	if err := c.do(ctx, func(ctx context.Context) error {
+		games = make([]*Game, 0)
+		rows, err := c.pool.Query(ctx, sql, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			game := &Game{}
+			if err := rows.Scan(&game.GameKey, &game.GameID, &game.CreatedAt, &game.UpdatedAt, &game.PlayCount,
+				&game.ActionCount, &game.Winners, &game.Participants); err != nil {
+				return err
 			}
-			return nil, ErrGameStoreSelect
+			games = append(games, game)
 		}
-		stats.GamesCreated[gameKey] = gamesCreated
-		stats.GamesPlayed[gameKey] = gamesPlayed
+		return rows.Err()
+	}); err != nil {
+		return nil, selectError(err)
 	}
 
-	return stats, nil
+	page := &GamePage{
+		Games: games,
+	}
+	if len(games) > limit {
+		page.Games = games[:limit]
+		page.NextCursor = encodeCursor(games[limit-1])
+	}
+	return page, nil
 }
 
-func (c *CockroachClient) Store(game *Game) error {
+func (c *CockroachClient) GetPlaythroughs(ctx context.Context, gameKey, gameID string) ([]*Playthrough, error) {
+	if c.pool == nil {
+		return nil, ErrGameStoreNotEnabled
+	}
+
+	sql := `
+		SELECT play_index, bgn, bgn_data, winners, participants, completed_at FROM quibbble.playthroughs
+		WHERE game_key=$1
+		AND game_id=$2
+		ORDER BY play_index
+	`
+
+	var playthroughs []*Playthrough
+	if err := c.do(ctx, func(ctx context.Context) error {
+		playthroughs = make([]*Playthrough, 0)
+		rows, err := c.pool.Query(ctx, sql, gameKey, gameID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			playthrough, err := scanPlaythrough(rows, gameKey, gameID)
+			if err != nil {
+				return err
+			}
+			playthroughs = append(playthroughs, playthrough)
+		}
+		return rows.Err()
+	}); err != nil {
+		return nil, selectError(err)
+	}
+
+	return playthroughs, nil
+}
+
+func (c *CockroachClient) GetPlaythrough(ctx context.Context, gameKey, gameID string, playIndex int) (*Playthrough, error) {
+	if c.pool == nil {
+		return nil, ErrGameStoreNotEnabled
+	}
+
+	sql := `
+		SELECT play_index, bgn, bgn_data, winners, participants, completed_at FROM quibbble.playthroughs
+		WHERE game_key=$1
+		AND game_id=$2
+		AND play_index=$3
+	`
+
+	var playthrough *Playthrough
+	if err := c.do(ctx, func(ctx context.Context) error {
+		var err error
+		playthrough, err = scanPlaythrough(c.pool.QueryRow(ctx, sql, gameKey, gameID, playIndex), gameKey, gameID)
+		return err
+	}); err != nil {
+		return nil, selectError(err)
+	}
+
+	return playthrough, nil
+}
+
+func (c *CockroachClient) StorePlaythrough(ctx context.Context, playthrough *Playthrough) error {
 	if c.pool == nil {
 		return ErrGameStoreNotEnabled
 	}
 
 	sql := `
-		UPSERT INTO quibbble.games (game_key, game_id, bgn, created_at, updated_at, play_count)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		UPSERT INTO quibbble.playthroughs (game_key, game_id, play_index, bgn, bgn_data, bgn_size, bgn_hash, winners, participants, completed_at)
+		VALUES ($1, $2, $3, $10, $4, $5, $6, $7, $8, $9)
 	`
 
-	_, err := c.pool.Exec(context.Background(), sql, game.GameKey, game.GameID, game.BGN.String(), game.CreatedAt, game.UpdatedAt, game.PlayCount)
+	raw := playthrough.BGN.String()
+	encoded, err := encodeBGN(raw)
 	if err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to encode bgn")
+		return ErrGameStoreInsert
+	}
+
+	if err := c.do(ctx, func(ctx context.Context) error {
+		_, err := c.pool.Exec(ctx, sql, playthrough.GameKey, playthrough.GameID, playthrough.PlayIndex,
+			encoded.Data, encoded.Size, encoded.Hash[:], playthrough.Winners, playthrough.Participants, playthrough.CompletedAt, c.legacyBGN(raw))
+		return err
+	}); err != nil {
 		logger.Log.Error().Caller().Err(err).Msg("failed to exec on cockroach")
 		return ErrGameStoreInsert
 	}
 
-	logger.Log.Debug().Msgf("stored '%s' with id '%s' in game store", game.GameKey, game.GameID)
+	logger.Log.Debug().Msgf("stored playthrough %d of '%s' with id '%s' in game store", playthrough.PlayIndex, playthrough.GameKey, playthrough.GameID)
 
 	return nil
 }
 
+func (c *CockroachClient) Ping(ctx context.Context) error {
+	if c.pool == nil {
+		return ErrGameStoreNotEnabled
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.queryTimeout)
+	defer cancel()
+	return c.pool.Ping(ctx)
+}
+
+func (c *CockroachClient) PoolStats() *PoolStats {
+	if c.pool == nil {
+		return &PoolStats{}
+	}
+	stat := c.pool.Stat()
+	return &PoolStats{
+		Enabled:           true,
+		MaxConns:          int(stat.MaxConns()),
+		TotalConns:        int(stat.TotalConns()),
+		IdleConns:         int(stat.IdleConns()),
+		AcquiredConns:     int(stat.AcquiredConns()),
+		AcquireCount:      stat.AcquireCount(),
+		AcquireDuration:   stat.AcquireDuration(),
+		EmptyAcquireCount: stat.EmptyAcquireCount(),
+	}
+}
+
 func (c *CockroachClient) Close(ctx context.Context) error {
 	if c.pool == nil {
 		return nil
 	}
+	close(c.stop)
 	c.pool.Close()
 	return nil
 }
+
+// reencode moves bgn stored as text in legacy rows into the encoded bgn_data column in batches until none remain
+func (c *CockroachClient) reencode(batchSize int, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	tables := map[string][]string{
+		"quibbble.games":        {"game_key", "game_id"},
+		"quibbble.playthroughs": {"game_key", "game_id", "play_index"},
+	}
+	total := 0
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+		remaining := false
+		for table, keys := range tables {
+			count, err := c.reencodeBatch(context.Background(), table, keys, batchSize)
+			if err != nil {
+				logger.Log.Error().Caller().Err(err).Msgf("failed to re-encode bgn in %s", table)
+				remaining = true
+				continue
+			}
+			total += count
+			remaining = remaining || count == batchSize
+		}
+		if !remaining {
+			logger.Log.Info().Msgf("re-encoded bgn of %d legacy rows", total)
+			return
+		}
+	}
+}
+
+func (c *CockroachClient) reencodeBatch(ctx context.Context, table string, keys []string, batchSize int) (int, error) {
+	selectSQL := fmt.Sprintf(`
+		SELECT %s, bgn FROM %s
+		WHERE bgn_data IS NULL
+		AND bgn IS NOT NULL
+		LIMIT $1
+	`, strings.Join(keys, ", "), table)
+
+	conditions := make([]string, 0)
+	for i, key := range keys {
+		conditions = append(conditions, fmt.Sprintf("%s=$%d", key, i+4))
+	}
+	clear := ""
+	if c.clearLegacy {
+		clear = "bgn = NULL, "
+	}
+	updateSQL := fmt.Sprintf(`
+		UPDATE %s SET %sbgn_data = $1, bgn_size = $2, bgn_hash = $3
+		WHERE %s
+		AND bgn_data IS NULL
+	`, table, clear, strings.Join(conditions, "\n\t\tAND "))
+
+	type legacyRow struct {
+		keys []interface{}
+		raw  string
+	}
+	var batch []legacyRow
+	if err := c.do(ctx, func(ctx context.Context) error {
+		batch = make([]legacyRow, 0)
+		rows, err := c.pool.Query(ctx, selectSQL, batchSize)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			values, err := rows.Values()
+			if err != nil {
+				return err
+			}
+			raw, _ := values[len(values)-1].(string)
+			batch = append(batch, legacyRow{keys: values[:len(values)-1], raw: raw})
+		}
+		return rows.Err()
+	}); err != nil {
+		return 0, err
+	}
+
+	for _, row := range batch {
+		encoded, err := encodeBGN(row.raw)
+		if err != nil {
+			return 0, err
+		}
+		args := append([]interface{}{encoded.Data, encoded.Size, encoded.Hash[:]}, row.keys...)
+		if err := c.do(ctx, func(ctx context.Context) error {
+			_, err := c.pool.Exec(ctx, updateSQL, args...)
+			return err
+		}); err != nil {
+			return 0, err
+		}
+	}
+	return len(batch), nil
+}
+
+// do runs fn bounded by the query timeout and retries it on serialization failures
+func (c *CockroachClient) do(ctx context.Context, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, c.queryTimeout)
+	defer cancel()
+
+	for attempt := 0; ; attempt++ {
+		err := fn(ctx)
+		var pgErr *pgconn.PgError
+		if err == nil || !errors.As(err, &pgErr) || pgErr.Code != serializationFailure || attempt >= c.maxRetries {
+			return err
+		}
+		logger.Log.Debug().Err(err).Msgf("retrying cockroach query after serialization failure attempt %d", attempt+1)
+		trace.SpanFromContext(ctx).AddEvent("retry after serialization failure")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryBackoff << attempt):
+		}
+	}
+}
+
+// selectError maps errors returned from a select onto the game store errors
+func selectError(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrGameStoreNotFound
+	}
+	logger.Log.Error().Caller(1).Err(err).Msg("failed to query cockroach")
+	return ErrGameStoreSelect
+}
+
+// legacyBGN returns the bgn written to the text column or nil once it is cleared
+func (c *CockroachClient) legacyBGN(raw string) *string {
+	if c.clearLegacy {
+		return nil
+	}
+	return &raw
+}
+
+// storedBGN returns the bgn from either the legacy text column or the encoded column
+// the text column is preferred while it is written as nodes of older releases may have updated it without bgn_data
+func storedBGN(legacy *string, data []byte) (string, error) {
+	if legacy != nil {
+		return *legacy, nil
+	}
+	if data == nil {
+		return "", ErrGameStoreBGNFormat
+	}
+	return decodeBGN(data)
+}
+
+func scanPlaythrough(row pgx.Row, gameKey, gameID string) (*Playthrough, error) {
+	var (
+		playIndex    int
+		legacy       *string
+		data         []byte
+		winners      []string
+		participants map[string]string
+		completedAt  time.Time
+	)
+
+	if err := row.Scan(&playIndex, &legacy, &data, &winners, &participants, &completedAt); err != nil {
+		return nil, err
+	}
+
+	raw, err := storedBGN(legacy, data)
+	if err != nil {
+		return nil, err
+	}
+	game, err := bgn.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Playthrough{
+		GameKey:      gameKey,
+		GameID:       gameID,
+		PlayIndex:    playIndex,
+		BGN:          game,
+		Winners:      winners,
+		Participants: participants,
+		CompletedAt:  completedAt,
+	}, nil
+}
@@ -1,9 +1,14 @@
 package datastore
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type DatastoreConfig struct {
 	Cockroach CockroachConfig
+	Redis     RedisConfig
+	Cache     CacheConfig
 }
 
 type CockroachConfig struct {
@@ -13,6 +18,27 @@ type CockroachConfig struct {
 	Password string
 	Database string
 	SSLMode  string
+
+	// Pool sizing and connection lifetimes - zero values fall back to defaults
+	MaxConns          int32
+	MinConns          int32
+	MaxConnLifetime   time.Duration
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
+
+	// QueryTimeout bounds each query when the caller's context has no earlier deadline
+	QueryTimeout time.Duration
+
+	// MaxRetries is the number of times a query is retried on a serialization failure
+	MaxRetries int
+
+	// ReencodeBatchSize is the number of legacy rows re-encoded per ReencodeInterval - zero disables re-encoding
+	ReencodeBatchSize int
+	ReencodeInterval  time.Duration
+
+	// ClearLegacyBGN stops writing the text bgn column read by releases from before bgn_data
+	// leave it off until no node of an older release is running as they only read and write the text column
+	ClearLegacyBGN bool
 }
 
 func (c *CockroachConfig) GetURL() string {
@@ -22,3 +48,27 @@ func (c *CockroachConfig) GetURL() string {
 	}
 	return url
 }
+
+type RedisConfig struct {
+	Enabled  bool
+	Addr     string
+	Username string
+	Password string
+	DB       int
+
+	// KeyPrefix is prepended to every key so multiple deployments may share a redis instance
+	KeyPrefix string
+
+	// PoolSize is the max number of connections - zero falls back to the redis client default
+	PoolSize int
+
+	// QueryTimeout bounds each call when the caller's context has no earlier deadline
+	QueryTimeout time.Duration
+}
+
+// CacheConfig configures a redis read-through cache in front of the game store
+// The cache uses the connection details in RedisConfig
+type CacheConfig struct {
+	Enabled bool
+	TTL     time.Duration
+}
@@ -0,0 +1,40 @@
+package datastore
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cursor marks the position of the last game in a page of stored games sorted by updated_at
+type cursor struct {
+	UpdatedAt time.Time
+	GameKey   string
+	GameID    string
+}
+
+func encodeCursor(game *Game) string {
+	raw := strings.Join([]string{strconv.FormatInt(game.UpdatedAt.UnixNano(), 10), game.GameKey, game.GameID}, "\n")
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(raw string) (*cursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, ErrGameStoreCursor
+	}
+	parts := strings.SplitN(string(decoded), "\n", 3)
+	if len(parts) != 3 {
+		return nil, ErrGameStoreCursor
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, ErrGameStoreCursor
+	}
+	return &cursor{
+		UpdatedAt: time.Unix(0, nanos).UTC(),
+		GameKey:   parts[1],
+		GameID:    parts[2],
+	}, nil
+}
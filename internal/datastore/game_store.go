@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/quibbble/go-boardgame/pkg/bgn"
+	"github.com/quibbble/go-quibbble/pkg/logger"
 )
 
 var (
@@ -14,6 +15,15 @@ var (
 	ErrGameStoreConnection = fmt.Errorf("failed to connect to game store")
 	ErrGameStoreSelect     = fmt.Errorf("failed to select from game store")
 	ErrGameStoreInsert     = fmt.Errorf("failed to insert into game store")
+	ErrGameStoreCursor     = fmt.Errorf("invalid game store cursor")
+	ErrGameStoreBGNFormat  = fmt.Errorf("unknown bgn format in game store")
+)
+
+// Results that games can be filtered by when searching
+const (
+	ResultAny        = ""
+	ResultCompleted  = "completed"
+	ResultInProgress = "in-progress"
 )
 
 type Game struct {
@@ -23,17 +33,106 @@ type Game struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	PlayCount int       `json:"play_count"` // multiple games could have been played under the same game id
+
+	// summary fields kept alongside the bgn so that stored games can be searched
+	ActionCount  int               `json:"action_count"`
+	Winners      []string          `json:"winners"`
+	Participants map[string]string `json:"participants"` // mapping from player name to team
+}
+
+// Playthrough is a single completed play of a game archived before the game is reset
+type Playthrough struct {
+	GameKey      string            `json:"game_key"`
+	GameID       string            `json:"game_id"`
+	PlayIndex    int               `json:"play_index"` // matches the play count of the game when the playthrough completed
+	BGN          *bgn.Game         `json:"bgn"`
+	Winners      []string          `json:"winners"`
+	Participants map[string]string `json:"participants"` // mapping from player name to team
+	CompletedAt  time.Time         `json:"completed_at"`
+}
+
+// GameQuery filters and paginates stored games - all fields are optional
+type GameQuery struct {
+	GameKeys      []string
+	UpdatedAfter  *time.Time
+	UpdatedBefore *time.Time
+	MinActions    int
+	Participants  []string // player names that must all have participated
+	Result        string   // one of ResultAny, ResultCompleted or ResultInProgress
+	Winner        string   // team that must be among the winners
+	Ascending     bool     // sort by updated_at ascending instead of descending
+	Limit         int
+	Cursor        string // cursor returned by a previous query to fetch the next page
+}
+
+// GamePage is a page of stored games returned from a query
+// Games do not include their BGN, use GetGame to retrieve it
+type GamePage struct {
+	Games      []*Game
+	NextCursor string // empty if there are no more results
 }
 
 type Stats struct {
 	GamesCreated map[string]int
 	GamesPlayed  map[string]int
+	StoredBytes  map[string]int // size of the encoded bgn payloads per game key
+	RawBytes     map[string]int // size of the bgn payloads per game key before encoding
+}
+
+// PoolStats reports the state of the game store's connection pool
+type PoolStats struct {
+	Enabled           bool
+	MaxConns          int
+	TotalConns        int
+	IdleConns         int
+	AcquiredConns     int
+	AcquireCount      int64
+	AcquireDuration   time.Duration
+	EmptyAcquireCount int64 // number of acquires that had to wait for a connection
 }
 
 // GameStore stores games into long term storage
+// Every call is bounded by the deadline of the passed context
 type GameStore interface {
-	GetGame(gameKey, gameID string) (*Game, error)
-	GetStats(games []string) (*Stats, error)
-	Store(game *Game) error
+	GetGame(ctx context.Context, gameKey, gameID string) (*Game, error)
+	GetStats(ctx context.Context, games []string) (*Stats, error)
+	Store(ctx context.Context, game *Game) error
+	SearchGames(ctx context.Context, query *GameQuery) (*GamePage, error)
+	GetPlaythroughs(ctx context.Context, gameKey, gameID string) ([]*Playthrough, error)
+	GetPlaythrough(ctx context.Context, gameKey, gameID string, playIndex int) (*Playthrough, error)
+	StorePlaythrough(ctx context.Context, playthrough *Playthrough) error
+	PoolStats() *PoolStats
+	Ping(ctx context.Context) error
 	Close(ctx context.Context) error
 }
+
+// NewGameStore creates the game store selected in the config
+// Redis is used if enabled otherwise cockroach, optionally wrapped in a redis cache
+func NewGameStore(config *DatastoreConfig) (GameStore, error) {
+	store, err := newGameStore(config)
+	if err != nil {
+		return nil, err
+	}
+	return NewInstrumentedGameStore(store), nil
+}
+
+func newGameStore(config *DatastoreConfig) (GameStore, error) {
+	if config.Redis.Enabled {
+		if config.Cache.Enabled {
+			logger.Log.Warn().Msg("cache is ignored as redis is already the game store")
+		}
+		return NewRedisClient(&config.Redis)
+	}
+	store, err := NewCockroachClient(&config.Cockroach)
+	if err != nil {
+		return nil, err
+	}
+	if !config.Cache.Enabled || !config.Cockroach.Enabled {
+		return store, nil
+	}
+	cache, err := NewRedisClient(&config.Redis)
+	if err != nil {
+		return nil, err
+	}
+	return NewCachedGameStore(store, cache, config.Cache.TTL), nil
+}
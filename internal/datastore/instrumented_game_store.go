@@ -0,0 +1,90 @@
+package datastore
+
+import (
+	"context"
+	"time"
+
+	"github.com/quibbble/go-quibbble/internal/metrics"
+	"github.com/quibbble/go-quibbble/pkg/tracing"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// InstrumentedGameStore records the latency, errors and a span for every call to the wrapped game store
+type InstrumentedGameStore struct {
+	store GameStore
+}
+
+func NewInstrumentedGameStore(store GameStore) *InstrumentedGameStore {
+	return &InstrumentedGameStore{
+		store: store,
+	}
+}
+
+func (s *InstrumentedGameStore) GetGame(ctx context.Context, gameKey, gameID string) (*Game, error) {
+	ctx, end := instrument(ctx, "GetGame")
+	game, err := s.store.GetGame(ctx, gameKey, gameID)
+	return game, end(err)
+}
+
+func (s *InstrumentedGameStore) GetStats(ctx context.Context, games []string) (*Stats, error) {
+	ctx, end := instrument(ctx, "GetStats")
+	stats, err := s.store.GetStats(ctx, games)
+	return stats, end(err)
+}
+
+func (s *InstrumentedGameStore) Store(ctx context.Context, game *Game) error {
+	ctx, end := instrument(ctx, "Store")
+	return end(s.store.Store(ctx, game))
+}
+
+func (s *InstrumentedGameStore) SearchGames(ctx context.Context, query *GameQuery) (*GamePage, error) {
+	ctx, end := instrument(ctx, "SearchGames")
+	page, err := s.store.SearchGames(ctx, query)
+	return page, end(err)
+}
+
+func (s *InstrumentedGameStore) GetPlaythroughs(ctx context.Context, gameKey, gameID string) ([]*Playthrough, error) {
+	ctx, end := instrument(ctx, "GetPlaythroughs")
+	playthroughs, err := s.store.GetPlaythroughs(ctx, gameKey, gameID)
+	return playthroughs, end(err)
+}
+
+func (s *InstrumentedGameStore) GetPlaythrough(ctx context.Context, gameKey, gameID string, playIndex int) (*Playthrough, error) {
+	ctx, end := instrument(ctx, "GetPlaythrough")
+	playthrough, err := s.store.GetPlaythrough(ctx, gameKey, gameID, playIndex)
+	return playthrough, end(err)
+}
+
+func (s *InstrumentedGameStore) StorePlaythrough(ctx context.Context, playthrough *Playthrough) error {
+	ctx, end := instrument(ctx, "StorePlaythrough")
+	return end(s.store.StorePlaythrough(ctx, playthrough))
+}
+
+func (s *InstrumentedGameStore) Ping(ctx context.Context) error {
+	ctx, end := instrument(ctx, "Ping")
+	return end(s.store.Ping(ctx))
+}
+
+func (s *InstrumentedGameStore) PoolStats() *PoolStats {
+	return s.store.PoolStats()
+}
+
+func (s *InstrumentedGameStore) Close(ctx context.Context) error {
+	return s.store.Close(ctx)
+}
+
+// instrument starts a span and timer for the call and returns a function to end both
+func instrument(ctx context.Context, method string) (context.Context, func(err error) error) {
+	start := time.Now()
+	ctx, span := tracing.Tracer.Start(ctx, "datastore."+method)
+	return ctx, func(err error) error {
+		metrics.DatastoreDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+		// missing games and a disabled store are expected so are not counted as errors
+		if err != nil && err != ErrGameStoreNotFound && err != ErrGameStoreNotEnabled {
+			metrics.DatastoreErrors.WithLabelValues(method).Inc()
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+		return err
+	}
+}
@@ -0,0 +1,127 @@
+package datastore
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// MemoryGameStore is an in process stand-in for a game store that keeps games and playthroughs in memory
+// it does not support searching and counts the games read from it so callers can check what was cached
+type MemoryGameStore struct {
+	mu           sync.Mutex
+	games        map[string]*Game
+	playthroughs map[string]map[int]*Playthrough
+	reads        int
+}
+
+func NewMemoryGameStore() *MemoryGameStore {
+	return &MemoryGameStore{
+		games:        make(map[string]*Game),
+		playthroughs: make(map[string]map[int]*Playthrough),
+	}
+}
+
+func (s *MemoryGameStore) GetGame(_ context.Context, gameKey, gameID string) (*Game, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reads++
+	game, ok := s.games[gameKey+"/"+gameID]
+	if !ok {
+		return nil, ErrGameStoreNotFound
+	}
+	copied := *game
+	return &copied, nil
+}
+
+func (s *MemoryGameStore) GetStats(_ context.Context, games []string) (*Stats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := &Stats{
+		GamesCreated: make(map[string]int),
+		GamesPlayed:  make(map[string]int),
+		StoredBytes:  make(map[string]int),
+		RawBytes:     make(map[string]int),
+	}
+	for _, gameKey := range games {
+		stats.GamesCreated[gameKey] = 0
+		stats.GamesPlayed[gameKey] = 0
+	}
+	for _, game := range s.games {
+		if _, ok := stats.GamesCreated[game.GameKey]; !ok {
+			continue
+		}
+		stats.GamesCreated[game.GameKey]++
+		stats.GamesPlayed[game.GameKey] += game.PlayCount
+		size := len(game.BGN.String())
+		stats.StoredBytes[game.GameKey] += size
+		stats.RawBytes[game.GameKey] += size
+	}
+	return stats, nil
+}
+
+func (s *MemoryGameStore) Store(_ context.Context, game *Game) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *game
+	s.games[game.GameKey+"/"+game.GameID] = &copied
+	return nil
+}
+
+func (s *MemoryGameStore) SearchGames(context.Context, *GameQuery) (*GamePage, error) {
+	return nil, ErrGameStoreNotEnabled
+}
+
+func (s *MemoryGameStore) GetPlaythroughs(_ context.Context, gameKey, gameID string) ([]*Playthrough, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	playthroughs := make([]*Playthrough, 0)
+	for _, playthrough := range s.playthroughs[gameKey+"/"+gameID] {
+		copied := *playthrough
+		playthroughs = append(playthroughs, &copied)
+	}
+	sort.Slice(playthroughs, func(i, j int) bool { return playthroughs[i].PlayIndex < playthroughs[j].PlayIndex })
+	return playthroughs, nil
+}
+
+func (s *MemoryGameStore) GetPlaythrough(_ context.Context, gameKey, gameID string, playIndex int) (*Playthrough, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	playthrough, ok := s.playthroughs[gameKey+"/"+gameID][playIndex]
+	if !ok {
+		return nil, ErrGameStoreNotFound
+	}
+	copied := *playthrough
+	return &copied, nil
+}
+
+func (s *MemoryGameStore) StorePlaythrough(_ context.Context, playthrough *Playthrough) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := playthrough.GameKey + "/" + playthrough.GameID
+	if s.playthroughs[key] == nil {
+		s.playthroughs[key] = make(map[int]*Playthrough)
+	}
+	copied := *playthrough
+	s.playthroughs[key][playthrough.PlayIndex] = &copied
+	return nil
+}
+
+func (s *MemoryGameStore) PoolStats() *PoolStats {
+	return &PoolStats{}
+}
+
+func (s *MemoryGameStore) Ping(context.Context) error {
+	return nil
+}
+
+func (s *MemoryGameStore) Close(context.Context) error {
+	return nil
+}
+
+// Reads returns the number of games read from the store
+func (s *MemoryGameStore) Reads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reads
+}
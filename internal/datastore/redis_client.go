@@ -0,0 +1,527 @@
+package datastore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/quibbble/go-boardgame/pkg/bgn"
+	"github.com/quibbble/go-quibbble/pkg/logger"
+	"github.com/redis/go-redis/v9"
+)
+
+const redisSearchBatch = 100
+
+// storeGameScript upserts a game hash, indexes it by updated_at and keeps the stats counters in sync
+// KEYS: game hash, games created counter, games played counter, stored bytes counter, raw bytes counter, updated_at index
+// ARGV: game key, play count, index score, index member, ttl in ms, stored size, raw size, field value pairs...
+var storeGameScript = redis.NewScript(`
+local existed = redis.call('EXISTS', KEYS[1])
+local old = redis.call('HMGET', KEYS[1], 'play_count', 'stored_size', 'bgn_size')
+redis.call('HSET', KEYS[1], 'stored_size', ARGV[6], unpack(ARGV, 8))
+if tonumber(ARGV[5]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[5])
+	return 0
+end
+if existed == 0 then
+	redis.call('HINCRBY', KEYS[2], ARGV[1], 1)
+end
+redis.call('HINCRBY', KEYS[3], ARGV[1], tonumber(ARGV[2]) - tonumber(old[1] or '0'))
+redis.call('HINCRBY', KEYS[4], ARGV[1], tonumber(ARGV[6]) - tonumber(old[2] or '0'))
+redis.call('HINCRBY', KEYS[5], ARGV[1], tonumber(ARGV[7]) - tonumber(old[3] or '0'))
+redis.call('ZADD', KEYS[6], ARGV[3], ARGV[4])
+return 0
+`)
+
+// RedisClient stores games in redis hashes with stats kept in counters
+// With a ttl it does not maintain stats or indexes and acts as a cache in front of another game store
+type RedisClient struct {
+	client       *redis.Client
+	prefix       string
+	poolSize     int
+	queryTimeout time.Duration
+}
+
+func NewRedisClient(config *RedisConfig) (*RedisClient, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     config.Addr,
+		Username: config.Username,
+		Password: config.Password,
+		DB:       config.DB,
+		PoolSize: config.PoolSize,
+	})
+
+	queryTimeout := defaultQueryTimeout
+	if config.QueryTimeout > 0 {
+		queryTimeout = config.QueryTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to connect to redis")
+		return nil, ErrGameStoreConnection
+	}
+
+	return &RedisClient{
+		client:       client,
+		prefix:       config.KeyPrefix,
+		poolSize:     client.Options().PoolSize,
+		queryTimeout: queryTimeout,
+	}, nil
+}
+
+func (c *RedisClient) GetGame(ctx context.Context, gameKey, gameID string) (*Game, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.queryTimeout)
+	defer cancel()
+
+	fields, err := c.client.HGetAll(ctx, c.gameKey(gameKey, gameID)).Result()
+	if err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to query redis")
+		return nil, ErrGameStoreSelect
+	}
+	if len(fields) == 0 {
+		return nil, ErrGameStoreNotFound
+	}
+
+	game, err := decodeGame(gameKey, gameID, fields)
+	if err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to decode redis game")
+		return nil, ErrGameStoreSelect
+	}
+	raw := fields["bgn"]
+	if data, ok := fields["bgn_data"]; ok {
+		if raw, err = decodeBGN([]byte(data)); err != nil {
+			logger.Log.Error().Caller().Err(err).Msg("failed to decode redis bgn")
+			return nil, ErrGameStoreSelect
+		}
+	}
+	game.BGN, err = bgn.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Log.Debug().Msgf("found '%s' with id '%s' in game store", gameKey, gameID)
+
+	return game, nil
+}
+
+func (c *RedisClient) GetStats(ctx context.Context, games []string) (*Stats, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.queryTimeout)
+	defer cancel()
+
+	pipe := c.client.Pipeline()
+	created := pipe.HGetAll(ctx, c.key("stats", "created"))
+	played := pipe.HGetAll(ctx, c.key("stats", "played"))
+	storedBytes := pipe.HGetAll(ctx, c.key("stats", "stored_bytes"))
+	rawBytes := pipe.HGetAll(ctx, c.key("stats", "raw_bytes"))
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to query redis")
+		return nil, ErrGameStoreSelect
+	}
+
+	stats := &Stats{
+		GamesCreated: make(map[string]int),
+		GamesPlayed:  make(map[string]int),
+		StoredBytes:  make(map[string]int),
+		RawBytes:     make(map[string]int),
+	}
+	counters := map[*redis.MapStringStringCmd]map[string]int{
+		created:     stats.GamesCreated,
+		played:      stats.GamesPlayed,
+		storedBytes: stats.StoredBytes,
+		rawBytes:    stats.RawBytes,
+	}
+	for cmd, counter := range counters {
+		for _, game := range games {
+			counter[game] = 0
+		}
+		for gameKey, count := range cmd.Val() {
+			counter[gameKey], _ = strconv.Atoi(count)
+		}
+	}
+
+	return stats, nil
+}
+
+func (c *RedisClient) Store(ctx context.Context, game *Game) error {
+	if err := c.store(ctx, game, 0); err != nil {
+		return err
+	}
+	logger.Log.Debug().Msgf("stored '%s' with id '%s' in game store", game.GameKey, game.GameID)
+	return nil
+}
+
+func (c *RedisClient) store(ctx context.Context, game *Game, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, c.queryTimeout)
+	defer cancel()
+
+	encoded, err := encodeBGN(game.BGN.String())
+	if err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to encode bgn")
+		return ErrGameStoreInsert
+	}
+	fields, err := encodeGame(game, encoded)
+	if err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to encode redis game")
+		return ErrGameStoreInsert
+	}
+
+	keys := []string{
+		c.gameKey(game.GameKey, game.GameID),
+		c.key("stats", "created"),
+		c.key("stats", "played"),
+		c.key("stats", "stored_bytes"),
+		c.key("stats", "raw_bytes"),
+		c.key("index", "updated"),
+	}
+	args := []interface{}{game.GameKey, game.PlayCount, game.UpdatedAt.UnixMilli(), indexMember(game.GameKey, game.GameID), ttl.Milliseconds(),
+		len(encoded.Data), encoded.Size}
+	args = append(args, fields...)
+
+	if err := storeGameScript.Run(ctx, c.client, keys, args...).Err(); err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to exec on redis")
+		return ErrGameStoreInsert
+	}
+	return nil
+}
+
+func (c *RedisClient) SearchGames(ctx context.Context, query *GameQuery) (*GamePage, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.queryTimeout)
+	defer cancel()
+
+	switch query.Result {
+	case ResultAny, ResultCompleted, ResultInProgress:
+	default:
+		return nil, fmt.Errorf("invalid result '%s'", query.Result)
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	} else if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	// the index is ordered by updated_at in ms then by member which sorts the same as (game_key, game_id)
+	var after *cursor
+	if query.Cursor != "" {
+		var err error
+		if after, err = decodeCursor(query.Cursor); err != nil {
+			return nil, err
+		}
+	}
+	min, max := "-inf", "+inf"
+	if query.UpdatedAfter != nil {
+		min = strconv.FormatInt(query.UpdatedAfter.UnixMilli(), 10)
+	}
+	if query.UpdatedBefore != nil {
+		max = "(" + strconv.FormatInt(query.UpdatedBefore.UnixMilli(), 10)
+	}
+	// start the scan at the cursor rather than skipping every earlier page
+	if after != nil {
+		score := after.UpdatedAt.UnixMilli()
+		if query.Ascending && (query.UpdatedAfter == nil || score > query.UpdatedAfter.UnixMilli()) {
+			min = strconv.FormatInt(score, 10)
+		} else if !query.Ascending && (query.UpdatedBefore == nil || score < query.UpdatedBefore.UnixMilli()) {
+			max = strconv.FormatInt(score, 10)
+		}
+	}
+
+	games := make([]*Game, 0)
+	for offset := int64(0); len(games) <= limit; offset += redisSearchBatch {
+		rangeBy := &redis.ZRangeBy{Min: min, Max: max, Offset: offset, Count: redisSearchBatch}
+		var (
+			members []redis.Z
+			err     error
+		)
+		if query.Ascending {
+			members, err = c.client.ZRangeByScoreWithScores(ctx, c.key("index", "updated"), rangeBy).Result()
+		} else {
+			members, err = c.client.ZRevRangeByScoreWithScores(ctx, c.key("index", "updated"), rangeBy).Result()
+		}
+		if err != nil {
+			logger.Log.Error().Caller().Err(err).Msg("failed to query redis")
+			return nil, ErrGameStoreSelect
+		}
+		if len(members) == 0 {
+			break
+		}
+
+		pipe := c.client.Pipeline()
+		results := make([]*redis.MapStringStringCmd, len(members))
+		for i, member := range members {
+			gameKey, gameID := splitIndexMember(member.Member.(string))
+			results[i] = pipe.HGetAll(ctx, c.gameKey(gameKey, gameID))
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			logger.Log.Error().Caller().Err(err).Msg("failed to query redis")
+			return nil, ErrGameStoreSelect
+		}
+
+		for i, member := range members {
+			if after != nil && !pastCursor(after, int64(member.Score), member.Member.(string), query.Ascending) {
+				continue
+			}
+			gameKey, gameID := splitIndexMember(member.Member.(string))
+			fields := results[i].Val()
+			if len(fields) == 0 {
+				continue
+			}
+			game, err := decodeGame(gameKey, gameID, fields)
+			if err != nil {
+				logger.Log.Error().Caller().Err(err).Msg("failed to decode redis game")
+				return nil, ErrGameStoreSelect
+			}
+			if matchesQuery(game, query) {
+				games = append(games, game)
+				if len(games) > limit {
+					break
+				}
+			}
+		}
+	}
+
+	page := &GamePage{
+		Games: games,
+	}
+	if len(games) > limit {
+		page.Games = games[:limit]
+		page.NextCursor = encodeCursor(games[limit-1])
+	}
+	return page, nil
+}
+
+func (c *RedisClient) GetPlaythroughs(ctx context.Context, gameKey, gameID string) ([]*Playthrough, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.queryTimeout)
+	defer cancel()
+
+	fields, err := c.client.HGetAll(ctx, c.key("playthroughs", gameKey, gameID)).Result()
+	if err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to query redis")
+		return nil, ErrGameStoreSelect
+	}
+
+	playthroughs := make([]*Playthrough, 0)
+	for _, raw := range fields {
+		playthrough, err := decodePlaythrough(raw)
+		if err != nil {
+			logger.Log.Error().Caller().Err(err).Msg("failed to decode redis playthrough")
+			return nil, ErrGameStoreSelect
+		}
+		playthroughs = append(playthroughs, playthrough)
+	}
+	sort.Slice(playthroughs, func(i, j int) bool {
+		return playthroughs[i].PlayIndex < playthroughs[j].PlayIndex
+	})
+
+	return playthroughs, nil
+}
+
+func (c *RedisClient) GetPlaythrough(ctx context.Context, gameKey, gameID string, playIndex int) (*Playthrough, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.queryTimeout)
+	defer cancel()
+
+	raw, err := c.client.HGet(ctx, c.key("playthroughs", gameKey, gameID), strconv.Itoa(playIndex)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrGameStoreNotFound
+	} else if err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to query redis")
+		return nil, ErrGameStoreSelect
+	}
+
+	playthrough, err := decodePlaythrough(raw)
+	if err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to decode redis playthrough")
+		return nil, ErrGameStoreSelect
+	}
+	return playthrough, nil
+}
+
+func (c *RedisClient) StorePlaythrough(ctx context.Context, playthrough *Playthrough) error {
+	ctx, cancel := context.WithTimeout(ctx, c.queryTimeout)
+	defer cancel()
+
+	raw, err := json.Marshal(&redisPlaythrough{
+		Playthrough: playthrough,
+		BGN:         playthrough.BGN.String(),
+	})
+	if err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to encode redis playthrough")
+		return ErrGameStoreInsert
+	}
+
+	key := c.key("playthroughs", playthrough.GameKey, playthrough.GameID)
+	if err := c.client.HSet(ctx, key, strconv.Itoa(playthrough.PlayIndex), raw).Err(); err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to exec on redis")
+		return ErrGameStoreInsert
+	}
+
+	logger.Log.Debug().Msgf("stored playthrough %d of '%s' with id '%s' in game store", playthrough.PlayIndex, playthrough.GameKey, playthrough.GameID)
+
+	return nil
+}
+
+func (c *RedisClient) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.queryTimeout)
+	defer cancel()
+	return c.client.Ping(ctx).Err()
+}
+
+func (c *RedisClient) PoolStats() *PoolStats {
+	stats := c.client.PoolStats()
+	return &PoolStats{
+		Enabled:           true,
+		MaxConns:          c.poolSize,
+		TotalConns:        int(stats.TotalConns),
+		IdleConns:         int(stats.IdleConns),
+		AcquiredConns:     int(stats.TotalConns - stats.IdleConns),
+		AcquireCount:      int64(stats.Hits + stats.Misses),
+		EmptyAcquireCount: int64(stats.Misses),
+	}
+}
+
+func (c *RedisClient) Close(ctx context.Context) error {
+	return c.client.Close()
+}
+
+func (c *RedisClient) key(parts ...string) string {
+	return c.prefix + strings.Join(parts, ":")
+}
+
+func (c *RedisClient) gameKey(gameKey, gameID string) string {
+	return c.key("game", gameKey, gameID)
+}
+
+// redisPlaythrough is the json encoding of a playthrough with the bgn stored as text
+type redisPlaythrough struct {
+	*Playthrough
+	BGN string `json:"bgn"`
+}
+
+func decodePlaythrough(raw string) (*Playthrough, error) {
+	var stored redisPlaythrough
+	if err := json.Unmarshal([]byte(raw), &stored); err != nil {
+		return nil, err
+	}
+	game, err := bgn.Parse(stored.BGN)
+	if err != nil {
+		return nil, err
+	}
+	stored.Playthrough.BGN = game
+	return stored.Playthrough, nil
+}
+
+func encodeGame(game *Game, encoded *encodedBGN) ([]interface{}, error) {
+	winners, err := json.Marshal(game.Winners)
+	if err != nil {
+		return nil, err
+	}
+	participants, err := json.Marshal(game.Participants)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{
+		"bgn_data", encoded.Data,
+		"bgn_size", encoded.Size,
+		"created_at", game.CreatedAt.Format(time.RFC3339Nano),
+		"updated_at", game.UpdatedAt.Format(time.RFC3339Nano),
+		"play_count", game.PlayCount,
+		"action_count", len(game.BGN.Actions),
+		"winners", winners,
+		"participants", participants,
+	}, nil
+}
+
+// decodeGame decodes everything but the bgn which is only parsed when needed
+func decodeGame(gameKey, gameID string, fields map[string]string) (*Game, error) {
+	game := &Game{
+		GameKey: gameKey,
+		GameID:  gameID,
+	}
+	var err error
+	if game.CreatedAt, err = time.Parse(time.RFC3339Nano, fields["created_at"]); err != nil {
+		return nil, err
+	}
+	if game.UpdatedAt, err = time.Parse(time.RFC3339Nano, fields["updated_at"]); err != nil {
+		return nil, err
+	}
+	if game.PlayCount, err = strconv.Atoi(fields["play_count"]); err != nil {
+		return nil, err
+	}
+	if game.ActionCount, err = strconv.Atoi(fields["action_count"]); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(fields["winners"]), &game.Winners); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(fields["participants"]), &game.Participants); err != nil {
+		return nil, err
+	}
+	return game, nil
+}
+
+func indexMember(gameKey, gameID string) string {
+	return gameKey + "\n" + gameID
+}
+
+func splitIndexMember(member string) (string, string) {
+	parts := strings.SplitN(member, "\n", 2)
+	if len(parts) != 2 {
+		return member, ""
+	}
+	return parts[0], parts[1]
+}
+
+// pastCursor reports whether the index entry comes strictly after the cursor in the search order
+func pastCursor(after *cursor, score int64, member string, ascending bool) bool {
+	cursorScore, cursorMember := after.UpdatedAt.UnixMilli(), indexMember(after.GameKey, after.GameID)
+	if score == cursorScore {
+		if ascending {
+			return member > cursorMember
+		}
+		return member < cursorMember
+	}
+	if ascending {
+		return score > cursorScore
+	}
+	return score < cursorScore
+}
+
+func matchesQuery(game *Game, query *GameQuery) bool {
+	if len(query.GameKeys) > 0 && !containsString(query.GameKeys, game.GameKey) {
+		return false
+	}
+	if game.ActionCount < query.MinActions {
+		return false
+	}
+	for _, participant := range query.Participants {
+		if _, ok := game.Participants[participant]; !ok {
+			return false
+		}
+	}
+	if query.Result == ResultCompleted && len(game.Winners) == 0 {
+		return false
+	}
+	if query.Result == ResultInProgress && len(game.Winners) > 0 {
+		return false
+	}
+	if query.Winner != "" && !containsString(game.Winners, query.Winner) {
+		return false
+	}
+	return true
+}
+
+func containsString(items []string, item string) bool {
+	for _, it := range items {
+		if it == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,259 @@
+package datastore
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/quibbble/go-boardgame/pkg/bgn"
+)
+
+const testBGN = `[Teams "red, blue"][Game "Tic-Tac-Toe"]0m&0.0 1m&0.1`
+
+func newTestRedisClient(t *testing.T) (*RedisClient, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client, err := NewRedisClient(&RedisConfig{
+		Addr:      mr.Addr(),
+		KeyPrefix: "test:",
+	})
+	if err != nil {
+		t.Fatalf("failed to create redis client: %s", err)
+	}
+	t.Cleanup(func() { _ = client.Close(context.Background()) })
+	return client, mr
+}
+
+func newTestGame(t *testing.T, gameKey, gameID string, updatedAt time.Time) *Game {
+	t.Helper()
+	game, err := bgn.Parse(testBGN)
+	if err != nil {
+		t.Fatalf("failed to parse bgn: %s", err)
+	}
+	game.Tags["Game"] = gameKey
+	return &Game{
+		GameKey:      gameKey,
+		GameID:       gameID,
+		BGN:          game,
+		CreatedAt:    updatedAt.Add(-time.Hour),
+		UpdatedAt:    updatedAt,
+		PlayCount:    1,
+		ActionCount:  len(game.Actions),
+		Winners:      []string{},
+		Participants: map[string]string{"wry-gem": "red"},
+	}
+}
+
+func assertGame(t *testing.T, want, got *Game) {
+	t.Helper()
+	if got.GameKey != want.GameKey || got.GameID != want.GameID {
+		t.Fatalf("got game '%s' '%s', want '%s' '%s'", got.GameKey, got.GameID, want.GameKey, want.GameID)
+	}
+	if got.BGN != nil && want.BGN != nil && !equalBGN(got.BGN, want.BGN) {
+		t.Errorf("got bgn %q, want %q", got.BGN.String(), want.BGN.String())
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) || !got.UpdatedAt.Equal(want.UpdatedAt) {
+		t.Errorf("got times %s %s, want %s %s", got.CreatedAt, got.UpdatedAt, want.CreatedAt, want.UpdatedAt)
+	}
+	if got.PlayCount != want.PlayCount || got.ActionCount != want.ActionCount {
+		t.Errorf("got play count %d and action count %d, want %d and %d", got.PlayCount, got.ActionCount, want.PlayCount, want.ActionCount)
+	}
+	if !reflect.DeepEqual(got.Winners, want.Winners) || !reflect.DeepEqual(got.Participants, want.Participants) {
+		t.Errorf("got winners %v and participants %v, want %v and %v", got.Winners, got.Participants, want.Winners, want.Participants)
+	}
+}
+
+// equalBGN compares games ignoring the order tags are written in
+func equalBGN(a, b *bgn.Game) bool {
+	return reflect.DeepEqual(a.Tags, b.Tags) && reflect.DeepEqual(a.Actions, b.Actions)
+}
+
+func TestRedisClientStoreAndGetGame(t *testing.T) {
+	client, _ := newTestRedisClient(t)
+	ctx := context.Background()
+
+	if _, err := client.GetGame(ctx, "Tic-Tac-Toe", "missing"); err != ErrGameStoreNotFound {
+		t.Fatalf("got %v, want %v", err, ErrGameStoreNotFound)
+	}
+
+	game := newTestGame(t, "Tic-Tac-Toe", "example", time.Now().UTC())
+	if err := client.Store(ctx, game); err != nil {
+		t.Fatalf("failed to store game: %s", err)
+	}
+	got, err := client.GetGame(ctx, "Tic-Tac-Toe", "example")
+	if err != nil {
+		t.Fatalf("failed to get game: %s", err)
+	}
+	assertGame(t, game, got)
+
+	game.PlayCount = 2
+	game.Winners = []string{"red"}
+	game.UpdatedAt = game.UpdatedAt.Add(time.Minute)
+	if err := client.Store(ctx, game); err != nil {
+		t.Fatalf("failed to store game: %s", err)
+	}
+	got, err = client.GetGame(ctx, "Tic-Tac-Toe", "example")
+	if err != nil {
+		t.Fatalf("failed to get game: %s", err)
+	}
+	assertGame(t, game, got)
+}
+
+func TestRedisClientGetStats(t *testing.T) {
+	client, _ := newTestRedisClient(t)
+	ctx := context.Background()
+
+	game := newTestGame(t, "Tic-Tac-Toe", "example", time.Now().UTC())
+	if err := client.Store(ctx, game); err != nil {
+		t.Fatalf("failed to store game: %s", err)
+	}
+	// storing the same game again only moves the counters by the difference
+	game.PlayCount = 3
+	if err := client.Store(ctx, game); err != nil {
+		t.Fatalf("failed to store game: %s", err)
+	}
+	if err := client.Store(ctx, newTestGame(t, "Connect4", "other", time.Now().UTC())); err != nil {
+		t.Fatalf("failed to store game: %s", err)
+	}
+
+	stats, err := client.GetStats(ctx, []string{"Tic-Tac-Toe", "Connect4", "Tsuro"})
+	if err != nil {
+		t.Fatalf("failed to get stats: %s", err)
+	}
+	if want := map[string]int{"Tic-Tac-Toe": 1, "Connect4": 1, "Tsuro": 0}; !reflect.DeepEqual(stats.GamesCreated, want) {
+		t.Errorf("got games created %v, want %v", stats.GamesCreated, want)
+	}
+	if want := map[string]int{"Tic-Tac-Toe": 3, "Connect4": 1, "Tsuro": 0}; !reflect.DeepEqual(stats.GamesPlayed, want) {
+		t.Errorf("got games played %v, want %v", stats.GamesPlayed, want)
+	}
+	if stats.RawBytes["Tic-Tac-Toe"] != len(game.BGN.String()) {
+		t.Errorf("got raw bytes %d, want %d", stats.RawBytes["Tic-Tac-Toe"], len(game.BGN.String()))
+	}
+	if stats.StoredBytes["Tic-Tac-Toe"] <= 0 {
+		t.Errorf("got stored bytes %d, want more than zero", stats.StoredBytes["Tic-Tac-Toe"])
+	}
+}
+
+func TestRedisClientSearchGames(t *testing.T) {
+	client, _ := newTestRedisClient(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	games := []*Game{
+		newTestGame(t, "Tic-Tac-Toe", "a", now.Add(-3*time.Minute)),
+		newTestGame(t, "Tic-Tac-Toe", "b", now.Add(-2*time.Minute)),
+		newTestGame(t, "Connect4", "c", now.Add(-time.Minute)),
+	}
+	games[1].Winners = []string{"red"}
+	for _, game := range games {
+		if err := client.Store(ctx, game); err != nil {
+			t.Fatalf("failed to store game: %s", err)
+		}
+	}
+
+	first, err := client.SearchGames(ctx, &GameQuery{Result: ResultAny, Limit: 2})
+	if err != nil {
+		t.Fatalf("failed to search games: %s", err)
+	}
+	if len(first.Games) != 2 || first.NextCursor == "" {
+		t.Fatalf("got %d games and cursor %q, want 2 games and a cursor", len(first.Games), first.NextCursor)
+	}
+	assertGame(t, games[2], first.Games[0])
+	assertGame(t, games[1], first.Games[1])
+
+	second, err := client.SearchGames(ctx, &GameQuery{Result: ResultAny, Limit: 2, Cursor: first.NextCursor})
+	if err != nil {
+		t.Fatalf("failed to search games: %s", err)
+	}
+	if len(second.Games) != 1 || second.NextCursor != "" {
+		t.Fatalf("got %d games and cursor %q, want 1 game and no cursor", len(second.Games), second.NextCursor)
+	}
+	assertGame(t, games[0], second.Games[0])
+
+	completed, err := client.SearchGames(ctx, &GameQuery{Result: ResultCompleted, GameKeys: []string{"Tic-Tac-Toe"}})
+	if err != nil {
+		t.Fatalf("failed to search games: %s", err)
+	}
+	if len(completed.Games) != 1 {
+		t.Fatalf("got %d completed games, want 1", len(completed.Games))
+	}
+	assertGame(t, games[1], completed.Games[0])
+
+	if _, err := client.SearchGames(ctx, &GameQuery{Result: "unknown"}); err == nil {
+		t.Errorf("got no error searching with an unknown result")
+	}
+}
+
+func TestRedisClientPlaythroughs(t *testing.T) {
+	client, _ := newTestRedisClient(t)
+	ctx := context.Background()
+
+	game := newTestGame(t, "Tic-Tac-Toe", "example", time.Now().UTC())
+	for _, playIndex := range []int{2, 1} {
+		if err := client.StorePlaythrough(ctx, &Playthrough{
+			GameKey:      game.GameKey,
+			GameID:       game.GameID,
+			PlayIndex:    playIndex,
+			BGN:          game.BGN,
+			Winners:      []string{"red"},
+			Participants: game.Participants,
+			CompletedAt:  game.UpdatedAt,
+		}); err != nil {
+			t.Fatalf("failed to store playthrough: %s", err)
+		}
+	}
+
+	playthroughs, err := client.GetPlaythroughs(ctx, game.GameKey, game.GameID)
+	if err != nil {
+		t.Fatalf("failed to get playthroughs: %s", err)
+	}
+	if len(playthroughs) != 2 || playthroughs[0].PlayIndex != 1 || playthroughs[1].PlayIndex != 2 {
+		t.Fatalf("got %d playthroughs, want play indexes 1 and 2 in order", len(playthroughs))
+	}
+	playthrough, err := client.GetPlaythrough(ctx, game.GameKey, game.GameID, 2)
+	if err != nil {
+		t.Fatalf("failed to get playthrough: %s", err)
+	}
+	if !equalBGN(playthrough.BGN, game.BGN) {
+		t.Errorf("got bgn %q, want %q", playthrough.BGN.String(), game.BGN.String())
+	}
+	if _, err := client.GetPlaythrough(ctx, game.GameKey, game.GameID, 3); err != ErrGameStoreNotFound {
+		t.Errorf("got %v, want %v", err, ErrGameStoreNotFound)
+	}
+}
+
+func TestRedisClientStoreWithTTL(t *testing.T) {
+	client, mr := newTestRedisClient(t)
+	ctx := context.Background()
+
+	game := newTestGame(t, "Tic-Tac-Toe", "example", time.Now().UTC())
+	if err := client.store(ctx, game, time.Minute); err != nil {
+		t.Fatalf("failed to store game: %s", err)
+	}
+	if ttl := mr.TTL(client.gameKey(game.GameKey, game.GameID)); ttl != time.Minute {
+		t.Errorf("got ttl %s, want %s", ttl, time.Minute)
+	}
+
+	// cached games are not counted or indexed as they are stored elsewhere
+	stats, err := client.GetStats(ctx, []string{game.GameKey})
+	if err != nil {
+		t.Fatalf("failed to get stats: %s", err)
+	}
+	if stats.GamesCreated[game.GameKey] != 0 {
+		t.Errorf("got %d games created, want 0", stats.GamesCreated[game.GameKey])
+	}
+	page, err := client.SearchGames(ctx, &GameQuery{Result: ResultAny})
+	if err != nil {
+		t.Fatalf("failed to search games: %s", err)
+	}
+	if len(page.Games) != 0 {
+		t.Errorf("got %d games, want 0", len(page.Games))
+	}
+
+	mr.FastForward(time.Minute + time.Second)
+	if _, err := client.GetGame(ctx, game.GameKey, game.GameID); err != ErrGameStoreNotFound {
+		t.Errorf("got %v, want %v", err, ErrGameStoreNotFound)
+	}
+}
@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "quibbble"
+
+var (
+	// Actions counts messages processed by game servers by kind i.e. a server action name or Game for board game actions
+	Actions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "actions_total",
+		Help:      "Number of player messages processed by game servers.",
+	}, []string{"game_key", "kind"})
+
+	ActionErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "action_errors_total",
+		Help:      "Number of player messages answered with an error.",
+	}, []string{"game_key"})
+
+	ActionDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "action_duration_seconds",
+		Help:      "Time taken by game servers to process a player message including sending the results.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"game_key", "kind"})
+
+	RandomActions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "random_actions_total",
+		Help:      "Number of random actions performed after a turn timer ran out.",
+	}, []string{"game_key"})
+
+	// Connections counts players and watchers connected to game servers by transport i.e. websocket, sse or grpc
+	Connections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "connections_total",
+		Help:      "Number of players connected to game servers.",
+	}, []string{"game_key", "transport"})
+
+	Disconnections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "disconnections_total",
+		Help:      "Number of players disconnected from game servers.",
+	}, []string{"game_key", "transport"})
+
+	// DroppedMessages counts outbound messages that could not be queued, each of which disconnects the player
+	DroppedMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_dropped_messages_total",
+		Help:      "Number of outbound messages dropped because a player lagged for too long.",
+	}, []string{"game_key", "type"})
+
+	// CoalescedMessages counts queued outbound messages dropped because a newer message superseded them
+	CoalescedMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_coalesced_messages_total",
+		Help:      "Number of queued outbound messages dropped because a newer message superseded them.",
+	}, []string{"game_key", "type"})
+
+	RateLimitedMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_rate_limited_messages_total",
+		Help:      "Number of inbound messages rejected because a player exceeded their message rate.",
+	}, []string{"game_key"})
+
+	GamePanics = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "game_panics_total",
+		Help:      "Number of panics recovered in game servers.",
+	}, []string{"game_key"})
+
+	HubPanics = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "hub_panics_total",
+		Help:      "Number of panics recovered in game hubs.",
+	}, []string{"game_key"})
+
+	DatastoreDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "datastore_duration_seconds",
+		Help:      "Time taken by game store calls.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	DatastoreErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "datastore_errors_total",
+		Help:      "Number of failed game store calls.",
+	}, []string{"method"})
+)
+
+// StatsFunc returns the number of active games and players per game key
+type StatsFunc func() (activeGames, activePlayers map[string]int)
+
+// networkCollector reports active games and players on every scrape
+type networkCollector struct {
+	stats         StatsFunc
+	activeGames   *prometheus.Desc
+	activePlayers *prometheus.Desc
+}
+
+// RegisterNetworkStats exposes the active games and players returned by stats
+func RegisterNetworkStats(stats StatsFunc) error {
+	return prometheus.Register(&networkCollector{
+		stats:         stats,
+		activeGames:   prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "active_games"), "Number of games currently loaded.", []string{"game_key"}, nil),
+		activePlayers: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "active_players"), "Number of players currently connected.", []string{"game_key"}, nil),
+	})
+}
+
+func (c *networkCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.activeGames
+	ch <- c.activePlayers
+}
+
+func (c *networkCollector) Collect(ch chan<- prometheus.Metric) {
+	activeGames, activePlayers := c.stats()
+	for gameKey, count := range activeGames {
+		ch <- prometheus.MustNewConstMetric(c.activeGames, prometheus.GaugeValue, float64(count), gameKey)
+	}
+	for gameKey, count := range activePlayers {
+		ch <- prometheus.MustNewConstMetric(c.activePlayers, prometheus.GaugeValue, float64(count), gameKey)
+	}
+}
@@ -0,0 +1,203 @@
+package go_boardgame_networking
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/quibbble/go-quibbble/internal/datastore"
+	"github.com/quibbble/go-quibbble/pkg/logger"
+)
+
+// ListGames returns a summary of every running game sorted by game key and game ID
+func (n *GameNetwork) ListGames(ctx context.Context) ([]*GameSummary, error) {
+	summaries := make([]*GameSummary, 0)
+	for _, hub := range n.hubs {
+		servers, err := hub.servers(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, server := range servers {
+			var summary *GameSummary
+			if err := server.do(ctx, func() { summary = server.summary() }); err != nil {
+				if err == ErrGameClosed {
+					continue
+				}
+				return nil, err
+			}
+			summaries = append(summaries, summary)
+		}
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].GameKey != summaries[j].GameKey {
+			return summaries[i].GameKey < summaries[j].GameKey
+		}
+		return summaries[i].GameID < summaries[j].GameID
+	})
+	return summaries, nil
+}
+
+// StoreGame flushes a running game to the game store
+func (n *GameNetwork) StoreGame(ctx context.Context, gameKey, gameID string) error {
+	hub, ok := n.hubs[gameKey]
+	if !ok {
+		return ErrNoExistingGameKey(gameKey)
+	}
+	server, err := hub.server(ctx, gameID)
+	if err != nil {
+		return err
+	}
+	return n.storeServer(ctx, server)
+}
+
+// CloseGame stores a running game and then disconnects all players and removes it from memory
+// the game stops accepting actions in the same step its data is read so nothing played before it is removed is lost
+// the game is closed without being stored if no game store is enabled or the game does not support BGN
+func (n *GameNetwork) CloseGame(ctx context.Context, gameKey, gameID string) error {
+	hub, ok := n.hubs[gameKey]
+	if !ok {
+		return ErrNoExistingGameKey(gameKey)
+	}
+	server, err := hub.server(ctx, gameID)
+	if err != nil {
+		return err
+	}
+	var gameData *datastore.Game
+	if doErr := server.do(ctx, func() {
+		server.closing = true
+		gameData, err = server.gameData()
+	}); doErr != nil {
+		return doErr
+	}
+	if err == nil && (len(gameData.BGN.Actions) > 0 || gameData.PlayCount > 0) {
+		err = n.gameStore.Store(ctx, gameData)
+	}
+	switch {
+	case err == nil, err == datastore.ErrGameStoreNotEnabled:
+	case errors.Is(err, &Error{Code: CodeBGNUnsupported}):
+		logger.Log.Warn().Msgf("closing game '%s' for '%s' without storing it as bgn is not supported", gameID, gameKey)
+	default:
+		// the game keeps running so it is not lost
+		_ = server.do(context.Background(), func() { server.closing = false })
+		return err
+	}
+	return hub.remove(ctx, gameID)
+}
+
+// KickPlayer disconnects all connections of the player with the given name from a running game
+func (n *GameNetwork) KickPlayer(ctx context.Context, gameKey, gameID, playerName string) error {
+	hub, ok := n.hubs[gameKey]
+	if !ok {
+		return ErrNoExistingGameKey(gameKey)
+	}
+	server, err := hub.server(ctx, gameID)
+	if err != nil {
+		return err
+	}
+	var kicked bool
+	if err := server.do(ctx, func() { kicked = server.kick(playerName) }); err != nil {
+		return err
+	}
+	if !kicked {
+		return ErrNoConnectedPlayer(gameKey, gameID, playerName)
+	}
+	return nil
+}
+
+// Broadcast sends a system message to players of a running game
+// an empty game ID sends to all games of the game key and an empty game key sends to all games
+func (n *GameNetwork) Broadcast(ctx context.Context, gameKey, gameID, msg string) error {
+	servers, err := n.targetServers(ctx, gameKey, gameID)
+	if err != nil {
+		return err
+	}
+	for _, server := range servers {
+		if err := server.do(ctx, func() {
+			for player := range server.players {
+				server.sendSystemMessage(player, msg)
+			}
+		}); err != nil && err != ErrGameClosed {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetMaintenance toggles read only mode for a game key or all game keys if empty
+// while enabled no new games may be created and only chat actions are allowed in running games
+func (n *GameNetwork) SetMaintenance(ctx context.Context, gameKey string, enabled bool) error {
+	hubs := make([]*gameHub, 0)
+	if gameKey == "" {
+		for _, hub := range n.hubs {
+			hubs = append(hubs, hub)
+		}
+	} else {
+		hub, ok := n.hubs[gameKey]
+		if !ok {
+			return ErrNoExistingGameKey(gameKey)
+		}
+		hubs = append(hubs, hub)
+	}
+	for _, hub := range hubs {
+		var servers []*gameServer
+		if err := hub.do(ctx, func() {
+			hub.readOnly = enabled
+			for _, server := range hub.games {
+				servers = append(servers, server)
+			}
+		}); err != nil {
+			return err
+		}
+		for _, server := range servers {
+			if err := server.do(ctx, func() { server.readOnly = enabled }); err != nil && err != ErrGameClosed {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// targetServers returns the running game servers matching the game key and game ID where empty matches all
+func (n *GameNetwork) targetServers(ctx context.Context, gameKey, gameID string) ([]*gameServer, error) {
+	if gameKey == "" {
+		servers := make([]*gameServer, 0)
+		for _, hub := range n.hubs {
+			hubServers, err := hub.servers(ctx)
+			if err != nil {
+				return nil, err
+			}
+			servers = append(servers, hubServers...)
+		}
+		return servers, nil
+	}
+	hub, ok := n.hubs[gameKey]
+	if !ok {
+		return nil, ErrNoExistingGameKey(gameKey)
+	}
+	if gameID == "" {
+		return hub.servers(ctx)
+	}
+	server, err := hub.server(ctx, gameID)
+	if err != nil {
+		return nil, err
+	}
+	return []*gameServer{server}, nil
+}
+
+// storeServer stores the game of a running server if anything has been played
+func (n *GameNetwork) storeServer(ctx context.Context, server *gameServer) error {
+	var (
+		gameData *datastore.Game
+		err      error
+	)
+	if doErr := server.do(ctx, func() { gameData, err = server.gameData() }); doErr != nil {
+		return doErr
+	}
+	if err != nil {
+		return err
+	}
+	if len(gameData.BGN.Actions) <= 0 && gameData.PlayCount <= 0 {
+		return nil
+	}
+	return n.gameStore.Store(ctx, gameData)
+}
@@ -0,0 +1,152 @@
+package go_boardgame_networking
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Encodings a player may choose when joining a game
+const (
+	// EncodingJSON sends and receives JSON text frames
+	EncodingJSON = "json"
+
+	// EncodingMsgpack sends and receives MessagePack binary frames
+	EncodingMsgpack = "msgpack"
+
+	// EncodingCBOR sends and receives CBOR binary frames
+	EncodingCBOR = "cbor"
+)
+
+// encoding converts messages between JSON used within the server and the player's wire format
+type encoding interface {
+	// messageType is the websocket frame type messages are sent with
+	messageType() int
+
+	// encode converts a JSON message to the wire format
+	encode(payload []byte) ([]byte, error)
+
+	// decode converts a message in the wire format to JSON
+	decode(payload []byte) ([]byte, error)
+}
+
+func newEncoding(name string) (encoding, error) {
+	switch name {
+	case "", EncodingJSON:
+		return jsonEncoding{}, nil
+	case EncodingMsgpack:
+		return msgpackEncoding{}, nil
+	case EncodingCBOR:
+		return cborEncoding{}, nil
+	default:
+		return nil, ErrUnsupportedEncoding(name)
+	}
+}
+
+// Encode converts a JSON message to the named encoding's wire format as done for every message written to a player
+func Encode(name string, payload []byte) ([]byte, error) {
+	enc, err := newEncoding(name)
+	if err != nil {
+		return nil, err
+	}
+	return enc.encode(payload)
+}
+
+type jsonEncoding struct{}
+
+func (jsonEncoding) messageType() int { return websocket.TextMessage }
+
+func (jsonEncoding) encode(payload []byte) ([]byte, error) { return payload, nil }
+
+func (jsonEncoding) decode(payload []byte) ([]byte, error) { return payload, nil }
+
+type msgpackEncoding struct{}
+
+func (msgpackEncoding) messageType() int { return websocket.BinaryMessage }
+
+func (msgpackEncoding) encode(payload []byte) ([]byte, error) {
+	value, err := unmarshalJSON(payload)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.UseCompactInts(true)
+	enc.UseCompactFloats(true)
+	if err := enc.Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackEncoding) decode(payload []byte) ([]byte, error) {
+	var value interface{}
+	if err := msgpack.Unmarshal(payload, &value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+type cborEncoding struct{}
+
+var mapStringInterfaceType = reflect.TypeOf(map[string]interface{}(nil))
+
+// cborEnc uses the smallest float that keeps a value's precision
+var cborEnc, _ = cbor.EncOptions{ShortestFloat: cbor.ShortestFloat16}.EncMode()
+
+// cborDec decodes maps with string keys so they may be marshalled to JSON
+var cborDec, _ = cbor.DecOptions{DefaultMapType: mapStringInterfaceType}.DecMode()
+
+func (cborEncoding) messageType() int { return websocket.BinaryMessage }
+
+func (cborEncoding) encode(payload []byte) ([]byte, error) {
+	value, err := unmarshalJSON(payload)
+	if err != nil {
+		return nil, err
+	}
+	return cborEnc.Marshal(value)
+}
+
+func (cborEncoding) decode(payload []byte) ([]byte, error) {
+	var value interface{}
+	if err := cborDec.Unmarshal(payload, &value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// unmarshalJSON decodes JSON keeping whole numbers as integers so binary encodings may store them compactly
+func unmarshalJSON(payload []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	return numbers(value), nil
+}
+
+// numbers replaces every json.Number with an int64 if whole or a float64 otherwise
+func numbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = numbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = numbers(item)
+		}
+	}
+	return value
+}
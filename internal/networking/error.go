@@ -1,67 +1,206 @@
 package go_boardgame_networking
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 )
 
+// Error codes sent to players alongside error messages so clients need not match on message text
+const (
+	CodeInternal           = "Internal"
+	CodeInvalidMessage     = "InvalidMessage"
+	CodeInvalidAction      = "InvalidAction"
+	CodeInvalidOptions     = "InvalidOptions"
+	CodeBGNUnsupported     = "BGNUnsupported"
+	CodeGameKeyNotFound    = "GameKeyNotFound"
+	CodeGameNotFound       = "GameNotFound"
+	CodeGameExists         = "GameExists"
+	CodeGameClosed         = "GameClosed"
+	CodeGameCrashed        = "GameCrashed"
+	CodeRestarted          = "Restarted"
+	CodeMaintenance        = "Maintenance"
+	CodeDraining           = "Draining"
+	CodeReadOnly           = "ReadOnly"
+	CodePlayerNotFound     = "PlayerNotFound"
+	CodeAlreadyConnected   = "AlreadyConnected"
+	CodeUnauthorized       = "Unauthorized"
+	CodeUnsupported        = "Unsupported"
+	CodeUnknownSequence    = "UnknownSequence"
+	CodeMessageTooLarge    = "MessageTooLarge"
+	CodeActionNotAllowed   = "ActionNotAllowed"
+	CodeNoActionToUndo     = "NoActionToUndo"
+	CodeWrongTeam          = "WrongTeam"
+	CodeInvalidTeam        = "InvalidTeam"
+	CodeAlreadyInTeam      = "AlreadyInTeam"
+	CodeNoOpenTeam         = "NoOpenTeam"
+	CodeMaxChat            = "MaxChat"
+	CodeRateLimited        = "RateLimited"
+	CodeTooManyConnections = "TooManyConnections"
+	CodeTransportClosed    = "TransportClosed"
+)
+
+// Error is an error with a code identifying its kind
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is matches any error with the same code so errors.Is(err, &Error{Code: CodeGameNotFound}) checks the kind of error
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+func newError(code, format string, args ...interface{}) error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// withCode gives an error from outside the networking layer, such as a game rule violation, a code
+func withCode(code string, err error) error {
+	return &Error{Code: code, Message: err.Error()}
+}
+
+// ErrorCode returns the code of the error or CodeInternal if it has none
+func ErrorCode(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeInternal
+}
+
 var (
 	ErrBGNUnsupported = func(gameKey string) error {
-		return fmt.Errorf("bgn is not supported for gameKey '%s'", gameKey)
+		return newError(CodeBGNUnsupported, "bgn is not supported for gameKey '%s'", gameKey)
 	}
 
 	ErrNoExistingGameKey = func(gameKey string) error {
-		return fmt.Errorf("gameKey does not exist for gameKey '%s'", gameKey)
+		return newError(CodeGameKeyNotFound, "gameKey does not exist for gameKey '%s'", gameKey)
 	}
 
 	ErrExistingGameID = func(gameKey, gameID string) error {
-		return fmt.Errorf("gameID '%s' already exists for gameKey '%s'", gameID, gameKey)
+		return newError(CodeGameExists, "gameID '%s' already exists for gameKey '%s'", gameID, gameKey)
 	}
 
 	ErrNoExistingGameID = func(gameKey, gameID string) error {
-		return fmt.Errorf("gameID '%s' does not exist for gameKey '%s'", gameID, gameKey)
+		return newError(CodeGameNotFound, "gameID '%s' does not exist for gameKey '%s'", gameID, gameKey)
 	}
 
 	ErrCreateGame = func(gameKey, gameID string) error {
-		return fmt.Errorf("failed to create game with gameID '%s' for gameKey '%s'", gameID, gameKey)
+		return newError(CodeInternal, "failed to create game with gameID '%s' for gameKey '%s'", gameID, gameKey)
 	}
 	ErrStoreGame = func(gameKey, gameID string) error {
-		return fmt.Errorf("failed to store game with gameID '%s' for gameKey '%s'", gameID, gameKey)
+		return newError(CodeInternal, "failed to store game with gameID '%s' for gameKey '%s'", gameID, gameKey)
+	}
+
+	ErrArchivePlaythrough = func(gameKey, gameID string) error {
+		return newError(CodeInternal, "failed to archive playthrough of gameID '%s' for gameKey '%s'", gameID, gameKey)
+	}
+
+	ErrMaintenance = func(gameKey string) error {
+		return newError(CodeMaintenance, "gameKey '%s' is in maintenance mode", gameKey)
+	}
+
+	ErrDraining = func(gameKey string) error {
+		return newError(CodeDraining, "gameKey '%s' is not accepting new games as the server is restarting", gameKey)
+	}
+
+	ErrHubRestarted = func(gameKey string) error {
+		return newError(CodeRestarted, "game hub for gameKey '%s' failed and was restarted so the request should be retried", gameKey)
+	}
+
+	ErrGameRestarted = func(gameKey, gameID string) error {
+		return newError(CodeRestarted, "gameID '%s' for gameKey '%s' failed and was restarted from its last saved state", gameID, gameKey)
+	}
+
+	ErrRequestFailed = func(gameKey, gameID string) error {
+		return newError(CodeInternal, "request to gameID '%s' for gameKey '%s' failed due to an internal error", gameID, gameKey)
+	}
+
+	ErrGameCrashed = func(gameKey, gameID string) error {
+		return newError(CodeGameCrashed, "gameID '%s' for gameKey '%s' failed and could not be recovered", gameID, gameKey)
+	}
+
+	ErrNoConnectedPlayer = func(gameKey, gameID, playerName string) error {
+		return newError(CodePlayerNotFound, "player '%s' is not connected to gameID '%s' for gameKey '%s'", playerName, gameID, gameKey)
 	}
 
 	ErrHubClosure = func(gameKey ...string) error {
-		return fmt.Errorf("game hubs '%s' failed to close gracefully", strings.Join(gameKey, ", "))
+		return newError(CodeInternal, "game hubs '%s' failed to close gracefully", strings.Join(gameKey, ", "))
+	}
+
+	ErrInvalidOnConflict = func(onConflict string) error {
+		return newError(CodeInvalidOptions, "on conflict '%s' must be one of '%s', '%s' or '%s'", onConflict, OnConflictError, OnConflictLoad, OnConflictReplace)
 	}
 
 	ErrInconsistentTeams = func(gameKey, gameID string) error {
-		return fmt.Errorf("number of teams are inconsistent in gameID '%s' for gameKey '%s'", gameID, gameKey)
+		return newError(CodeInvalidOptions, "number of teams are inconsistent in gameID '%s' for gameKey '%s'", gameID, gameKey)
 	}
 
 	ErrCreateGameOptions = func(gameKey, gameID string) error {
-		return fmt.Errorf("invalid create game options in gameID '%s' for gameKey '%s'", gameID, gameKey)
+		return newError(CodeInvalidOptions, "invalid create game options in gameID '%s' for gameKey '%s'", gameID, gameKey)
 	}
 
 	ErrPlayerAlreadyConnected = func(gameKey, gameID string) error {
-		return fmt.Errorf("player already connected in gameID '%s' for gameKey '%s'", gameID, gameKey)
+		return newError(CodeAlreadyConnected, "player already connected in gameID '%s' for gameKey '%s'", gameID, gameKey)
 	}
 
 	ErrPlayerUnauthorized = func(gameKey, gameID string) error {
-		return fmt.Errorf("player not authorized to join gameID '%s' for gameKey '%s'", gameID, gameKey)
+		return newError(CodeUnauthorized, "player not authorized to join gameID '%s' for gameKey '%s'", gameID, gameKey)
+	}
+
+	ErrUnsupportedProtocol = func(protocol string) error {
+		return newError(CodeUnsupported, "protocol '%s' is not supported", protocol)
+	}
+
+	ErrUnsupportedEncoding = func(encoding string) error {
+		return newError(CodeUnsupported, "encoding '%s' is not supported", encoding)
+	}
+
+	ErrUnknownSequence = func(seq int64) error {
+		return newError(CodeUnknownSequence, "no unacknowledged snapshot with sequence number %d", seq)
+	}
+
+	ErrMessageTooLarge = func(limit int64) error {
+		return newError(CodeMessageTooLarge, "message is larger than the limit of %d bytes", limit)
 	}
 
 	ErrActionNotAllowed = func(actionType string) error {
-		return fmt.Errorf("%s action not allowed", actionType)
+		return newError(CodeActionNotAllowed, "%s action not allowed", actionType)
 	}
 
-	ErrNoActionToUndo = fmt.Errorf("no action to undo")
+	ErrNoActionToUndo = newError(CodeNoActionToUndo, "no action to undo")
+
+	ErrWrongTeamAction = newError(CodeWrongTeam, "cannot perform game action for another team")
+
+	ErrInvalidTeam = newError(CodeInvalidTeam, "invalid team")
+
+	ErrAlreadyInTeam = newError(CodeAlreadyInTeam, "already in team")
+
+	ErrNoOpenTeam = newError(CodeNoOpenTeam, "no open team")
+
+	ErrMaxChat = newError(CodeMaxChat, "max chat limit reached")
+
+	ErrGameClosed = newError(CodeGameClosed, "game is closed")
+
+	ErrRateLimited = newError(CodeRateLimited, "too many messages, slow down")
+
+	ErrRateLimitDisconnect = newError(CodeRateLimited, "too many messages, disconnecting")
+
+	ErrTooManyConnections = newError(CodeTooManyConnections, "too many connections from this address")
 
-	ErrWrongTeamAction = fmt.Errorf("cannot perform game action for another team")
+	ErrReadOnly = newError(CodeReadOnly, "game is read only during maintenance")
 
-	ErrInvalidTeam = fmt.Errorf("invalid team")
+	ErrTransportClosed = newError(CodeTransportClosed, "transport is closed")
 
-	ErrAlreadyInTeam = fmt.Errorf("already in team")
+	ErrStreamingUnsupported = newError(CodeUnsupported, "streaming is not supported")
 
-	ErrNoOpenTeam = fmt.Errorf("no open team")
+	ErrBinaryUnsupported = newError(CodeUnsupported, "binary messages are not supported by the transport")
 
-	ErrMaxChat = fmt.Errorf("max chat limit reached")
+	ErrTransportLagging = newError(CodeTransportClosed, "too many messages are waiting to be polled")
 )
@@ -7,117 +7,163 @@ import (
 
 	bg "github.com/quibbble/go-boardgame"
 	"github.com/quibbble/go-quibbble/internal/datastore"
+	"github.com/quibbble/go-quibbble/internal/metrics"
 	"github.com/quibbble/go-quibbble/pkg/logger"
+	"github.com/quibbble/go-quibbble/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// recoverTimeout bounds how long each game may take to be persisted when recovering from a panic
+const recoverTimeout = 5 * time.Second
+
+// createRequest asks the hub to create a game with the result sent on errCh
+type createRequest struct {
+	options CreateGameOptions
+	errCh   chan error
+}
+
 // gameHub is a hub for a unique game type i.e. only for connect4 or only for tsuro
 type gameHub struct {
 	gameStore  datastore.GameStore
 	builder    bg.BoardGameBuilder
 	games      map[string]*gameServer // mapping from game ID to game server
-	create     chan CreateGameOptions
-	join       chan JoinGameOptions
+	create     chan *createRequest
 	cleanup    chan string
-	errCh      chan error
+	requests   chan *request
+	inflight   chan error // reply channel of the request being handled so it can be failed if the loop panics
+	expiry     *time.Ticker
 	gameExpiry time.Duration
 	adapters   []NetworkAdapter
+	limits     LimitOptions
+	connection ConnectionOptions
+	readOnly   bool // no games may be created while in maintenance mode
+	draining   bool // no games may be created while the server is restarting
 }
 
-func newGameHub(builder bg.BoardGameBuilder, gameExpiry time.Duration, adapters []NetworkAdapter, gameStore datastore.GameStore) *gameHub {
+func newGameHub(builder bg.BoardGameBuilder, gameExpiry time.Duration, adapters []NetworkAdapter, gameStore datastore.GameStore, limits LimitOptions, connection ConnectionOptions) *gameHub {
 	return &gameHub{
 		gameStore:  gameStore,
 		builder:    builder,
 		games:      make(map[string]*gameServer),
-		create:     make(chan CreateGameOptions),
-		join:       make(chan JoinGameOptions),
+		create:     make(chan *createRequest),
 		cleanup:    make(chan string),
-		errCh:      make(chan error),
+		requests:   make(chan *request),
+		expiry:     time.NewTicker(time.Minute),
 		gameExpiry: gameExpiry,
 		adapters:   adapters,
+		limits:     limits,
+		connection: connection,
 	}
 }
 
+// Start handles hub requests until the loop panics
 func (h *gameHub) Start() {
 	gameKey := h.builder.Key()
 
-	// catch any panics and close the game out gracefully
+	// catch any panics and fail the in-flight request
 	// prevents the server from crashing due to bugs in a game
 	defer func() {
 		if r := recover(); r != nil {
-			logger.Log.Error().Caller().Msgf("%v from game key '%s' with stack trace %s", r, h.builder.Key(), string(debug.Stack()))
-		}
-	}()
-
-	// check and clean expired games once a minute
-	cleanExpired := make(chan interface{})
-	go func() {
-		for range time.Tick(time.Minute) {
-			cleanExpired <- true
+			logger.Log.Error().Caller().Msgf("%v from game key '%s' with stack trace %s", r, gameKey, string(debug.Stack()))
+			metrics.HubPanics.WithLabelValues(gameKey).Inc()
+			if h.inflight != nil {
+				h.inflight <- ErrHubRestarted(gameKey)
+				h.inflight = nil
+			}
 		}
 	}()
 
 	for {
 		select {
 		case create := <-h.create:
-			gameID := create.NetworkOptions.GameID
-			_, ok := h.games[gameID]
-			if ok {
-				h.errCh <- ErrExistingGameID(gameKey, gameID)
-				continue
-			}
-			server, err := newServer(h.builder, &create, h.adapters)
-			if err != nil {
-				logger.Log.Error().Err(err).Msgf(ErrCreateGame(gameKey, gameID).Error())
-				h.errCh <- err
-				continue
-			}
-			go server.Start(h.cleanup)
-			h.games[gameID] = server
-			h.errCh <- nil
-		case join := <-h.join:
-			server, ok := h.games[join.GameID]
+			h.inflight = create.errCh
+			create.errCh <- h.createServer(create.options)
+			h.inflight = nil
+		case req := <-h.requests:
+			h.inflight = req.errCh
+			req.fn()
+			req.errCh <- nil
+			h.inflight = nil
+		case gameID := <-h.cleanup:
+			server, ok := h.games[gameID]
 			if !ok {
-				h.errCh <- ErrNoExistingGameID(gameKey, join.GameID)
 				continue
 			}
-			h.errCh <- server.Join(join)
-		case gameID := <-h.cleanup:
 			logger.Log.Debug().Caller().Msgf("cleaning up game with key %s and id %s", gameKey, gameID)
-			h.games[gameID].Close()
+			server.Close()
 			delete(h.games, gameID)
-		case <-cleanExpired:
-			for gameID, server := range h.games {
-				deleteUpdatedAt := server.updatedAt.Add(h.gameExpiry)
-				deleteIntializedAt := server.initializedAt.Add(h.gameExpiry)
-				now := time.Now().UTC()
-				if now.After(deleteUpdatedAt) && now.After(deleteIntializedAt) {
-					bgnGame, ok := server.game.(bg.BoardGameWithBGN)
-					if !ok {
-						logger.Log.Error().Caller().Err(ErrBGNUnsupported(gameKey))
-					} else if len(bgnGame.GetBGN().Actions) > 0 || server.playCount > 0 {
-						if err := h.gameStore.Store(&datastore.Game{
-							GameKey:   gameKey,
-							GameID:    gameID,
-							BGN:       bgnGame.GetBGN(),
-							CreatedAt: server.createdAt,
-							UpdatedAt: server.updatedAt,
-							PlayCount: server.playCount,
-						}); err != nil {
-							logger.Log.Error().Caller().Err(err).Msgf(ErrStoreGame(gameKey, gameID).Error())
-						}
-					}
-					logger.Log.Debug().Caller().Msgf("cleaning up game with key %s and id %s", gameKey, gameID)
-					h.games[gameID].Close()
-					delete(h.games, gameID)
-				}
+		case <-h.expiry.C:
+			// expiry is checked from outside the hub loop as it requires querying each server
+			for _, server := range h.games {
+				go h.expire(server)
 			}
 		}
 	}
 }
 
-func (h *gameHub) Create(options CreateGameOptions) error {
-	h.create <- options
-	if err := <-h.errCh; err != nil {
+func (h *gameHub) createServer(create CreateGameOptions) error {
+	gameKey, gameID := h.builder.Key(), create.NetworkOptions.GameID
+	if h.readOnly {
+		return ErrMaintenance(gameKey)
+	}
+	if h.draining {
+		return ErrDraining(gameKey)
+	}
+	if _, ok := h.games[gameID]; ok {
+		return ErrExistingGameID(gameKey, gameID)
+	}
+	server, err := newServer(h.builder, &create, h.adapters, h.gameStore, h.limits, h.connection)
+	if err != nil {
+		logger.Log.Error().Err(err).Msgf(ErrCreateGame(gameKey, gameID).Error())
+		return err
+	}
+	go server.Start(h.cleanup)
+	h.games[gameID] = server
+	return nil
+}
+
+// recoverGames persists every game still running after the hub loop panicked and drops those that have stopped
+// servers run in their own goroutines and never wait on the hub so they may be queried while the loop is down
+func (h *gameHub) recoverGames() {
+	gameKey := h.builder.Key()
+	for gameID, server := range h.games {
+		ctx, cancel := context.WithTimeout(context.Background(), recoverTimeout)
+		var (
+			gameData *datastore.Game
+			err      error
+		)
+		doErr := server.do(ctx, func() { gameData, err = server.gameData() })
+		cancel()
+		if doErr == ErrGameClosed {
+			delete(h.games, gameID)
+			continue
+		}
+		if doErr != nil || err != nil || (len(gameData.BGN.Actions) <= 0 && gameData.PlayCount <= 0) {
+			continue
+		}
+		if err := h.gameStore.Store(context.Background(), gameData); err != nil && err != datastore.ErrGameStoreNotEnabled {
+			logger.Log.Error().Caller().Err(err).Msgf(ErrStoreGame(gameKey, gameID).Error())
+		}
+	}
+}
+
+func (h *gameHub) Create(ctx context.Context, options CreateGameOptions) error {
+	_, span := tracing.Tracer.Start(ctx, "hub.Create", trace.WithAttributes(
+		attribute.String("game_key", h.builder.Key()),
+		attribute.String("game_id", options.NetworkOptions.GameID),
+	))
+	defer span.End()
+	create := &createRequest{options: options, errCh: make(chan error, 1)}
+	select {
+	case h.create <- create:
+	case <-ctx.Done():
+		span.SetStatus(codes.Error, ctx.Err().Error())
+		return ctx.Err()
+	}
+	if err := <-create.errCh; err != nil {
+		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
 	for _, adapter := range h.adapters {
@@ -126,9 +172,102 @@ func (h *gameHub) Create(options CreateGameOptions) error {
 	return nil
 }
 
-func (h *gameHub) Join(options JoinGameOptions) error {
-	h.join <- options
-	return <-h.errCh
+func (h *gameHub) Join(ctx context.Context, options JoinGameOptions) error {
+	ctx, span := tracing.Tracer.Start(ctx, "hub.Join", trace.WithAttributes(
+		attribute.String("game_key", h.builder.Key()),
+		attribute.String("game_id", options.GameID),
+	))
+	defer span.End()
+	server, err := h.server(ctx, options.GameID)
+	if err == nil {
+		err = server.Join(options)
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return nil
+}
+
+// expire stores and cleans up the server's game if it has not been updated within the game expiry
+func (h *gameHub) expire(server *gameServer) {
+	gameKey, gameID := h.builder.Key(), server.create.NetworkOptions.GameID
+	var (
+		expired  bool
+		gameData *datastore.Game
+		err      error
+	)
+	if doErr := server.do(context.Background(), func() {
+		now := time.Now().UTC()
+		expired = now.After(server.updatedAt.Add(h.gameExpiry)) && now.After(server.initializedAt.Add(h.gameExpiry))
+		if expired {
+			gameData, err = server.gameData()
+		}
+	}); doErr != nil || !expired {
+		return
+	}
+	if err != nil {
+		logger.Log.Error().Caller().Err(err).Msgf(ErrStoreGame(gameKey, gameID).Error())
+	} else if len(gameData.BGN.Actions) > 0 || gameData.PlayCount > 0 {
+		if err := h.gameStore.Store(context.Background(), gameData); err != nil {
+			logger.Log.Error().Caller().Err(err).Msgf(ErrStoreGame(gameKey, gameID).Error())
+		}
+	}
+	h.cleanup <- gameID
+}
+
+// do runs fn inside the hub loop so it may safely access the hub's games
+func (h *gameHub) do(ctx context.Context, fn func()) error {
+	req := &request{fn: fn, errCh: make(chan error, 1)}
+	select {
+	case h.requests <- req:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return <-req.errCh
+}
+
+// server returns the game server for the game ID
+func (h *gameHub) server(ctx context.Context, gameID string) (*gameServer, error) {
+	var server *gameServer
+	if err := h.do(ctx, func() { server = h.games[gameID] }); err != nil {
+		return nil, err
+	}
+	if server == nil {
+		return nil, ErrNoExistingGameID(h.builder.Key(), gameID)
+	}
+	return server, nil
+}
+
+// servers returns all game servers in the hub
+func (h *gameHub) servers(ctx context.Context) ([]*gameServer, error) {
+	servers := make([]*gameServer, 0)
+	if err := h.do(ctx, func() {
+		for _, server := range h.games {
+			servers = append(servers, server)
+		}
+	}); err != nil {
+		return nil, err
+	}
+	return servers, nil
+}
+
+// remove closes and removes the game server from the hub
+func (h *gameHub) remove(ctx context.Context, gameID string) error {
+	var found bool
+	if err := h.do(ctx, func() {
+		var server *gameServer
+		if server, found = h.games[gameID]; found {
+			server.Close()
+			delete(h.games, gameID)
+		}
+	}); err != nil {
+		return err
+	}
+	if !found {
+		return ErrNoExistingGameID(h.builder.Key(), gameID)
+	}
+	return nil
 }
 
 func (h *gameHub) Store(ctx context.Context) error {
@@ -137,29 +276,36 @@ func (h *gameHub) Store(ctx context.Context) error {
 	if _, ok := h.builder.(bg.BoardGameWithBGNBuilder); !ok {
 		return ErrBGNUnsupported(gameKey)
 	}
-	for gameID, server := range h.games {
-		bgnGame := server.game.(bg.BoardGameWithBGN)
-		if len(bgnGame.GetBGN().Actions) <= 0 && server.playCount <= 0 {
+	servers, err := h.servers(ctx)
+	if err != nil {
+		return err
+	}
+	for _, server := range servers {
+		var gameData *datastore.Game
+		if doErr := server.do(ctx, func() { gameData, err = server.gameData() }); doErr == ErrGameClosed {
 			continue
+		} else if doErr != nil {
+			return doErr
 		}
-		if err := h.gameStore.Store(&datastore.Game{
-			GameKey:   gameKey,
-			GameID:    gameID,
-			BGN:       bgnGame.GetBGN(),
-			CreatedAt: server.createdAt,
-			UpdatedAt: server.updatedAt,
-			PlayCount: server.playCount,
-		}); err != nil {
-			logger.Log.Error().Caller().Err(err).Msgf(ErrStoreGame(gameKey, gameID).Error())
+		if err != nil {
+			return err
+		}
+		if len(gameData.BGN.Actions) <= 0 && gameData.PlayCount <= 0 {
+			continue
+		}
+		if err := h.gameStore.Store(ctx, gameData); err != nil {
+			logger.Log.Error().Caller().Err(err).Msgf(ErrStoreGame(gameKey, gameData.GameID).Error())
 			return err
 		}
 	}
 	return nil
 }
 
-func (h *gameHub) Close() error {
-	for gameID := range h.games {
-		h.cleanup <- gameID
-	}
-	return nil
+func (h *gameHub) Close(ctx context.Context) error {
+	return h.do(ctx, func() {
+		for gameID, server := range h.games {
+			server.Close()
+			delete(h.games, gameID)
+		}
+	})
 }
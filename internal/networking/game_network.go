@@ -2,7 +2,12 @@ package go_boardgame_networking
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	bg "github.com/quibbble/go-boardgame"
 	"github.com/quibbble/go-boardgame/pkg/bgn"
@@ -13,6 +18,14 @@ import (
 type GameNetwork struct {
 	hubs      map[string]*gameHub // mapping from game key to game hub
 	gameStore datastore.GameStore
+	conns     *connLimiter
+	draining  atomic.Bool
+}
+
+// HubCheck is the result of checking a hub loop responds
+type HubCheck struct {
+	Latency time.Duration
+	Err     error
 }
 
 type GameStats struct {
@@ -23,73 +36,140 @@ type GameStats struct {
 func NewGameNetwork(options GameNetworkOptions) *GameNetwork {
 	hubs := make(map[string]*gameHub)
 	for _, builder := range options.Games {
-		hub := newGameHub(builder, options.GameExpiry, options.Adapters, options.GameStore)
-		go hub.Start()
+		connection := options.Connection.withDefaults(ConnectionOptions{})
+		for gameKey, gameConnection := range options.GameConnections {
+			// config keys may have lost their case
+			if strings.EqualFold(gameKey, builder.Key()) {
+				connection = gameConnection.withDefaults(connection)
+			}
+		}
+		hub := newGameHub(builder, options.GameExpiry, options.Adapters, options.GameStore, options.Limits, connection)
+		go supervise(hub)
 		hubs[builder.Key()] = hub
 	}
 	return &GameNetwork{
 		hubs:      hubs,
 		gameStore: options.GameStore,
+		conns:     newConnLimiter(options.Limits.MaxConnectionsPerIP),
+	}
+}
+
+const (
+	minRestartBackoff = 100 * time.Millisecond
+	maxRestartBackoff = 30 * time.Second
+
+	// restartBackoffReset is how long a hub must run before it panics again for its restart backoff to start over
+	restartBackoffReset = time.Minute
+)
+
+// supervise runs the hub loop restarting it with the games it holds whenever it panics
+// restarts back off so a hub that keeps panicking does not spin
+func supervise(hub *gameHub) {
+	backoff := minRestartBackoff
+	for {
+		started := time.Now()
+		hub.Start()
+		if time.Since(started) >= restartBackoffReset {
+			backoff = minRestartBackoff
+		}
+		hub.recoverGames()
+		logger.Log.Info().Msgf("restarting game hub with key '%s' in %s", hub.builder.Key(), backoff)
+		time.Sleep(backoff)
+		backoff = min(2*backoff, maxRestartBackoff)
 	}
 }
 
-func (n *GameNetwork) CreateGame(options CreateGameOptions) error {
+func (n *GameNetwork) CreateGame(ctx context.Context, options CreateGameOptions) error {
 	gameKey, gameID := options.NetworkOptions.GameKey, options.NetworkOptions.GameID
 	hub, ok := n.hubs[gameKey]
 	if !ok {
 		return ErrNoExistingGameKey(gameKey)
 	}
-	if len(options.NetworkOptions.Players) > 0 && len(options.NetworkOptions.Players) != len(options.GameOptions.Teams) {
+	if options.GameOptions != nil && len(options.NetworkOptions.Players) > 0 && len(options.NetworkOptions.Players) != len(options.GameOptions.Teams) {
 		return ErrInconsistentTeams(gameKey, gameID)
 	}
-	if _, ok := hub.games[gameID]; !ok {
-		if gameData, err := n.gameStore.GetGame(gameKey, gameID); err == nil {
+	onConflict := options.NetworkOptions.OnConflict
+	switch onConflict {
+	case "", OnConflictError, OnConflictLoad, OnConflictReplace:
+	default:
+		return ErrInvalidOnConflict(onConflict)
+	}
+	if _, err := hub.server(ctx, gameID); err == nil {
+		switch onConflict {
+		case OnConflictLoad:
+			return nil
+		case OnConflictReplace:
+			// the running game is stored first so its history is kept once the new game overwrites it
+			if err := n.CloseGame(ctx, gameKey, gameID); err != nil && !errors.Is(err, &Error{Code: CodeGameNotFound}) {
+				return err
+			}
+		default:
+			return ErrExistingGameID(gameKey, gameID)
+		}
+	} else if gameData, err := n.gameStore.GetGame(ctx, gameKey, gameID); err == nil {
+		switch onConflict {
+		case OnConflictLoad:
 			options.GameOptions = nil
 			options.BGN = nil
 			options.GameData = gameData
+		case OnConflictReplace:
+			// the stored game is overwritten when the new game is next stored
+		default:
+			return ErrExistingGameID(gameKey, gameID)
 		}
 	}
-	return hub.Create(options)
+	return hub.Create(ctx, options)
 }
 
-func (n *GameNetwork) JoinGame(options JoinGameOptions) error {
-	gameKey, gameID := options.GameKey, options.GameID
-	hub, ok := n.hubs[gameKey]
+func (n *GameNetwork) JoinGame(ctx context.Context, options JoinGameOptions) error {
+	hub, ok := n.hubs[options.GameKey]
 	if !ok {
-		return ErrNoExistingGameKey(gameKey)
+		return ErrNoExistingGameKey(options.GameKey)
 	}
-	if _, ok := hub.games[gameID]; !ok {
-		gameData, err := n.gameStore.GetGame(gameKey, gameID)
-		if err != nil {
-			return ErrNoExistingGameID(gameKey, gameID)
-		}
-		if err := hub.Create(CreateGameOptions{
-			NetworkOptions: &NetworkingCreateGameOptions{
-				GameKey: gameKey,
-				GameID:  gameID,
-			},
-			GameData: gameData,
-		}); err != nil {
-			return err
-		}
+	if options.Protocol != "" && options.Protocol != ProtocolSnapshot && options.Protocol != ProtocolPatch {
+		return ErrUnsupportedProtocol(options.Protocol)
 	}
-	return hub.Join(options)
+	if _, err := newEncoding(options.Encoding); err != nil {
+		return err
+	}
+	release, err := n.conns.acquire(options.RemoteAddr)
+	if err != nil {
+		return err
+	}
+	options.release = release
+	if _, err := n.server(ctx, hub, options.GameID); err != nil {
+		release()
+		return err
+	}
+	if err := hub.Join(ctx, options); err != nil {
+		release()
+		return err
+	}
+	return nil
 }
 
-func (n *GameNetwork) GetStats() *GameStats {
+func (n *GameNetwork) GetStats(ctx context.Context) (*GameStats, error) {
 	stats := &GameStats{
 		ActiveGames:   make(map[string]int),
 		ActivePlayers: make(map[string]int),
 	}
 	for _, hub := range n.hubs {
 		key := hub.builder.Key()
-		stats.ActiveGames[key] = len(hub.games)
+		servers, err := hub.servers(ctx)
+		if err != nil {
+			return nil, err
+		}
+		stats.ActiveGames[key] = len(servers)
 		stats.ActivePlayers[key] = 0
-		for _, game := range hub.games {
-			stats.ActivePlayers[key] += len(game.players)
+		for _, server := range servers {
+			var players int
+			if err := server.do(ctx, func() { players = len(server.players) }); err != nil && err != ErrGameClosed {
+				return nil, err
+			}
+			stats.ActivePlayers[key] += players
 		}
 	}
-	return stats
+	return stats, nil
 }
 
 func (n *GameNetwork) GetInfo(gameKey string) (*bg.BoardGameInfo, error) {
@@ -100,20 +180,24 @@ func (n *GameNetwork) GetInfo(gameKey string) (*bg.BoardGameInfo, error) {
 	return hub.builder.Info(), nil
 }
 
-func (n *GameNetwork) GetActiveGameIDs() map[string][]string {
+func (n *GameNetwork) GetActiveGameIDs(ctx context.Context) (map[string][]string, error) {
 	activeGameIDs := make(map[string][]string)
 	for _, hub := range n.hubs {
 		gameIDs := make([]string, 0)
-		for gameID := range hub.games {
-			gameIDs = append(gameIDs, gameID)
+		if err := hub.do(ctx, func() {
+			for gameID := range hub.games {
+				gameIDs = append(gameIDs, gameID)
+			}
+		}); err != nil {
+			return nil, err
 		}
 		sort.Strings(gameIDs)
 		activeGameIDs[hub.builder.Key()] = gameIDs
 	}
-	return activeGameIDs
+	return activeGameIDs, nil
 }
 
-func (n *GameNetwork) GetBGN(gameKey, gameID string) (*bgn.Game, error) {
+func (n *GameNetwork) GetBGN(ctx context.Context, gameKey, gameID string) (*bgn.Game, error) {
 	hub, ok := n.hubs[gameKey]
 	if !ok {
 		return nil, ErrNoExistingGameKey(gameKey)
@@ -121,22 +205,15 @@ func (n *GameNetwork) GetBGN(gameKey, gameID string) (*bgn.Game, error) {
 	if _, ok := hub.builder.(bg.BoardGameWithBGNBuilder); !ok {
 		return nil, ErrBGNUnsupported(gameKey)
 	}
-	if _, ok := hub.games[gameID]; !ok {
-		gameData, err := n.gameStore.GetGame(gameKey, gameID)
-		if err != nil {
-			return nil, ErrNoExistingGameID(gameKey, gameID)
-		}
-		if err := hub.Create(CreateGameOptions{
-			NetworkOptions: &NetworkingCreateGameOptions{
-				GameKey: gameKey,
-				GameID:  gameID,
-			},
-			GameData: gameData,
-		}); err != nil {
-			return nil, err
-		}
+	server, err := n.server(ctx, hub, gameID)
+	if err != nil {
+		return nil, err
 	}
-	return hub.games[gameID].game.(bg.BoardGameWithBGN).GetBGN(), nil
+	var game *bgn.Game
+	if err := server.do(ctx, func() { game = server.game.(bg.BoardGameWithBGN).GetBGN() }); err != nil {
+		return nil, err
+	}
+	return game, nil
 }
 
 func (n *GameNetwork) GetGames() []string {
@@ -147,27 +224,139 @@ func (n *GameNetwork) GetGames() []string {
 	return games
 }
 
-func (n *GameNetwork) GetSnapshot(gameKey, gameID string, team ...string) (interface{}, error) {
+func (n *GameNetwork) GetSnapshot(ctx context.Context, gameKey, gameID string, team ...string) (interface{}, error) {
 	hub, ok := n.hubs[gameKey]
 	if !ok {
 		return nil, ErrNoExistingGameKey(gameKey)
 	}
-	if _, ok := hub.games[gameID]; !ok {
-		gameData, err := n.gameStore.GetGame(gameKey, gameID)
-		if err != nil {
-			return nil, err
+	server, err := n.server(ctx, hub, gameID)
+	if err != nil {
+		return nil, err
+	}
+	var snapshot *bg.BoardGameSnapshot
+	if doErr := server.do(ctx, func() { snapshot, err = server.game.GetSnapshot(team...) }); doErr != nil {
+		return nil, doErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// GetSummary returns a summary of the game loading it from the game store if it is not in memory
+func (n *GameNetwork) GetSummary(ctx context.Context, gameKey, gameID string) (*GameSummary, error) {
+	hub, ok := n.hubs[gameKey]
+	if !ok {
+		return nil, ErrNoExistingGameKey(gameKey)
+	}
+	server, err := n.server(ctx, hub, gameID)
+	if err != nil {
+		return nil, err
+	}
+	var summary *GameSummary
+	if err := server.do(ctx, func() { summary = server.summary() }); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// server returns the running game server loading the game from the game store if it is not in memory
+func (n *GameNetwork) server(ctx context.Context, hub *gameHub, gameID string) (*gameServer, error) {
+	gameKey := hub.builder.Key()
+	if server, err := hub.server(ctx, gameID); err == nil {
+		return server, nil
+	}
+	gameData, err := n.gameStore.GetGame(ctx, gameKey, gameID)
+	if errors.Is(err, datastore.ErrGameStoreNotFound) || errors.Is(err, datastore.ErrGameStoreNotEnabled) {
+		return nil, ErrNoExistingGameID(gameKey, gameID)
+	} else if err != nil {
+		// the game store being unavailable is not the game missing
+		return nil, fmt.Errorf("failed to load gameID '%s' for gameKey '%s': %w", gameID, gameKey, err)
+	}
+	if err := hub.Create(ctx, CreateGameOptions{
+		NetworkOptions: &NetworkingCreateGameOptions{
+			GameKey: gameKey,
+			GameID:  gameID,
+		},
+		GameData: gameData,
+	}); err != nil {
+		// the game may have been loaded concurrently by another request
+		if server, serverErr := hub.server(ctx, gameID); serverErr == nil {
+			return server, nil
 		}
-		if err := hub.Create(CreateGameOptions{
-			NetworkOptions: &NetworkingCreateGameOptions{
-				GameKey: gameKey,
-				GameID:  gameID,
-			},
-			GameData: gameData,
+		return nil, err
+	}
+	return hub.server(ctx, gameID)
+}
+
+// Drain stops new games from being created and tells all players the server is restarting
+func (n *GameNetwork) Drain(ctx context.Context, reconnectAfter time.Duration) error {
+	n.draining.Store(true)
+	for _, hub := range n.hubs {
+		var servers []*gameServer
+		if err := hub.do(ctx, func() {
+			hub.draining = true
+			for _, server := range hub.games {
+				servers = append(servers, server)
+			}
 		}); err != nil {
-			return nil, err
+			return err
+		}
+		for _, server := range servers {
+			if err := server.do(ctx, func() { server.drain(reconnectAfter) }); err != nil && err != ErrGameClosed {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CheckHubs checks that every hub loop responds before the context is done
+func (n *GameNetwork) CheckHubs(ctx context.Context) map[string]*HubCheck {
+	type result struct {
+		gameKey string
+		check   *HubCheck
+	}
+	results := make(chan result, len(n.hubs))
+	for gameKey, hub := range n.hubs {
+		go func(gameKey string, hub *gameHub) {
+			start := time.Now()
+			err := hub.do(ctx, func() {})
+			results <- result{gameKey, &HubCheck{Latency: time.Since(start), Err: err}}
+		}(gameKey, hub)
+	}
+	checks := make(map[string]*HubCheck)
+	for range n.hubs {
+		r := <-results
+		checks[r.gameKey] = r.check
+	}
+	return checks
+}
+
+// Draining returns whether the network has started draining
+func (n *GameNetwork) Draining() bool {
+	return n.draining.Load()
+}
+
+// Active returns the number of games still being played i.e. with connected players that have acted within idle and no winner
+func (n *GameNetwork) Active(ctx context.Context, idle time.Duration) (int, error) {
+	active := 0
+	for _, hub := range n.hubs {
+		servers, err := hub.servers(ctx)
+		if err != nil {
+			return 0, err
+		}
+		for _, server := range servers {
+			paused := true
+			if err := server.do(ctx, func() { paused = server.paused(idle) }); err != nil && err != ErrGameClosed {
+				return 0, err
+			}
+			if !paused {
+				active++
+			}
 		}
 	}
-	return hub.games[gameID].game.GetSnapshot(team...)
+	return active, nil
 }
 
 func (n *GameNetwork) Close(ctx context.Context) error {
@@ -178,7 +367,7 @@ func (n *GameNetwork) Close(ctx context.Context) error {
 			logger.Log.Error().Caller().Err(err).Msgf("failed to store '%s' hub", gameKey)
 			errored = true
 		}
-		if err := hub.Close(); err != nil {
+		if err := hub.Close(ctx); err != nil {
 			logger.Log.Error().Caller().Err(err).Msgf("failed to close '%s' hub", gameKey)
 			errored = true
 		}
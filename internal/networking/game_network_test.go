@@ -0,0 +1,346 @@
+package go_boardgame_networking
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	bg "github.com/quibbble/go-boardgame"
+	"github.com/quibbble/go-quibbble/internal/datastore"
+	tictactoe "github.com/quibbble/go-tictactoe"
+)
+
+// testTransport is an in memory transport whose messages from the player are sent on inbound
+type testTransport struct {
+	inbound chan []byte
+	done    chan struct{}
+	once    sync.Once
+}
+
+func newTestTransport() *testTransport {
+	return &testTransport{inbound: make(chan []byte), done: make(chan struct{})}
+}
+
+func (t *testTransport) Read() (int, []byte, error) {
+	select {
+	case payload := <-t.inbound:
+		return 1, payload, nil
+	case <-t.done:
+		return 0, nil, ErrTransportClosed
+	}
+}
+
+func (t *testTransport) Write(int, []byte) error {
+	select {
+	case <-t.done:
+		return ErrTransportClosed
+	default:
+	}
+	return nil
+}
+
+func (t *testTransport) Ping() error { return nil }
+
+func (t *testTransport) Close() error {
+	t.once.Do(func() { close(t.done) })
+	return nil
+}
+
+func (t *testTransport) Configure(ConnectionOptions) {}
+
+func (t *testTransport) Name() string { return "test" }
+
+// send passes the action to the player's read pump returning false if the transport closed first
+func (t *testTransport) send(actionType string, details interface{}) bool {
+	payload, _ := json.Marshal(bg.BoardGameAction{ActionType: actionType, MoreDetails: details})
+	select {
+	case t.inbound <- payload:
+		return true
+	case <-t.done:
+		return false
+	case <-time.After(time.Second):
+		return false
+	}
+}
+
+// newTestNetwork returns a network of tic-tac-toe games checked for expiry every few milliseconds
+// games are not stored unless a game store is given
+func newTestNetwork(t *testing.T, gameExpiry time.Duration, gameStore datastore.GameStore) *GameNetwork {
+	t.Helper()
+	if gameStore == nil {
+		var err error
+		if gameStore, err = datastore.NewCockroachClient(&datastore.CockroachConfig{}); err != nil {
+			t.Fatalf("failed to create game store: %s", err)
+		}
+	}
+	network := NewGameNetwork(GameNetworkOptions{
+		Games:      []bg.BoardGameBuilder{&tictactoe.Builder{}},
+		GameExpiry: gameExpiry,
+		GameStore:  gameStore,
+	})
+	for _, hub := range network.hubs {
+		hub.expiry.Reset(5 * time.Millisecond)
+	}
+	t.Cleanup(func() { _ = network.Close(context.Background()) })
+	return network
+}
+
+// expected returns whether the error is one caused by games expiring or being created concurrently
+func expected(err error) bool {
+	for _, code := range []string{CodeGameNotFound, CodeGameExists, CodeGameClosed, CodeAlreadyConnected, CodeTransportClosed} {
+		if errors.Is(err, &Error{Code: code}) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestGameNetworkConcurrentAccess(t *testing.T) {
+	const (
+		games    = 8
+		duration = 500 * time.Millisecond
+	)
+	network := newTestNetwork(t, 50*time.Millisecond, nil)
+	gameKey := (&tictactoe.Builder{}).Key()
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		failures []error
+		created  atomic.Int64
+		joined   atomic.Int64
+	)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failures = append(failures, err)
+	}
+	run := func(fn func(gameID string) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				gameID := fmt.Sprintf("game-%d", rand.Intn(games))
+				if err := fn(gameID); err != nil && !expected(err) && ctx.Err() == nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+
+	// games are created over and over as they expire
+	for i := 0; i < 2; i++ {
+		run(func(gameID string) error {
+			err := network.CreateGame(ctx, CreateGameOptions{
+				NetworkOptions: &NetworkingCreateGameOptions{GameKey: gameKey, GameID: gameID, OnConflict: OnConflictLoad},
+				GameOptions:    &bg.BoardGameOptions{Teams: []string{"red", "blue"}},
+			})
+			if err == nil {
+				created.Add(1)
+			}
+			time.Sleep(time.Millisecond)
+			return err
+		})
+	}
+
+	// players join, take a team and mark locations until their game expires
+	for i := 0; i < 4; i++ {
+		player := i
+		run(func(gameID string) error {
+			transport := newTestTransport()
+			defer transport.Close()
+			if err := network.JoinGame(ctx, JoinGameOptions{
+				GameKey:    gameKey,
+				GameID:     gameID,
+				PlayerID:   fmt.Sprintf("player-%d", player),
+				PlayerName: fmt.Sprintf("player-%d", player),
+				Transport:  transport,
+			}); err != nil {
+				return err
+			}
+			joined.Add(1)
+			if !transport.send(ServerActionSetOpenTeam, nil) {
+				return nil
+			}
+			for j := 0; j < 5 && ctx.Err() == nil; j++ {
+				details := tictactoe.MarkLocationActionDetails{Row: rand.Intn(3), Column: rand.Intn(3)}
+				if !transport.send(tictactoe.ActionMarkLocation, details) {
+					return nil
+				}
+			}
+			return nil
+		})
+	}
+
+	// readers query every game while it is created, played and expired
+	run(func(string) error {
+		stats, err := network.GetStats(ctx)
+		if err == nil && stats.ActiveGames[gameKey] > games {
+			return fmt.Errorf("got %d active games, want at most %d", stats.ActiveGames[gameKey], games)
+		}
+		return err
+	})
+	run(func(string) error {
+		gameIDs, err := network.GetActiveGameIDs(ctx)
+		if err == nil && len(gameIDs[gameKey]) > games {
+			return fmt.Errorf("got %d active game ids, want at most %d", len(gameIDs[gameKey]), games)
+		}
+		return err
+	})
+	run(func(gameID string) error {
+		_, err := network.GetSnapshot(ctx, gameKey, gameID, "red")
+		return err
+	})
+	run(func(gameID string) error {
+		_, err := network.GetBGN(ctx, gameKey, gameID)
+		return err
+	})
+
+	wg.Wait()
+	for _, err := range failures {
+		t.Error(err)
+	}
+	if created.Load() == 0 || joined.Load() == 0 {
+		t.Fatalf("got %d games created and %d players joined, want both to be more than zero", created.Load(), joined.Load())
+	}
+
+	// every game expires once it is no longer played
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		gameIDs, err := network.GetActiveGameIDs(context.Background())
+		if err != nil {
+			t.Fatalf("failed to get active game ids: %s", err)
+		}
+		if len(gameIDs[gameKey]) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got active games %v, want every game to have expired", gameIDs[gameKey])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGameNetworkCreateGameReplace(t *testing.T) {
+	gameStore := datastore.NewMemoryGameStore()
+	network := newTestNetwork(t, time.Minute, gameStore)
+	ctx := context.Background()
+	gameKey := (&tictactoe.Builder{}).Key()
+	create := func(onConflict string) error {
+		return network.CreateGame(ctx, CreateGameOptions{
+			NetworkOptions: &NetworkingCreateGameOptions{GameKey: gameKey, GameID: "example", OnConflict: onConflict},
+			GameOptions:    &bg.BoardGameOptions{Teams: []string{"red", "blue"}},
+		})
+	}
+	if err := create(""); err != nil {
+		t.Fatalf("failed to create game: %s", err)
+	}
+	if err := create(""); !errors.Is(err, &Error{Code: CodeGameExists}) {
+		t.Fatalf("got %v creating a running game without on conflict, want %s", err, CodeGameExists)
+	}
+
+	transport := newTestTransport()
+	defer transport.Close()
+	if err := network.JoinGame(ctx, JoinGameOptions{GameKey: gameKey, GameID: "example", PlayerName: "player", Transport: transport}); err != nil {
+		t.Fatalf("failed to join game: %s", err)
+	}
+	if !transport.send(ServerActionSetTeam, map[string]string{"Team": "red"}) {
+		t.Fatalf("failed to set team")
+	}
+	mark, _ := json.Marshal(bg.BoardGameAction{Team: "red", ActionType: tictactoe.ActionMarkLocation, MoreDetails: tictactoe.MarkLocationActionDetails{Row: 1, Column: 1}})
+	transport.inbound <- mark
+	// actions are played by the game server after they are read so wait for the mark
+	deadline := time.Now().Add(time.Second)
+	for {
+		game, err := network.GetBGN(ctx, gameKey, "example")
+		if err != nil {
+			t.Fatalf("failed to get bgn: %s", err)
+		}
+		if len(game.Actions) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d actions, want the mark to be played", len(game.Actions))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := create(OnConflictReplace); err != nil {
+		t.Fatalf("failed to replace game: %s", err)
+	}
+	stored, err := gameStore.GetGame(ctx, gameKey, "example")
+	if err != nil {
+		t.Fatalf("got %v, want the replaced game to have been stored", err)
+	}
+	if len(stored.BGN.Actions) != 1 {
+		t.Errorf("got %d stored actions, want 1", len(stored.BGN.Actions))
+	}
+	game, err := network.GetBGN(ctx, gameKey, "example")
+	if err != nil {
+		t.Fatalf("failed to get bgn: %s", err)
+	}
+	if len(game.Actions) != 0 {
+		t.Errorf("got %d actions, want the new game to have none", len(game.Actions))
+	}
+}
+
+// failingGameStore fails to read any game as if the game store were down
+type failingGameStore struct {
+	*datastore.MemoryGameStore
+}
+
+func (s *failingGameStore) GetGame(context.Context, string, string) (*datastore.Game, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestGameNetworkGameStoreErrors(t *testing.T) {
+	ctx := context.Background()
+	gameKey := (&tictactoe.Builder{}).Key()
+	for _, test := range []struct {
+		name      string
+		gameStore datastore.GameStore
+		notFound  bool
+	}{
+		{"missing game", datastore.NewMemoryGameStore(), true},
+		{"disabled game store", nil, true},
+		{"unavailable game store", &failingGameStore{datastore.NewMemoryGameStore()}, false},
+	} {
+		network := newTestNetwork(t, time.Minute, test.gameStore)
+		_, err := network.GetBGN(ctx, gameKey, "missing")
+		if err == nil {
+			t.Fatalf("got no error getting a game with a %s", test.name)
+		}
+		if notFound := errors.Is(err, &Error{Code: CodeGameNotFound}); notFound != test.notFound {
+			t.Errorf("got %v getting a game with a %s, want not found %t", err, test.name, test.notFound)
+		}
+	}
+}
+
+func TestGameNetworkHubRecovers(t *testing.T) {
+	network := newTestNetwork(t, time.Minute, nil)
+	ctx := context.Background()
+	gameKey := (&tictactoe.Builder{}).Key()
+	if err := network.CreateGame(ctx, CreateGameOptions{
+		NetworkOptions: &NetworkingCreateGameOptions{GameKey: gameKey, GameID: "example"},
+		GameOptions:    &bg.BoardGameOptions{Teams: []string{"red", "blue"}},
+	}); err != nil {
+		t.Fatalf("failed to create game: %s", err)
+	}
+
+	hub := network.hubs[gameKey]
+	if err := hub.do(ctx, func() { panic("bug in hub") }); !errors.Is(err, &Error{Code: CodeRestarted}) {
+		t.Fatalf("got %v from a request that panicked, want %s", err, CodeRestarted)
+	}
+	// the hub is restarted with the game it held
+	if _, err := network.GetSummary(ctx, gameKey, "example"); err != nil {
+		t.Fatalf("got %v getting the game once the hub restarted, want it recovered", err)
+	}
+}
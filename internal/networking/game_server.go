@@ -1,7 +1,9 @@
 package go_boardgame_networking
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"math/rand"
 	"runtime/debug"
 	"strconv"
@@ -11,8 +13,13 @@ import (
 	"github.com/mitchellh/mapstructure"
 	bg "github.com/quibbble/go-boardgame"
 	"github.com/quibbble/go-boardgame/pkg/bgn"
+	"github.com/quibbble/go-quibbble/internal/datastore"
+	"github.com/quibbble/go-quibbble/internal/metrics"
 	"github.com/quibbble/go-quibbble/pkg/logger"
 	"github.com/quibbble/go-quibbble/pkg/timer"
+	"github.com/quibbble/go-quibbble/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Actions that if sent are performed in the server and not sent down to the game level
@@ -23,8 +30,36 @@ const (
 	ServerActionUndo        = "Undo"
 	ServerActionResign      = "Resign"
 	ServerActionChat        = "Chat"
+	ServerActionAck         = "Ack"
+	ServerActionResync      = "Resync"
 )
 
+// storeTimeout bounds how long a game or playthrough may take to be stored in the background
+const storeTimeout = 10 * time.Second
+
+var serverActions = []string{
+	ServerActionSetTeam,
+	ServerActionSetOpenTeam,
+	ServerActionReset,
+	ServerActionUndo,
+	ServerActionResign,
+	ServerActionChat,
+	ServerActionAck,
+	ServerActionResync,
+}
+
+// request is run inside a hub or server loop with the result sent on errCh
+type request struct {
+	fn    func()
+	errCh chan error
+}
+
+// joinRequest asks the server to add a player with the result sent on errCh
+type joinRequest struct {
+	player *player
+	errCh  chan error
+}
+
 // gameServer handles all the processing of messages from players for a single game instance
 type gameServer struct {
 	options       *NetworkingCreateGameOptions
@@ -35,19 +70,29 @@ type gameServer struct {
 	builder       bg.BoardGameBuilder
 	game          bg.BoardGame
 	playCount     int // number of time a game has been completed on this game server
+	completedAt   time.Time
+	participants  map[string]string // mapping from player name to team for players that acted in the current playthrough
 	timer         *timer.Timer
 	alarm         chan bool
 	players       map[*player]string
 	chat          []*ChatMessage
-	join          chan *player
+	join          chan *joinRequest
 	leave         chan *player
 	process       chan *message
-	errCh         chan error
+	requests      chan *request
+	inflight      chan error // reply channel of the request being handled so it can be failed if the loop panics
 	stop          chan interface{}
+	done          chan struct{}              // closed once the server loop has stopped
+	readOnly      bool                       // only chat is allowed while in maintenance mode
+	closing       bool                       // no actions or joins are accepted once the game's data has been read to be stored and closed
+	restarting    *outboundRestartingMessage // sent to every player while the server is draining
 	adapters      []NetworkAdapter
+	gameStore     datastore.GameStore
+	limits        LimitOptions
+	connection    ConnectionOptions
 }
 
-func newServer(builder bg.BoardGameBuilder, options *CreateGameOptions, adapters []NetworkAdapter) (*gameServer, error) {
+func newServer(builder bg.BoardGameBuilder, options *CreateGameOptions, adapters []NetworkAdapter, gameStore datastore.GameStore, limits LimitOptions, connection ConnectionOptions) (*gameServer, error) {
 	gameKey, gameID := builder.Key(), options.NetworkOptions.GameID
 
 	var clock *timer.Timer
@@ -67,19 +112,24 @@ func newServer(builder bg.BoardGameBuilder, options *CreateGameOptions, adapters
 		initializedAt: time.Now().UTC(),
 		createdAt:     time.Now().UTC(),
 		updatedAt:     time.Now().UTC(),
+		participants:  make(map[string]string),
 		players:       make(map[*player]string),
 		chat:          make([]*ChatMessage, 0),
-		join:          make(chan *player),
+		join:          make(chan *joinRequest),
 		leave:         make(chan *player),
 		process:       make(chan *message),
-		errCh:         make(chan error),
+		requests:      make(chan *request),
 		stop:          make(chan interface{}),
+		done:          make(chan struct{}),
 		adapters:      adapters,
+		gameStore:     gameStore,
+		limits:        limits,
+		connection:    connection,
 	}
 	if options.GameOptions != nil {
 		game, err := builder.Create(options.GameOptions)
 		if err != nil {
-			return nil, err
+			return nil, withCode(CodeInvalidOptions, err)
 		}
 		server.game = game
 		server.create = options
@@ -91,7 +141,7 @@ func newServer(builder bg.BoardGameBuilder, options *CreateGameOptions, adapters
 		if options.BGN != nil {
 			game, err := bgnBuilder.Load(options.BGN)
 			if err != nil {
-				return nil, err
+				return nil, withCode(CodeInvalidOptions, err)
 			}
 			server.game = game
 			server.create = options
@@ -112,55 +162,54 @@ func newServer(builder bg.BoardGameBuilder, options *CreateGameOptions, adapters
 	return server, nil
 }
 
-func (s *gameServer) Start(cleanup chan string) {
-	gameID := s.create.NetworkOptions.GameID
-	// catch any panics and close the game out gracefully
+// Start runs the server loop restarting it from the game's last good state whenever it panics
+// if the game cannot be recovered it is closed out and removed from the hub
+func (s *gameServer) Start(cleanup chan<- string) {
+	gameKey, gameID := s.builder.Key(), s.create.NetworkOptions.GameID
+	for s.run() {
+		if err := s.restore(); err != nil {
+			logger.Log.Error().Caller().Err(err).Msgf(ErrGameCrashed(gameKey, gameID).Error())
+			for player := range s.players {
+				s.sendErrorMessage(player, ErrGameCrashed(gameKey, gameID))
+				_ = player.Close()
+			}
+			close(s.done)
+			// the hub may be waiting on this server so must not be blocked on
+			go func() { cleanup <- gameID }()
+			return
+		}
+		logger.Log.Info().Msgf("restarted game server with key '%s' and id '%s'", gameKey, gameID)
+	}
+}
+
+// run handles server requests until the loop is stopped returning whether it panicked instead
+func (s *gameServer) run() (panicked bool) {
+	gameKey, gameID := s.builder.Key(), s.create.NetworkOptions.GameID
+	// catch any panics and fail the in-flight request
 	// prevents the server from crashing due to bugs in a game
 	defer func() {
 		if r := recover(); r != nil {
-			logger.Log.Error().Caller().Msgf("%v from game key '%s' and id '%s' and stack trace %s", r, s.options.GameKey, s.options.GameID, string(debug.Stack()))
-			cleanup <- gameID
-			s.loop(true) // restart the server loop to allow for graceful game closure
+			logger.Log.Error().Caller().Msgf("%v from game key '%s' and id '%s' and stack trace %s", r, gameKey, gameID, string(debug.Stack()))
+			metrics.GamePanics.WithLabelValues(gameKey).Inc()
+			if s.inflight != nil {
+				s.inflight <- ErrRequestFailed(gameKey, gameID)
+				s.inflight = nil
+			}
+			panicked = true
 		}
 	}()
-
-	s.loop(false)
+	s.loop()
+	return false
 }
 
-func (s *gameServer) loop(errored bool) {
+func (s *gameServer) loop() {
 	gameKey, gameID := s.builder.Key(), s.create.NetworkOptions.GameID
 	for {
 		select {
-		case player := <-s.join:
-			if errored {
-				continue
-			}
-			if _, ok := s.players[player]; ok {
-				s.errCh <- ErrPlayerAlreadyConnected(gameKey, gameID)
-				continue
-			}
-			if len(s.options.Players) > 0 {
-				found := false
-				for team, players := range s.options.Players {
-					if contains(players, player.playerID) {
-						s.players[player] = team
-						found = true
-						break
-					}
-				}
-				if !found {
-					s.errCh <- ErrPlayerUnauthorized(gameKey, gameID)
-					continue
-				}
-			} else {
-				s.players[player] = ""
-			}
-			s.sendNetworkMessage(player)
-			s.sendGameMessage(player)
-			for player := range s.players {
-				s.sendConnectedMessage(player)
-			}
-			s.errCh <- nil
+		case join := <-s.join:
+			s.inflight = join.errCh
+			join.errCh <- s.addPlayer(join.player)
+			s.inflight = nil
 		case player := <-s.leave:
 			delete(s.players, player)
 			player.Close()
@@ -168,226 +217,23 @@ func (s *gameServer) loop(errored bool) {
 				s.sendConnectedMessage(player)
 			}
 		case message := <-s.process:
-			if errored {
-				continue
-			}
-			s.updatedAt = time.Now().UTC()
-			oldSnapshot, _ := s.game.GetSnapshot()
-			var action bg.BoardGameAction
-			if err := json.Unmarshal(message.payload, &action); err != nil {
-				s.sendErrorMessage(message.player, err)
-				continue
-			}
-			// try server action
-			switch action.ActionType {
-			case ServerActionSetTeam:
-				if len(s.options.Players) > 0 {
-					s.sendErrorMessage(message.player, ErrActionNotAllowed(action.ActionType))
-					continue
-				}
-				var details struct {
-					Team string
-				}
-				if err := mapstructure.Decode(action.MoreDetails, &details); err != nil {
-					s.sendErrorMessage(message.player, err)
-					continue
-				}
-				if !contains(oldSnapshot.Teams, details.Team) {
-					s.sendErrorMessage(message.player, ErrInvalidTeam)
-					continue
-				}
-				s.players[message.player] = details.Team
-				s.sendGameMessage(message.player)
-				for player := range s.players {
-					s.sendConnectedMessage(player)
-				}
-				continue
-			case ServerActionSetOpenTeam:
-				if len(s.options.Players) > 0 {
-					s.sendErrorMessage(message.player, ErrActionNotAllowed(action.ActionType))
-					continue
-				}
-				if s.players[message.player] != "" {
-					s.sendErrorMessage(message.player, ErrAlreadyInTeam)
-					continue
-				}
-				openTeams := append([]string{}, oldSnapshot.Teams...)
-				for _, team := range s.players {
-					for i, other := range openTeams {
-						if other == team {
-							openTeams = append(openTeams[:i], openTeams[i+1:]...)
-							break
-						}
-					}
-				}
-				if len(openTeams) <= 0 {
-					s.sendErrorMessage(message.player, ErrNoOpenTeam)
-					continue
-				}
-				s.players[message.player] = openTeams[0]
-				s.sendGameMessage(message.player)
-				for player := range s.players {
-					s.sendConnectedMessage(player)
-				}
-				continue
-			case ServerActionChat:
-				if len(s.chat) >= 250 {
-					s.sendErrorMessage(message.player, ErrMaxChat)
-					continue
-				}
-				var details struct {
-					Msg string
-				}
-				if err := mapstructure.Decode(action.MoreDetails, &details); err != nil {
-					s.sendErrorMessage(message.player, err)
-					continue
-				}
-				s.chat = append(s.chat, &ChatMessage{
-					Name: message.player.playerName,
-					Msg:  details.Msg,
-				})
-				for player := range s.players {
-					s.sendChatMessage(player)
-				}
-				continue
-			case ServerActionUndo:
-				if len(s.options.Players) > 0 {
-					s.sendErrorMessage(message.player, ErrActionNotAllowed(action.ActionType))
-					continue
-				}
-				if len(oldSnapshot.Actions) == 0 {
-					s.sendErrorMessage(message.player, ErrNoActionToUndo)
-					continue
-				}
-				if s.timer != nil {
-					s.timer.Stop()
-				}
-				var game bg.BoardGame
-				var err error
-				if s.create.GameOptions != nil {
-					game, err = s.builder.Create(s.create.GameOptions)
-				} else {
-					bgnBuilder, ok := s.builder.(bg.BoardGameWithBGNBuilder)
-					if !ok {
-						logger.Log.Error().Caller().Err(ErrBGNUnsupported(gameKey))
-						continue
-					}
-					if s.create.BGN != nil {
-						game, err = bgnBuilder.Load(&bgn.Game{
-							Tags: s.create.BGN.Tags,
-						})
-					} else if s.create.GameData != nil {
-						game, err = bgnBuilder.Load(&bgn.Game{
-							Tags: s.create.GameData.BGN.Tags,
-						})
-					} else {
-						logger.Log.Error().Msg("missing create options in undo")
-						continue
-					}
-				}
-				if err != nil {
-					logger.Log.Error().Err(err).Msg("undo action error")
-					continue
-				}
-				var failed bool
-				for _, action := range oldSnapshot.Actions[:len(oldSnapshot.Actions)-1] {
-					if err = game.Do(action); err != nil {
-						logger.Log.Error().Err(err).Msg("undo action error")
-						failed = true
-						break
-					}
-				}
-				if failed {
-					continue
-				}
-				s.game = game
-				for player := range s.players {
-					s.sendGameMessage(player)
-				}
-				continue
-			case ServerActionResign:
-				if len(s.options.Players) == 0 {
-					s.sendErrorMessage(message.player, ErrActionNotAllowed(action.ActionType))
-					continue
-				}
-				// todo add resign field to server and do random action for resigned player if it is their turn
-				continue
-			case ServerActionReset:
-				seed := int(time.Now().Unix())
-				var game bg.BoardGame
-				var err error
-				if s.create.GameOptions != nil {
-					options, ok := s.create.GameOptions.MoreOptions.(map[string]interface{})
-					if ok {
-						options[bgn.SeedTag] = seed
-						game, err = s.builder.Create(&bg.BoardGameOptions{
-							Teams:       s.create.GameOptions.Teams,
-							MoreOptions: options,
-						})
-						s.create.GameOptions.MoreOptions = options
-					} else {
-						game, err = s.builder.Create(s.create.GameOptions)
-					}
-				} else {
-					bgnBuilder, ok := s.builder.(bg.BoardGameWithBGNBuilder)
-					if !ok {
-						logger.Log.Error().Caller().Err(ErrBGNUnsupported(gameKey))
-						continue
-					}
-					if s.create.BGN != nil {
-						tags := s.create.BGN.Tags
-						tags[bgn.SeedTag] = strconv.Itoa(seed)
-						game, err = bgnBuilder.Load(&bgn.Game{Tags: tags})
-						s.create.BGN.Tags = tags
-					} else if s.create.GameData != nil {
-						tags := s.create.GameData.BGN.Tags
-						tags[bgn.SeedTag] = strconv.Itoa(seed)
-						game, err = bgnBuilder.Load(&bgn.Game{Tags: tags})
-						s.create.GameData.BGN.Tags = tags
-					} else {
-						logger.Log.Error().Msg("missing create options in undo")
-						continue
-					}
-				}
-				if err != nil {
-					logger.Log.Error().Err(err).Msg("game reset error")
-					continue
-				}
-				s.game = game
-				for player := range s.players {
-					s.sendGameMessage(player)
-				}
+			if message.err != nil {
+				s.sendReplyMessage(message.player, message.requestID, message.err)
 				continue
-			default:
-				// board game action
-				if s.players[message.player] != action.Team {
-					s.sendErrorMessage(message.player, ErrWrongTeamAction)
-					continue
-				}
-				if err := s.game.Do(&action); err != nil {
-					s.sendErrorMessage(message.player, err)
-					continue
-				}
-				snapshot, _ := s.game.GetSnapshot()
-				if len(snapshot.Winners) > 0 {
-					s.playCount++
-					for _, adapter := range s.adapters {
-						adapter.OnGameEnd(snapshot, s.options)
-					}
-				}
-				if s.timer != nil {
-					if len(snapshot.Winners) > 0 {
-						s.timer.Stop()
-					} else if oldSnapshot.Turn != snapshot.Turn {
-						s.timer.Start()
-					}
-				}
-				for player := range s.players {
-					s.sendGameMessage(player)
-				}
 			}
+			start := time.Now()
+			_, span := tracing.Tracer.Start(context.Background(), "game.action", trace.WithAttributes(
+				attribute.String("game_key", gameKey),
+				attribute.String("game_id", gameID),
+			))
+			kind, err := s.handle(message)
+			s.sendReplyMessage(message.player, message.requestID, err)
+			span.SetAttributes(attribute.String("kind", kind))
+			span.End()
+			metrics.Actions.WithLabelValues(gameKey, kind).Inc()
+			metrics.ActionDuration.WithLabelValues(gameKey, kind).Observe(time.Since(start).Seconds())
 		case <-s.alarm:
-			if errored {
+			if s.closing {
 				continue
 			}
 			// do random action(s) for player if time runs out
@@ -405,8 +251,18 @@ func (s *gameServer) loop(errored bool) {
 			for len(snapshot.Winners) == 0 && turn == snapshot.Turn {
 				action := targets[rand.Intn(len(targets))]
 				_ = s.game.Do(action)
+				metrics.RandomActions.WithLabelValues(gameKey).Inc()
 				snapshot, _ = s.game.GetSnapshot()
 			}
+			// the players whose turn timed out took part through the random actions done for them
+			for player, team := range s.players {
+				if !player.watcher && team == turn {
+					s.participants[player.playerName] = team
+				}
+			}
+			if len(snapshot.Winners) > 0 {
+				s.complete(snapshot)
+			}
 			if s.timer != nil {
 				if len(snapshot.Winners) > 0 {
 					s.timer.Stop()
@@ -417,21 +273,508 @@ func (s *gameServer) loop(errored bool) {
 			for player := range s.players {
 				s.sendGameMessage(player)
 			}
+		case req := <-s.requests:
+			s.inflight = req.errCh
+			req.fn()
+			req.errCh <- nil
+			s.inflight = nil
 		case <-s.stop:
+			for player := range s.players {
+				if err := player.Close(); err != nil {
+					logger.Log.Error().Caller().Err(err)
+				}
+			}
+			close(s.done)
 			return
 		}
 	}
 }
 
+// handle processes a message from a player and returns the kind of action performed and any error to send back
+func (s *gameServer) handle(message *message) (kind string, err error) {
+	gameKey, gameID := s.builder.Key(), s.create.NetworkOptions.GameID
+	kind = "Invalid"
+	oldSnapshot, _ := s.game.GetSnapshot()
+	var action bg.BoardGameAction
+	if err := json.Unmarshal(message.payload, &action); err != nil {
+		return kind, withCode(CodeInvalidMessage, err)
+	}
+	// board game actions are grouped together as their types are only known to each game
+	kind = "Game"
+	if contains(serverActions, action.ActionType) {
+		kind = action.ActionType
+	}
+	if message.player.watcher {
+		return kind, ErrActionNotAllowed(action.ActionType)
+	}
+	if s.closing && action.ActionType != ServerActionAck && action.ActionType != ServerActionResync {
+		return kind, ErrGameClosed
+	}
+	if s.readOnly && action.ActionType != ServerActionChat && action.ActionType != ServerActionAck && action.ActionType != ServerActionResync {
+		return kind, ErrReadOnly
+	}
+	// try server action
+	switch action.ActionType {
+	case ServerActionSetTeam:
+		if len(s.options.Players) > 0 {
+			return kind, ErrActionNotAllowed(action.ActionType)
+		}
+		var details struct {
+			Team string
+		}
+		if err := mapstructure.Decode(action.MoreDetails, &details); err != nil {
+			return kind, withCode(CodeInvalidMessage, err)
+		}
+		if !contains(oldSnapshot.Teams, details.Team) {
+			return kind, ErrInvalidTeam
+		}
+		s.players[message.player] = details.Team
+		s.sendGameMessage(message.player)
+		for player := range s.players {
+			s.sendConnectedMessage(player)
+		}
+	case ServerActionSetOpenTeam:
+		if len(s.options.Players) > 0 {
+			return kind, ErrActionNotAllowed(action.ActionType)
+		}
+		if s.players[message.player] != "" {
+			return kind, ErrAlreadyInTeam
+		}
+		openTeams := append([]string{}, oldSnapshot.Teams...)
+		for _, team := range s.players {
+			for i, other := range openTeams {
+				if other == team {
+					openTeams = append(openTeams[:i], openTeams[i+1:]...)
+					break
+				}
+			}
+		}
+		if len(openTeams) <= 0 {
+			return kind, ErrNoOpenTeam
+		}
+		s.players[message.player] = openTeams[0]
+		s.sendGameMessage(message.player)
+		for player := range s.players {
+			s.sendConnectedMessage(player)
+		}
+	case ServerActionChat:
+		if len(s.chat) >= 250 {
+			return kind, ErrMaxChat
+		}
+		var details struct {
+			Msg string
+		}
+		if err := mapstructure.Decode(action.MoreDetails, &details); err != nil {
+			return kind, withCode(CodeInvalidMessage, err)
+		}
+		s.chat = append(s.chat, &ChatMessage{
+			Name: message.player.playerName,
+			Msg:  details.Msg,
+		})
+		for player := range s.players {
+			s.sendChatMessage(player)
+		}
+	case ServerActionAck:
+		if message.player.patches == nil {
+			return kind, ErrActionNotAllowed(action.ActionType)
+		}
+		var details struct {
+			Seq int64
+		}
+		if err := mapstructure.Decode(action.MoreDetails, &details); err != nil {
+			return kind, withCode(CodeInvalidMessage, err)
+		}
+		if err := message.player.patches.ack(details.Seq); err != nil {
+			return kind, err
+		}
+	case ServerActionResync:
+		if message.player.patches == nil {
+			return kind, ErrActionNotAllowed(action.ActionType)
+		}
+		message.player.patches.resync()
+		s.sendGameMessage(message.player)
+	case ServerActionUndo:
+		if len(s.options.Players) > 0 {
+			return kind, ErrActionNotAllowed(action.ActionType)
+		}
+		if len(oldSnapshot.Actions) == 0 {
+			return kind, ErrNoActionToUndo
+		}
+		if s.timer != nil {
+			s.timer.Stop()
+		}
+		var game bg.BoardGame
+		if s.create.GameOptions != nil {
+			game, err = s.builder.Create(s.create.GameOptions)
+		} else {
+			bgnBuilder, ok := s.builder.(bg.BoardGameWithBGNBuilder)
+			if !ok {
+				logger.Log.Error().Caller().Err(ErrBGNUnsupported(gameKey))
+				return kind, ErrRequestFailed(gameKey, gameID)
+			}
+			if s.create.BGN != nil {
+				game, err = bgnBuilder.Load(&bgn.Game{
+					Tags: s.create.BGN.Tags,
+				})
+			} else if s.create.GameData != nil {
+				game, err = bgnBuilder.Load(&bgn.Game{
+					Tags: s.create.GameData.BGN.Tags,
+				})
+			} else {
+				logger.Log.Error().Msg("missing create options in undo")
+				return kind, ErrRequestFailed(gameKey, gameID)
+			}
+		}
+		if err != nil {
+			logger.Log.Error().Err(err).Msg("undo action error")
+			return kind, ErrRequestFailed(gameKey, gameID)
+		}
+		var failed bool
+		for _, action := range oldSnapshot.Actions[:len(oldSnapshot.Actions)-1] {
+			if err = game.Do(action); err != nil {
+				logger.Log.Error().Err(err).Msg("undo action error")
+				failed = true
+				break
+			}
+		}
+		if failed {
+			return kind, ErrRequestFailed(gameKey, gameID)
+		}
+		s.game = game
+		// undoing the winning action reopens the playthrough so winning again completes the same one
+		if len(oldSnapshot.Winners) > 0 {
+			s.playCount--
+			s.completedAt = time.Time{}
+		}
+		for player := range s.players {
+			s.sendGameMessage(player)
+		}
+	case ServerActionResign:
+		if len(s.options.Players) == 0 {
+			return kind, ErrActionNotAllowed(action.ActionType)
+		}
+		// todo add resign field to server and do random action for resigned player if it is their turn
+	case ServerActionReset:
+		if len(oldSnapshot.Winners) > 0 {
+			s.archive()
+		}
+		seed := int(time.Now().Unix())
+		var game bg.BoardGame
+		if s.create.GameOptions != nil {
+			options, ok := s.create.GameOptions.MoreOptions.(map[string]interface{})
+			if ok {
+				options[bgn.SeedTag] = seed
+				game, err = s.builder.Create(&bg.BoardGameOptions{
+					Teams:       s.create.GameOptions.Teams,
+					MoreOptions: options,
+				})
+				s.create.GameOptions.MoreOptions = options
+			} else {
+				game, err = s.builder.Create(s.create.GameOptions)
+			}
+		} else {
+			bgnBuilder, ok := s.builder.(bg.BoardGameWithBGNBuilder)
+			if !ok {
+				logger.Log.Error().Caller().Err(ErrBGNUnsupported(gameKey))
+				return kind, ErrRequestFailed(gameKey, gameID)
+			}
+			if s.create.BGN != nil {
+				tags := s.create.BGN.Tags
+				tags[bgn.SeedTag] = strconv.Itoa(seed)
+				game, err = bgnBuilder.Load(&bgn.Game{Tags: tags})
+				s.create.BGN.Tags = tags
+			} else if s.create.GameData != nil {
+				tags := s.create.GameData.BGN.Tags
+				tags[bgn.SeedTag] = strconv.Itoa(seed)
+				game, err = bgnBuilder.Load(&bgn.Game{Tags: tags})
+				s.create.GameData.BGN.Tags = tags
+			} else {
+				logger.Log.Error().Msg("missing create options in undo")
+				return kind, ErrRequestFailed(gameKey, gameID)
+			}
+		}
+		if err != nil {
+			logger.Log.Error().Err(err).Msg("game reset error")
+			return kind, ErrRequestFailed(gameKey, gameID)
+		}
+		s.game = game
+		s.participants = make(map[string]string)
+		// the timer stopped when the last playthrough was won so games with set players are timed from the start again
+		if s.timer != nil {
+			s.timer.Stop()
+			if len(s.options.Players) > 0 {
+				s.timer.Start()
+			}
+		}
+		for player := range s.players {
+			s.sendGameMessage(player)
+		}
+	default:
+		// board game action
+		if s.players[message.player] != action.Team {
+			return kind, ErrWrongTeamAction
+		}
+		if err := s.game.Do(&action); err != nil {
+			return kind, withCode(CodeInvalidAction, err)
+		}
+		s.participants[message.player.playerName] = action.Team
+		snapshot, _ := s.game.GetSnapshot()
+		if len(snapshot.Winners) > 0 {
+			s.complete(snapshot)
+		}
+		if s.timer != nil {
+			if len(snapshot.Winners) > 0 {
+				s.timer.Stop()
+			} else if oldSnapshot.Turn != snapshot.Turn {
+				s.timer.Start()
+			}
+		}
+		for player := range s.players {
+			s.sendGameMessage(player)
+		}
+	}
+	// only accepted actions count as activity and acks and resyncs are sent by clients without the player acting
+	// so neither rejected actions nor those stop an idle game from pausing or expiring
+	if action.ActionType != ServerActionAck && action.ActionType != ServerActionResync {
+		s.updatedAt = time.Now().UTC()
+	}
+	return kind, nil
+}
+
+// complete records the end of the current playthrough whether it was won by a player's action or one done when their time ran out
+func (s *gameServer) complete(snapshot *bg.BoardGameSnapshot) {
+	s.playCount++
+	s.completedAt = time.Now().UTC()
+	for _, adapter := range s.adapters {
+		adapter.OnGameEnd(snapshot, s.options)
+	}
+}
+
 func (s *gameServer) Close() {
 	gameKey, gameID := s.builder.Key(), s.create.NetworkOptions.GameID
 	logger.Log.Debug().Caller().Msgf("closing game server with key %s and id %s", gameKey, gameID)
+	select {
+	case s.stop <- true:
+	case <-s.done:
+	}
+}
+
+// do runs fn inside the server loop so it may safely access the server's game and players
+func (s *gameServer) do(ctx context.Context, fn func()) error {
+	req := &request{fn: fn, errCh: make(chan error, 1)}
+	select {
+	case s.requests <- req:
+	case <-s.done:
+		return ErrGameClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return <-req.errCh
+}
+
+// addPlayer adds the player to the game if they are allowed to join
+func (s *gameServer) addPlayer(player *player) error {
+	gameKey, gameID := s.builder.Key(), s.create.NetworkOptions.GameID
+	if s.closing {
+		return ErrGameClosed
+	}
+	if _, ok := s.players[player]; ok {
+		return ErrPlayerAlreadyConnected(gameKey, gameID)
+	}
+	if player.watcher {
+		// watchers are not announced to players as they do not take part in the game
+		if player.watchTeam != "" {
+			snapshot, _ := s.game.GetSnapshot()
+			if !contains(snapshot.Teams, player.watchTeam) {
+				return ErrInvalidTeam
+			}
+		}
+		s.players[player] = player.watchTeam
+		s.sendNetworkMessage(player)
+		s.sendGameMessage(player)
+		if s.restarting != nil {
+			s.sendRestartingMessage(player)
+		}
+		s.sendConnectedMessage(player)
+		return nil
+	}
+	if len(s.options.Players) > 0 {
+		found := false
+		for team, players := range s.options.Players {
+			if contains(players, player.playerID) {
+				s.players[player] = team
+				found = true
+				break
+			}
+		}
+		if !found {
+			return ErrPlayerUnauthorized(gameKey, gameID)
+		}
+	} else {
+		s.players[player] = ""
+	}
+	s.sendNetworkMessage(player)
+	s.sendGameMessage(player)
+	if s.restarting != nil {
+		s.sendRestartingMessage(player)
+	}
+	for player := range s.players {
+		s.sendConnectedMessage(player)
+	}
+	return nil
+}
+
+// restore rebuilds the game from its last good state and persists it after the loop panicked
+func (s *gameServer) restore() (err error) {
+	gameKey, gameID := s.builder.Key(), s.create.NetworkOptions.GameID
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	gameData, err := s.gameData()
+	if err != nil {
+		return err
+	}
+	game, err := s.builder.(bg.BoardGameWithBGNBuilder).Load(gameData.BGN)
+	if err != nil {
+		return err
+	}
+	s.game = game
+	if len(gameData.BGN.Actions) > 0 || gameData.PlayCount > 0 {
+		// stored in the background so a slow game store does not hold up the players
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+			defer cancel()
+			if err := s.gameStore.Store(ctx, gameData); err != nil && err != datastore.ErrGameStoreNotEnabled {
+				logger.Log.Error().Caller().Err(err).Msgf(ErrStoreGame(gameKey, gameID).Error())
+			}
+		}()
+	}
+	for player := range s.players {
+		s.sendErrorMessage(player, ErrGameRestarted(gameKey, gameID))
+		s.sendGameMessage(player)
+	}
+	return nil
+}
+
+// summary returns the current state of the server for operators
+func (s *gameServer) summary() *GameSummary {
+	players := make(map[string]string)
+	for player, team := range s.players {
+		if !player.watcher {
+			players[player.playerName] = team
+		}
+	}
+	return &GameSummary{
+		GameKey:   s.builder.Key(),
+		GameID:    s.create.NetworkOptions.GameID,
+		Players:   players,
+		CreatedAt: s.createdAt,
+		UpdatedAt: s.updatedAt,
+		PlayCount: s.playCount,
+		ReadOnly:  s.readOnly,
+	}
+}
+
+// kick disconnects all players with the given name
+func (s *gameServer) kick(playerName string) bool {
+	kicked := false
 	for player := range s.players {
-		if err := player.Close(); err != nil {
-			logger.Log.Error().Caller().Err(err)
+		if player.playerName != playerName {
+			continue
 		}
+		s.sendSystemMessage(player, "you have been removed from the game")
+		delete(s.players, player)
+		player.Close()
+		kicked = true
+	}
+	if kicked {
+		for player := range s.players {
+			s.sendConnectedMessage(player)
+		}
+	}
+	return kicked
+}
+
+// drain tells all players the server is restarting and when to reconnect
+func (s *gameServer) drain(reconnectAfter time.Duration) {
+	s.restarting = &outboundRestartingMessage{
+		ReconnectAfter: reconnectAfter.String(),
+		Message:        "server is restarting, your game will be saved",
+	}
+	for player := range s.players {
+		s.sendRestartingMessage(player)
+	}
+}
+
+// paused returns whether the game may be stopped without interrupting play
+// i.e. no one is connected, the game is over or no action has been taken for the idle duration
+func (s *gameServer) paused(idle time.Duration) bool {
+	if len(s.players) == 0 || time.Since(s.updatedAt) >= idle {
+		return true
+	}
+	snapshot, err := s.game.GetSnapshot()
+	return err == nil && len(snapshot.Winners) > 0
+}
+
+// gameData returns the game in its stored form
+func (s *gameServer) gameData() (*datastore.Game, error) {
+	gameKey, gameID := s.builder.Key(), s.create.NetworkOptions.GameID
+	bgnGame, ok := s.game.(bg.BoardGameWithBGN)
+	if !ok {
+		return nil, ErrBGNUnsupported(gameKey)
+	}
+	snapshot, err := s.game.GetSnapshot()
+	if err != nil {
+		return nil, err
 	}
-	s.stop <- true
+	participants := make(map[string]string)
+	for name, team := range s.participants {
+		participants[name] = team
+	}
+	return &datastore.Game{
+		GameKey:      gameKey,
+		GameID:       gameID,
+		BGN:          bgnGame.GetBGN(),
+		CreatedAt:    s.createdAt,
+		UpdatedAt:    s.updatedAt,
+		PlayCount:    s.playCount,
+		ActionCount:  len(snapshot.Actions),
+		Winners:      snapshot.Winners,
+		Participants: participants,
+	}, nil
+}
+
+// archive stores the just completed playthrough so it is not lost when the game is reset
+func (s *gameServer) archive() {
+	gameKey, gameID := s.builder.Key(), s.create.NetworkOptions.GameID
+	gameData, err := s.gameData()
+	if err != nil {
+		logger.Log.Error().Caller().Err(err).Msgf(ErrArchivePlaythrough(gameKey, gameID).Error())
+		return
+	}
+	completedAt := s.completedAt
+	if completedAt.IsZero() {
+		completedAt = s.updatedAt
+	}
+	playthrough := &datastore.Playthrough{
+		GameKey:      gameKey,
+		GameID:       gameID,
+		PlayIndex:    gameData.PlayCount,
+		BGN:          gameData.BGN,
+		Winners:      gameData.Winners,
+		Participants: gameData.Participants,
+		CompletedAt:  completedAt,
+	}
+	// stored in the background so a slow game store does not hold up the players
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+		defer cancel()
+		if err := s.gameStore.StorePlaythrough(ctx, playthrough); err != nil && err != datastore.ErrGameStoreNotEnabled {
+			logger.Log.Error().Caller().Err(err).Msgf(ErrArchivePlaythrough(gameKey, gameID).Error())
+		}
+	}()
 }
 
 func (s *gameServer) Join(options JoinGameOptions) error {
@@ -441,8 +784,14 @@ func (s *gameServer) Join(options JoinGameOptions) error {
 	go player.ReadPump(wg)
 	go player.WritePump(wg)
 	wg.Wait()
-	s.join <- player
-	return <-s.errCh
+	join := &joinRequest{player: player, errCh: make(chan error, 1)}
+	select {
+	case s.join <- join:
+	case <-s.done:
+		_ = player.Close()
+		return ErrGameClosed
+	}
+	return <-join.errCh
 }
 
 func (s *gameServer) sendGameMessage(player *player) {
@@ -452,16 +801,11 @@ func (s *gameServer) sendGameMessage(player *player) {
 	} else {
 		snapshot, _ = s.game.GetSnapshot(s.players[player])
 	}
-	payload, _ := json.Marshal(OutboundMessage{
+	// patch protocol players are sent a patch in place of the snapshot once it is written
+	s.send(player, OutboundMessage{
 		Type:    "Game",
 		Payload: snapshot,
 	})
-	select {
-	case player.send <- payload:
-	default:
-		delete(s.players, player)
-		player.Close()
-	}
 }
 
 func (s *gameServer) sendNetworkMessage(player *player) {
@@ -469,7 +813,7 @@ func (s *gameServer) sendNetworkMessage(player *player) {
 	if s.timer != nil {
 		timeLeft = s.timer.Remaining().String()
 	}
-	payload, _ := json.Marshal(OutboundMessage{
+	s.send(player, OutboundMessage{
 		Type: "Network",
 		Payload: &outboundNetworkMessage{
 			NetworkingCreateGameOptions: s.options,
@@ -477,53 +821,91 @@ func (s *gameServer) sendNetworkMessage(player *player) {
 			TurnTimeLeft:                timeLeft,
 		},
 	})
-	select {
-	case player.send <- payload:
-	default:
-		delete(s.players, player)
-		player.Close()
-	}
 }
 
 func (s *gameServer) sendChatMessage(player *player) {
-	payload, _ := json.Marshal(OutboundMessage{
+	s.send(player, OutboundMessage{
 		Type:    "Chat",
 		Payload: s.chat[len(s.chat)-1],
 	})
-	select {
-	case player.send <- payload:
-	default:
-		delete(s.players, player)
-		player.Close()
-	}
 }
 
 func (s *gameServer) sendConnectedMessage(player *player) {
 	connected := make(map[string]string)
 	for player, team := range s.players {
-		connected[player.playerName] = team
+		if !player.watcher {
+			connected[player.playerName] = team
+		}
 	}
-	payload, _ := json.Marshal(OutboundMessage{
+	s.send(player, OutboundMessage{
 		Type:    "Connected",
 		Payload: connected,
 	})
-	select {
-	case player.send <- payload:
-	default:
-		delete(s.players, player)
-		player.Close()
-	}
+}
+
+func (s *gameServer) sendSystemMessage(player *player, msg string) {
+	s.send(player, OutboundMessage{
+		Type:    "System",
+		Payload: msg,
+	})
+}
+
+func (s *gameServer) sendRestartingMessage(player *player) {
+	s.send(player, OutboundMessage{
+		Type:    "ServerRestarting",
+		Payload: s.restarting,
+	})
 }
 
 func (s *gameServer) sendErrorMessage(player *player, err error) {
-	payload, _ := json.Marshal(OutboundMessage{
+	metrics.ActionErrors.WithLabelValues(s.builder.Key()).Inc()
+	s.send(player, OutboundMessage{
 		Type:    "Error",
+		Code:    ErrorCode(err),
 		Payload: err.Error(),
 	})
-	select {
-	case player.send <- payload:
-	default:
+}
+
+// sendReplyMessage tells the player the result of their message, an Error if it failed or an Ack if it succeeded and has a request ID
+func (s *gameServer) sendReplyMessage(player *player, requestID string, err error) {
+	if err != nil {
+		metrics.ActionErrors.WithLabelValues(s.builder.Key()).Inc()
+		s.send(player, OutboundMessage{
+			Type:      "Error",
+			RequestID: requestID,
+			Code:      ErrorCode(err),
+			Payload:   err.Error(),
+		})
+		return
+	}
+	if requestID != "" {
+		s.send(player, OutboundMessage{
+			Type:      "Ack",
+			RequestID: requestID,
+		})
+	}
+}
+
+// send queues the message to the player disconnecting them if they have lagged for too long
+// the payload is marshalled here as it may reference game state only safe to access from within the server loop
+func (s *gameServer) send(player *player, message OutboundMessage) {
+	payload, err := json.Marshal(message.Payload)
+	if err != nil {
+		logger.Log.Error().Caller().Err(err).Msgf("failed to marshal %s message", message.Type)
+		return
+	}
+	message.Payload = json.RawMessage(payload)
+	// only the latest snapshot and connected players matter as patches are made against the snapshot written
+	supersede := message.Type == "Game" || message.Type == "Connected"
+	dropped, ok := player.outbox.push(message, supersede)
+	if dropped > 0 {
+		metrics.CoalescedMessages.WithLabelValues(s.builder.Key(), message.Type).Add(float64(dropped))
+	}
+	if !ok {
+		metrics.DroppedMessages.WithLabelValues(s.builder.Key(), message.Type).Inc()
 		delete(s.players, player)
 		player.Close()
+		// queued messages will not be written in time so the transport is closed right away to unblock the write pump
+		go player.transport.Close()
 	}
 }
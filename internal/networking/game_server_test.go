@@ -0,0 +1,131 @@
+package go_boardgame_networking
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	bg "github.com/quibbble/go-boardgame"
+	"github.com/quibbble/go-quibbble/internal/datastore"
+	"github.com/quibbble/go-quibbble/pkg/duration"
+	tictactoe "github.com/quibbble/go-tictactoe"
+)
+
+func TestGameServerArchivesTimedOutWins(t *testing.T) {
+	gameStore := datastore.NewMemoryGameStore()
+	network := newTestNetwork(t, time.Minute, gameStore)
+	ctx := context.Background()
+	gameKey := (&tictactoe.Builder{}).Key()
+	// every move is a random one done when the player's turn times out
+	turnLength := duration.Duration(20 * time.Millisecond)
+	if err := network.CreateGame(ctx, CreateGameOptions{
+		NetworkOptions: &NetworkingCreateGameOptions{
+			GameKey:    gameKey,
+			GameID:     "example",
+			Players:    map[string][]string{"red": {"red-player"}, "blue": {"blue-player"}},
+			TurnLength: &turnLength,
+		},
+		GameOptions: &bg.BoardGameOptions{Teams: []string{"red", "blue"}},
+	}); err != nil {
+		t.Fatalf("failed to create game: %s", err)
+	}
+	transport := newTestTransport()
+	defer transport.Close()
+	if err := network.JoinGame(ctx, JoinGameOptions{GameKey: gameKey, GameID: "example", PlayerID: "red-player", PlayerName: "player", Transport: transport}); err != nil {
+		t.Fatalf("failed to join game: %s", err)
+	}
+
+	for playCount := 1; playCount <= 2; playCount++ {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			summary, err := network.GetSummary(ctx, gameKey, "example")
+			if err != nil {
+				t.Fatalf("failed to get summary: %s", err)
+			}
+			if summary.PlayCount == playCount {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("got play count %d, want the timed out game to be won %d times", summary.PlayCount, playCount)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if !transport.send(ServerActionReset, nil) {
+			t.Fatalf("failed to reset game")
+		}
+	}
+
+	// playthroughs are stored in the background
+	deadline := time.Now().Add(time.Second)
+	var playthroughs []*datastore.Playthrough
+	for {
+		var err error
+		if playthroughs, err = gameStore.GetPlaythroughs(ctx, gameKey, "example"); err != nil {
+			t.Fatalf("failed to get playthroughs: %s", err)
+		}
+		if len(playthroughs) == 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(playthroughs) != 2 {
+		t.Fatalf("got %d playthroughs, want each reset to store its own", len(playthroughs))
+	}
+	for i, playthrough := range playthroughs {
+		if playthrough.PlayIndex != i+1 {
+			t.Errorf("got play index %d, want %d", playthrough.PlayIndex, i+1)
+		}
+		if len(playthrough.Winners) == 0 || playthrough.CompletedAt.IsZero() {
+			t.Errorf("got playthrough %d without winners or completion time", playthrough.PlayIndex)
+		}
+	}
+	// the player was joined for all of the second playthrough so took part through the moves done for them
+	if team := playthroughs[1].Participants["player"]; team != "red" {
+		t.Errorf("got participant team '%s', want red", team)
+	}
+}
+
+func TestGameServerRejectedActionsAreNotActivity(t *testing.T) {
+	network := newTestNetwork(t, time.Minute, nil)
+	ctx := context.Background()
+	gameKey := (&tictactoe.Builder{}).Key()
+	if err := network.CreateGame(ctx, CreateGameOptions{
+		NetworkOptions: &NetworkingCreateGameOptions{GameKey: gameKey, GameID: "example"},
+		GameOptions:    &bg.BoardGameOptions{Teams: []string{"red", "blue"}},
+	}); err != nil {
+		t.Fatalf("failed to create game: %s", err)
+	}
+	transport := newTestTransport()
+	defer transport.Close()
+	if err := network.JoinGame(ctx, JoinGameOptions{GameKey: gameKey, GameID: "example", PlayerName: "player", Transport: transport}); err != nil {
+		t.Fatalf("failed to join game: %s", err)
+	}
+	updatedAt := func() time.Time {
+		summary, err := network.GetSummary(ctx, gameKey, "example")
+		if err != nil {
+			t.Fatalf("failed to get summary: %s", err)
+		}
+		return summary.UpdatedAt
+	}
+	created := updatedAt()
+
+	// the player has no team so the mark is rejected
+	if !transport.send(tictactoe.ActionMarkLocation, tictactoe.MarkLocationActionDetails{Row: 1, Column: 1}) {
+		t.Fatalf("failed to send mark")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := updatedAt(); !got.Equal(created) {
+		t.Fatalf("got updated at %s after a rejected action, want %s", got, created)
+	}
+
+	if !transport.send(ServerActionChat, map[string]string{"Msg": "hello"}) {
+		t.Fatalf("failed to send chat")
+	}
+	deadline := time.Now().Add(time.Second)
+	for updatedAt().Equal(created) {
+		if time.Now().After(deadline) {
+			t.Fatalf("got updated at %s after an accepted action, want it to move on", created)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,79 @@
+package go_boardgame_networking
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// defaultViolationWindow is how far back rate limited messages count towards disconnecting a player
+const defaultViolationWindow = time.Minute
+
+// violations counts a player's rate limited messages within a sliding window
+// so a player is only disconnected for sending too much in a short time and not over a long game
+type violations struct {
+	max    int
+	window time.Duration
+	times  []time.Time // times of the violations within the window, oldest first
+}
+
+func newViolations(max int, window time.Duration) *violations {
+	if window <= 0 {
+		window = defaultViolationWindow
+	}
+	return &violations{max: max, window: window}
+}
+
+// add records a violation at now returning whether the max was reached within the window
+func (v *violations) add(now time.Time) bool {
+	if v.max <= 0 {
+		return false
+	}
+	expired := 0
+	for expired < len(v.times) && now.Sub(v.times[expired]) >= v.window {
+		expired++
+	}
+	v.times = append(v.times[expired:], now)
+	return len(v.times) >= v.max
+}
+
+// connLimiter caps the number of open connections from each ip
+type connLimiter struct {
+	mu    sync.Mutex
+	max   int
+	conns map[string]int // mapping from ip to open connections
+}
+
+func newConnLimiter(max int) *connLimiter {
+	return &connLimiter{
+		max:   max,
+		conns: make(map[string]int),
+	}
+}
+
+// acquire reserves a connection for the address returning a func to release it which is safe to call more than once
+func (l *connLimiter) acquire(remoteAddr string) (func(), error) {
+	if l.max <= 0 || remoteAddr == "" {
+		return func() {}, nil
+	}
+	ip := remoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		ip = host
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conns[ip] >= l.max {
+		return nil, ErrTooManyConnections
+	}
+	l.conns[ip]++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if l.conns[ip]--; l.conns[ip] <= 0 {
+				delete(l.conns, ip)
+			}
+		})
+	}, nil
+}
@@ -0,0 +1,67 @@
+package go_boardgame_networking
+
+import (
+	"testing"
+	"time"
+)
+
+func TestViolations(t *testing.T) {
+	start := time.Now()
+	v := newViolations(3, time.Minute)
+	if v.add(start) || v.add(start.Add(time.Second)) {
+		t.Fatalf("got max violations reached after two of three")
+	}
+	if !v.add(start.Add(2 * time.Second)) {
+		t.Fatalf("got max violations not reached after three within the window")
+	}
+
+	// violations older than the window no longer count
+	v = newViolations(3, time.Minute)
+	v.add(start)
+	v.add(start.Add(30 * time.Second))
+	if v.add(start.Add(time.Minute + time.Second)) {
+		t.Fatalf("got max violations reached counting one outside the window")
+	}
+	if !v.add(start.Add(time.Minute + 2*time.Second)) {
+		t.Fatalf("got max violations not reached after three within the window")
+	}
+
+	if v := newViolations(0, 0); v.add(start) || v.add(start) {
+		t.Fatalf("got max violations reached with no max")
+	}
+}
+
+func TestConnLimiter(t *testing.T) {
+	limiter := newConnLimiter(2)
+	first, err := limiter.acquire("10.0.0.1:1000")
+	if err != nil {
+		t.Fatalf("failed to acquire first connection: %s", err)
+	}
+	if _, err := limiter.acquire("10.0.0.1:1001"); err != nil {
+		t.Fatalf("failed to acquire second connection: %s", err)
+	}
+	// connections are counted by ip whatever the port
+	if _, err := limiter.acquire("10.0.0.1:1002"); err != ErrTooManyConnections {
+		t.Fatalf("got %v acquiring a third connection, want %v", err, ErrTooManyConnections)
+	}
+	if _, err := limiter.acquire("10.0.0.2:1000"); err != nil {
+		t.Fatalf("failed to acquire connection from another ip: %s", err)
+	}
+
+	// releasing more than once frees a single slot
+	first()
+	first()
+	if _, err := limiter.acquire("10.0.0.1:1003"); err != nil {
+		t.Fatalf("failed to acquire a released connection: %s", err)
+	}
+	if _, err := limiter.acquire("10.0.0.1:1004"); err != ErrTooManyConnections {
+		t.Fatalf("got %v acquiring past the limit after a double release, want %v", err, ErrTooManyConnections)
+	}
+
+	unlimited := newConnLimiter(0)
+	for i := 0; i < 10; i++ {
+		if _, err := unlimited.acquire("10.0.0.1:1000"); err != nil {
+			t.Fatalf("got %v acquiring without a limit", err)
+		}
+	}
+}
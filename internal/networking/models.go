@@ -3,7 +3,6 @@ package go_boardgame_networking
 import (
 	"time"
 
-	"github.com/gorilla/websocket"
 	bg "github.com/quibbble/go-boardgame"
 	"github.com/quibbble/go-boardgame/pkg/bgn"
 	"github.com/quibbble/go-quibbble/internal/datastore"
@@ -23,6 +22,55 @@ type GameNetworkOptions struct {
 
 	// GameStore stores games longterm
 	GameStore datastore.GameStore
+
+	// Limits protect games from abusive clients
+	Limits LimitOptions
+
+	// Connection tunes player connections with zero values using the defaults
+	Connection ConnectionOptions
+
+	// GameConnections overrides Connection for individual game keys with zero values using Connection
+	GameConnections map[string]ConnectionOptions
+}
+
+// ConnectionOptions tune the connections of players to a game
+type ConnectionOptions struct {
+	// MaxMessageSize is the max size in bytes of a message from a player, larger messages are answered with an Error and the player disconnected
+	MaxMessageSize int64
+
+	// SendBuffer is the number of messages queued for a player after which they are lagging
+	// superseded game snapshots are dropped from the queue so only a stalled player lags
+	SendBuffer int
+
+	// MaxLag is how long a player may lag before they are disconnected for being too slow
+	MaxLag time.Duration
+
+	// PongWait is how long to wait for a player to respond to a ping before disconnecting them
+	PongWait time.Duration
+
+	// PingPeriod is how often players are pinged and must be less than PongWait
+	PingPeriod time.Duration
+
+	// WriteWait is how long a write to a player may take before they are disconnected
+	WriteWait time.Duration
+}
+
+// LimitOptions protect game servers from abusive clients
+type LimitOptions struct {
+	// MessagesPerSecond is the rate at which each player may send messages - no limit if zero
+	MessagesPerSecond float64
+
+	// MessageBurst is the number of messages a player may send at once before being limited
+	MessageBurst int
+
+	// MaxViolations is the number of rate limited messages within the ViolationWindow after which a player is disconnected - never if zero
+	MaxViolations int
+
+	// ViolationWindow is how far back rate limited messages count towards MaxViolations - defaults to a minute
+	ViolationWindow time.Duration
+
+	// MaxConnectionsPerIP caps the number of open connections from each ip - no limit if zero
+	MaxConnectionsPerIP int
 }
 
 // CreateGameOptions are the fields necessary for creating a game
@@ -40,7 +88,7 @@ type NetworkingCreateGameOptions struct {
 	// GameKey references the game to play - required
 	GameKey string
 
-	// GameID is the unique id assigned to the specific game instance - required
+	// GameID is the unique id assigned to the specific game instance - required by the network, generated by the server if empty
 	GameID string
 
 	// Players is a mapping of Team to list of PlayerID - optional
@@ -55,21 +103,65 @@ type NetworkingCreateGameOptions struct {
 	// SingleDevice refers to the ability for multiple players to play on one device - optional
 	// No business logic is added for this field, used by the frontend only
 	SingleDevice bool `json:",omitempty"`
+
+	// OnConflict is what to do when a game with GameID is already running or stored - optional
+	// One of OnConflictError, OnConflictLoad or OnConflictReplace with empty meaning OnConflictError
+	OnConflict string `json:",omitempty"`
 }
 
+// Behaviours when creating a game whose GameID is already running or stored
+const (
+	// OnConflictError fails with ErrExistingGameID
+	OnConflictError = "error"
+
+	// OnConflictLoad keeps the running game or loads the stored game in place of the requested one
+	OnConflictLoad = "load"
+
+	// OnConflictReplace stores and closes the running game and creates the requested game, overwriting the stored game once stored
+	OnConflictReplace = "replace"
+)
+
 // JoinGameOptions are the fields necessary for joining a game
 type JoinGameOptions struct {
 	GameKey    string
 	GameID     string
 	PlayerID   string
 	PlayerName string
-	Conn       *websocket.Conn
+	Transport  Transport
+
+	// RemoteAddr is the address of the player used to cap connections per ip - optional
+	RemoteAddr string
+
+	// Protocol is how game state is sent to the player, either ProtocolSnapshot or ProtocolPatch - optional
+	// defaults to ProtocolSnapshot
+	Protocol string
+
+	// Encoding is the format messages are sent and received in, one of EncodingJSON, EncodingMsgpack or EncodingCBOR - optional
+	// defaults to EncodingJSON
+	Encoding string
+
+	// Watch joins without playing, the watcher receives every message but is hidden from players and may not send actions - optional
+	Watch bool
+
+	// Team is the team whose view of the game a watcher receives - optional
+	Team string
+
+	release func() // frees the player's connection slot once they disconnect
 }
 
 // OutboundMessage is the message sent to player
 type OutboundMessage struct {
 	Type string
 
+	// Seq increases by one with every message sent to the player so missed messages may be detected
+	Seq int64 `json:",omitempty"`
+
+	// RequestID is the request ID of the player's message that this message is a reply to - optional
+	RequestID string `json:",omitempty"`
+
+	// Code identifies the kind of error in Error messages - optional
+	Code string `json:",omitempty"`
+
 	Payload interface{}
 }
 
@@ -83,8 +175,26 @@ type outboundNetworkMessage struct {
 	TurnTimeLeft string `json:",omitempty"`
 }
 
+type outboundRestartingMessage struct {
+	// ReconnectAfter is how long the player should wait before reconnecting
+	ReconnectAfter string
+
+	Message string
+}
+
 // ChatMessage is a message in a chat
 type ChatMessage struct {
 	Name string
 	Msg  string
 }
+
+// GameSummary describes a running game for operators
+type GameSummary struct {
+	GameKey   string
+	GameID    string
+	Players   map[string]string // mapping from player name to team
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	PlayCount int
+	ReadOnly  bool
+}
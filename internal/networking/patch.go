@@ -0,0 +1,112 @@
+package go_boardgame_networking
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/wI2L/jsondiff"
+)
+
+// Protocols a player may choose when joining a game
+const (
+	// ProtocolSnapshot sends the full game snapshot after every change
+	ProtocolSnapshot = "snapshot"
+
+	// ProtocolPatch sends JSON Patch (RFC 6902) diffs against the player's last acknowledged snapshot
+	ProtocolPatch = "patch"
+)
+
+// maxPendingPatches is the number of unacknowledged snapshots kept per player before a full snapshot is sent instead
+const maxPendingPatches = 64
+
+// patchState tracks the snapshots a patch protocol player has been sent by the sequence number of the message they were sent in
+// patches are made as messages are written so only the latest queued snapshot is diffed and sequence numbers are those the player sees
+// it is accessed from both the server loop and the player's write pump
+type patchState struct {
+	mu      sync.Mutex
+	seq     int64            // sequence number of the last snapshot written
+	baseSeq int64            // sequence number of the last acknowledged or full snapshot
+	base    []byte           // last acknowledged or full snapshot that diffs are made against
+	pending map[int64][]byte // snapshots written but not yet acknowledged by sequence number
+}
+
+func newPatchState() *patchState {
+	return &patchState{pending: make(map[int64][]byte)}
+}
+
+// outboundPatchMessage is a diff to apply to the snapshot sent in the message with sequence number BaseSeq
+type outboundPatchMessage struct {
+	BaseSeq int64
+	Patch   jsondiff.Patch
+}
+
+// next returns the message to write with sequence number seq for the snapshot, a patch if possible or a full snapshot otherwise
+func (p *patchState) next(snapshot []byte, seq int64) OutboundMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.seq = seq
+	if p.base == nil || len(p.pending) >= maxPendingPatches {
+		return p.full(snapshot)
+	}
+	patch, err := jsondiff.CompareJSON(p.base, snapshot)
+	if err != nil {
+		return p.full(snapshot)
+	}
+	if patch == nil {
+		patch = jsondiff.Patch{}
+	}
+	// a patch may be larger than the snapshot itself after many unacknowledged changes
+	if raw, err := json.Marshal(patch); err != nil || len(raw) >= len(snapshot) {
+		return p.full(snapshot)
+	}
+	p.pending[seq] = snapshot
+	return OutboundMessage{
+		Type: "GamePatch",
+		Payload: &outboundPatchMessage{
+			BaseSeq: p.baseSeq,
+			Patch:   patch,
+		},
+	}
+}
+
+// full resets the base to the snapshot as the player replaces their state on receiving it
+func (p *patchState) full(snapshot []byte) OutboundMessage {
+	p.base = snapshot
+	p.baseSeq = p.seq
+	p.pending = make(map[int64][]byte)
+	return OutboundMessage{
+		Type:    "Game",
+		Payload: json.RawMessage(snapshot),
+	}
+}
+
+// ack makes the snapshot with the sequence number the base for future diffs
+// acks for snapshots at or before the base are stale, such as those sent before a full snapshot, and are ignored
+func (p *patchState) ack(seq int64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if seq <= p.baseSeq {
+		return nil
+	}
+	snapshot, ok := p.pending[seq]
+	if !ok {
+		return ErrUnknownSequence(seq)
+	}
+	p.base = snapshot
+	p.baseSeq = seq
+	for pending := range p.pending {
+		if pending <= seq {
+			delete(p.pending, pending)
+		}
+	}
+	return nil
+}
+
+// resync discards all state so the next snapshot written is a full snapshot and acks for those already written are stale
+func (p *patchState) resync() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.base = nil
+	p.baseSeq = p.seq
+	p.pending = make(map[int64][]byte)
+}
@@ -0,0 +1,51 @@
+package go_boardgame_networking
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testSnapshot is large enough that a patch changing the turn is smaller than the snapshot
+func testSnapshot(turn string) []byte {
+	return []byte(fmt.Sprintf(`{"Turn":%q,"Message":%q}`, turn, strings.Repeat("m", 256)))
+}
+
+func TestPatchStateAck(t *testing.T) {
+	patches := newPatchState()
+	if message := patches.next(testSnapshot("red"), 1); message.Type != "Game" {
+		t.Fatalf("got %s for the first snapshot, want Game", message.Type)
+	}
+	message := patches.next(testSnapshot("blue"), 3)
+	if message.Type != "GamePatch" || message.Payload.(*outboundPatchMessage).BaseSeq != 1 {
+		t.Fatalf("got %s %+v, want a GamePatch against 1", message.Type, message.Payload)
+	}
+	if err := patches.ack(3); err != nil {
+		t.Fatalf("failed to ack: %s", err)
+	}
+	message = patches.next(testSnapshot("red"), 4)
+	if message.Type != "GamePatch" || message.Payload.(*outboundPatchMessage).BaseSeq != 3 {
+		t.Fatalf("got %s %+v, want a GamePatch against 3", message.Type, message.Payload)
+	}
+	if err := patches.ack(2); err != nil {
+		t.Errorf("got %v acking a snapshot before the base, want it ignored", err)
+	}
+	if err := patches.ack(5); !errors.Is(err, &Error{Code: CodeUnknownSequence}) {
+		t.Errorf("got %v acking an unsent snapshot, want %s", err, CodeUnknownSequence)
+	}
+}
+
+func TestPatchStateResync(t *testing.T) {
+	patches := newPatchState()
+	patches.next(testSnapshot("red"), 1)
+	patches.next(testSnapshot("blue"), 2)
+	patches.resync()
+	if message := patches.next(testSnapshot("red"), 3); message.Type != "Game" {
+		t.Fatalf("got %s after resyncing, want Game", message.Type)
+	}
+	// the ack for the patch written before the full snapshot arrives late
+	if err := patches.ack(2); err != nil {
+		t.Errorf("got %v acking a snapshot sent before the full snapshot, want it ignored", err)
+	}
+}
@@ -1,23 +1,72 @@
 package go_boardgame_networking
 
 import (
+	"encoding/json"
+	"errors"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/quibbble/go-quibbble/internal/metrics"
 	"github.com/quibbble/go-quibbble/pkg/logger"
+	"golang.org/x/time/rate"
 )
 
 const (
-	writeWait      = 10 * time.Second    // time allowed to write a message to the peer
-	pongWait       = 60 * time.Second    // time allowed to read the next pong message from the peer
-	pingPeriod     = (pongWait * 9) / 10 // send pings to peer with this period. Must be less than pongWait
-	maxMessageSize = 512                 // maximum message size allowed from peer
+	defaultWriteWait      = 10 * time.Second // time allowed to write a message to the peer
+	defaultPongWait       = 60 * time.Second // time allowed to read the next pong message from the peer
+	defaultMaxMessageSize = 8192             // maximum message size allowed from peer
+	defaultSendBuffer     = 32               // messages queued for the peer before they are lagging
+	defaultMaxLag         = 10 * time.Second // time the peer may lag before they are disconnected
 )
 
+// withDefaults fills in zero values from the fallback and then the package defaults
+func (o ConnectionOptions) withDefaults(fallback ConnectionOptions) ConnectionOptions {
+	if o.MaxMessageSize <= 0 {
+		o.MaxMessageSize = fallback.MaxMessageSize
+	}
+	if o.SendBuffer <= 0 {
+		o.SendBuffer = fallback.SendBuffer
+	}
+	if o.PongWait <= 0 {
+		o.PongWait = fallback.PongWait
+	}
+	if o.PingPeriod <= 0 {
+		o.PingPeriod = fallback.PingPeriod
+	}
+	if o.WriteWait <= 0 {
+		o.WriteWait = fallback.WriteWait
+	}
+	if o.MaxLag <= 0 {
+		o.MaxLag = fallback.MaxLag
+	}
+	if o.MaxMessageSize <= 0 {
+		o.MaxMessageSize = defaultMaxMessageSize
+	}
+	if o.SendBuffer <= 0 {
+		o.SendBuffer = defaultSendBuffer
+	}
+	if o.PongWait <= 0 {
+		o.PongWait = defaultPongWait
+	}
+	// pings must be sent before the pong wait elapses
+	if o.PingPeriod <= 0 || o.PingPeriod >= o.PongWait {
+		o.PingPeriod = (o.PongWait * 9) / 10
+	}
+	if o.WriteWait <= 0 {
+		o.WriteWait = defaultWriteWait
+	}
+	if o.MaxLag <= 0 {
+		o.MaxLag = defaultMaxLag
+	}
+	return o
+}
+
 type message struct {
-	player  *player
-	payload []byte
+	player    *player
+	payload   []byte
+	requestID string // read from the payload outside the server loop so the loop never parses messages it rejects
+	err       error  // sent back to the player instead of processing the payload
 }
 
 // player is the player connecting to a specific game instance
@@ -25,94 +74,179 @@ type player struct {
 	playerID   string
 	playerName string
 	server     *gameServer
-	conn       *websocket.Conn
-	send       chan []byte
+	transport  Transport
+	outbox     *outbox
+	release    func()      // frees the player's connection slot
+	patches    *patchState // nil unless the player joined with the patch protocol
+	encoding   encoding
+	seq        int64 // sequence number of the last message written, only accessed from within the write pump
+	watcher    bool
+	watchTeam  string // team whose view of the game the watcher receives
+
+	limiter    *rate.Limiter // nil if messages are not rate limited
+	violations *violations
 
 	mu     sync.Mutex
 	closed bool
 }
 
 func newPlayer(join JoinGameOptions, server *gameServer) *player {
+	metrics.Connections.WithLabelValues(server.builder.Key(), join.Transport.Name()).Inc()
+	var limiter *rate.Limiter
+	if server.limits.MessagesPerSecond > 0 {
+		limiter = rate.NewLimiter(rate.Limit(server.limits.MessagesPerSecond), max(server.limits.MessageBurst, 1))
+	}
+	var patches *patchState
+	if join.Protocol == ProtocolPatch {
+		patches = newPatchState()
+	}
+	enc, err := newEncoding(join.Encoding)
+	if err != nil {
+		enc = jsonEncoding{}
+	}
+	join.Transport.Configure(server.connection)
 	return &player{
 		playerID:   join.PlayerID,
 		playerName: join.PlayerName,
 		server:     server,
-		conn:       join.Conn,
-		send:       make(chan []byte, 2),
+		transport:  join.Transport,
+		outbox:     newOutbox(server.connection.SendBuffer, server.connection.MaxLag),
+		release:    join.release,
+		patches:    patches,
+		encoding:   enc,
+		watcher:    join.Watch,
+		watchTeam:  join.Team,
+		limiter:    limiter,
+		violations: newViolations(server.limits.MaxViolations, server.limits.ViolationWindow),
 	}
 }
 
 func (p *player) ReadPump(wg *sync.WaitGroup) {
 	// read message from client
 	defer p.close()
-	p.conn.SetReadLimit(maxMessageSize)
-	_ = p.conn.SetReadDeadline(time.Now().Add(pongWait))
-	p.conn.SetPongHandler(func(string) error { _ = p.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 	// tell outside resource pump started
 	wg.Done()
 	for {
-		_, msg, err := p.conn.ReadMessage()
+		msgType, msg, err := p.transport.Read()
+		var e *Error
+		if errors.As(err, &e) && e.Code == CodeMessageTooLarge {
+			// tell the player why they are being disconnected
+			select {
+			case p.server.process <- &message{player: p, err: err}:
+			case <-p.server.done:
+			}
+			return
+		}
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway) {
 				logger.Log.Debug().Err(err).Msg("websocket unexpected close error")
 			}
 			break
 		}
-		p.server.process <- &message{
-			p,
-			msg,
+		message := &message{player: p, payload: msg}
+		if msgType == websocket.BinaryMessage {
+			message.payload, message.err = p.encoding.decode(msg)
+		}
+		var meta struct {
+			RequestID string
+		}
+		_ = json.Unmarshal(message.payload, &meta)
+		message.requestID = meta.RequestID
+		disconnect := false
+		if p.limiter != nil && !p.limiter.Allow() {
+			disconnect = p.violations.add(time.Now())
+			message.err = ErrRateLimited
+			if disconnect {
+				message.err = ErrRateLimitDisconnect
+			}
+			metrics.RateLimitedMessages.WithLabelValues(p.server.builder.Key()).Inc()
+		}
+		select {
+		case p.server.process <- message:
+		case <-p.server.done:
+			return
+		}
+		if disconnect {
+			return
 		}
 	}
 }
 
 func (p *player) WritePump(wg *sync.WaitGroup) {
 	// write back to to client
-	ticker := time.NewTicker(pingPeriod)
+	ticker := time.NewTicker(p.server.connection.PingPeriod)
 	defer func() {
 		ticker.Stop()
+		_ = p.transport.Close()
 		p.close()
 	}()
 	// tell outside resource pump started
 	wg.Done()
 	for {
 		select {
-		case message, ok := <-p.send:
-			if !ok {
-				_ = p.writeMessage(websocket.CloseMessage, []byte{})
-				return
-			}
-			if err := p.writeMessage(websocket.TextMessage, message); err != nil {
-				return
+		case <-p.outbox.ready:
+			for {
+				messages, ok := p.outbox.pop()
+				if !ok {
+					return
+				}
+				if len(messages) == 0 {
+					break
+				}
+				for _, message := range messages {
+					if err := p.write(message); err != nil {
+						return
+					}
+				}
 			}
 		case <-ticker.C:
-			if err := p.writeMessage(websocket.PingMessage, []byte{}); err != nil {
+			if err := p.transport.Ping(); err != nil {
 				return
 			}
 		}
 	}
 }
 
-func (p *player) writeMessage(msgType int, payload []byte) error {
-	_ = p.conn.SetWriteDeadline(time.Now().Add(writeWait))
-	return p.conn.WriteMessage(msgType, payload)
+// write sends the message numbering it so players can detect missed messages
+// snapshots to patch protocol players are replaced with a patch against the last snapshot they acknowledged
+func (p *player) write(message OutboundMessage) error {
+	p.seq++
+	if p.patches != nil && message.Type == "Game" {
+		if snapshot, ok := message.Payload.(json.RawMessage); ok {
+			message = p.patches.next(snapshot, p.seq)
+		}
+	}
+	message.Seq = p.seq
+	raw, err := json.Marshal(message)
+	if err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to marshal message")
+		return nil
+	}
+	payload, err := p.encoding.encode(raw)
+	if err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to encode message")
+		return nil
+	}
+	return p.transport.Write(p.encoding.messageType(), payload)
 }
 
-func (p *player) close() error {
-	gameKey, gameID := p.server.builder.Key(), p.server.create.NetworkOptions.GameID
+// close notifies the server that the player left before closing the player
+// the lock is not held while notifying as the server may concurrently be closing the player
+func (p *player) close() {
 	p.mu.Lock()
-	defer p.mu.Unlock()
-	if p.closed {
-		return nil
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		return
 	}
-	logger.Log.Debug().Caller().Msgf("closing player with key %s and id %s", gameKey, gameID)
-	p.closed = true
-	p.server.leave <- p
-	if !byteChanIsClosed(p.send) {
-		close(p.send)
+	select {
+	case p.server.leave <- p:
+	case <-p.server.done:
 	}
-	return p.conn.Close()
+	_ = p.Close()
 }
 
+// Close stops sending to the player, once any queued messages are written the connection is closed
 func (p *player) Close() error {
 	gameKey, gameID := p.server.builder.Key(), p.server.create.NetworkOptions.GameID
 	p.mu.Lock()
@@ -122,8 +256,10 @@ func (p *player) Close() error {
 	}
 	logger.Log.Debug().Caller().Msgf("closing player with key %s and id %s", gameKey, gameID)
 	p.closed = true
-	if !byteChanIsClosed(p.send) {
-		close(p.send)
+	metrics.Disconnections.WithLabelValues(gameKey, p.transport.Name()).Inc()
+	if p.release != nil {
+		p.release()
 	}
-	return p.conn.Close()
+	p.outbox.close()
+	return nil
 }
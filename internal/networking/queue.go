@@ -0,0 +1,98 @@
+package go_boardgame_networking
+
+import (
+	"sync"
+	"time"
+)
+
+// maxQueueGrowth is how many times the send buffer a lagging player's queue may grow to before they are disconnected regardless of lag
+const maxQueueGrowth = 4
+
+// queuedMessage is a message waiting to be written to a player with its payload already marshalled
+type queuedMessage struct {
+	message   OutboundMessage
+	supersede bool // whether a later message of the same type makes this one redundant
+}
+
+// outbox is a player's queue of messages waiting to be written
+// superseded messages are dropped so a stalled player catches up with only the latest game state
+type outbox struct {
+	mu           sync.Mutex
+	messages     []*queuedMessage
+	ready        chan struct{} // signalled whenever messages are queued or the outbox is closed
+	closed       bool
+	size         int           // number of messages after which the player is lagging
+	maxLag       time.Duration // how long a player may lag before being disconnected
+	laggingSince time.Time
+}
+
+func newOutbox(size int, maxLag time.Duration) *outbox {
+	return &outbox{
+		messages: make([]*queuedMessage, 0, size),
+		ready:    make(chan struct{}, 1),
+		size:     size,
+		maxLag:   maxLag,
+	}
+}
+
+// push queues the message returning the number of superseded messages dropped and false if the player has lagged for too long
+func (o *outbox) push(message OutboundMessage, supersede bool) (int, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return 0, true
+	}
+	dropped := 0
+	if supersede {
+		// the superseded message is removed rather than replaced so the latest state stays ordered after earlier messages
+		for i := 0; i < len(o.messages); i++ {
+			if o.messages[i].supersede && o.messages[i].message.Type == message.Type {
+				o.messages = append(o.messages[:i], o.messages[i+1:]...)
+				dropped++
+				i--
+			}
+		}
+	}
+	if len(o.messages) >= o.size {
+		if o.laggingSince.IsZero() {
+			o.laggingSince = time.Now()
+		}
+		if time.Since(o.laggingSince) > o.maxLag || len(o.messages) >= o.size*maxQueueGrowth {
+			return dropped, false
+		}
+	}
+	o.messages = append(o.messages, &queuedMessage{message: message, supersede: supersede})
+	o.signal()
+	return dropped, true
+}
+
+// pop removes all queued messages returning false once the outbox is closed and empty
+func (o *outbox) pop() ([]OutboundMessage, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.messages) == 0 {
+		return nil, !o.closed
+	}
+	messages := make([]OutboundMessage, 0, len(o.messages))
+	for _, queued := range o.messages {
+		messages = append(messages, queued.message)
+	}
+	o.messages = o.messages[:0]
+	o.laggingSince = time.Time{}
+	return messages, true
+}
+
+// close stops messages from being queued, those already queued are still written
+func (o *outbox) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.closed = true
+	o.signal()
+}
+
+func (o *outbox) signal() {
+	select {
+	case o.ready <- struct{}{}:
+	default:
+	}
+}
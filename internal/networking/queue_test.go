@@ -0,0 +1,100 @@
+package go_boardgame_networking
+
+import (
+	"testing"
+	"time"
+)
+
+// types returns the types of the messages in order
+func types(messages []OutboundMessage) []string {
+	types := make([]string, 0, len(messages))
+	for _, message := range messages {
+		types = append(types, message.Type)
+	}
+	return types
+}
+
+func TestOutboxCoalesces(t *testing.T) {
+	o := newOutbox(8, time.Minute)
+	for _, queued := range []struct {
+		message   OutboundMessage
+		supersede bool
+	}{
+		{OutboundMessage{Type: "Game", Payload: 1}, true},
+		{OutboundMessage{Type: "Connected"}, true},
+		{OutboundMessage{Type: "Chat"}, false},
+		{OutboundMessage{Type: "Chat"}, false},
+		{OutboundMessage{Type: "Game", Payload: 2}, true},
+		{OutboundMessage{Type: "Game", Payload: 3}, true},
+	} {
+		if _, ok := o.push(queued.message, queued.supersede); !ok {
+			t.Fatalf("got player disconnected pushing %s", queued.message.Type)
+		}
+	}
+	if dropped, _ := o.push(OutboundMessage{Type: "Connected"}, true); dropped != 1 {
+		t.Errorf("got %d messages dropped, want the earlier connected message superseded", dropped)
+	}
+
+	messages, ok := o.pop()
+	if !ok {
+		t.Fatalf("got outbox closed")
+	}
+	// only the latest game and connected messages are kept each ordered after the messages queued before it
+	want := []string{"Chat", "Chat", "Game", "Connected"}
+	if got := types(messages); len(got) != len(want) {
+		t.Fatalf("got messages %v, want %v", got, want)
+	}
+	for i, got := range types(messages) {
+		if got != want[i] {
+			t.Fatalf("got messages %v, want %v", types(messages), want)
+		}
+	}
+	if payload := messages[2].Payload; payload != 3 {
+		t.Errorf("got game payload %v, want the latest", payload)
+	}
+
+	if messages, ok := o.pop(); !ok || len(messages) != 0 {
+		t.Errorf("got %d messages and open %t once emptied, want none and open", len(messages), ok)
+	}
+	o.close()
+	if _, ok := o.pop(); ok {
+		t.Errorf("got outbox open once closed and emptied")
+	}
+}
+
+func TestOutboxMaxLag(t *testing.T) {
+	o := newOutbox(2, 20*time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if _, ok := o.push(OutboundMessage{Type: "Chat"}, false); !ok {
+			t.Fatalf("got player disconnected pushing message %d before lagging for too long", i)
+		}
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := o.push(OutboundMessage{Type: "Chat"}, false); ok {
+		t.Fatalf("got player still connected after lagging past the max lag")
+	}
+
+	// catching up resets the lag
+	o = newOutbox(2, 20*time.Millisecond)
+	for i := 0; i < 3; i++ {
+		o.push(OutboundMessage{Type: "Chat"}, false)
+	}
+	o.pop()
+	time.Sleep(30 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if _, ok := o.push(OutboundMessage{Type: "Chat"}, false); !ok {
+			t.Fatalf("got player disconnected pushing message %d after catching up", i)
+		}
+	}
+
+	// the queue may only grow so far whatever the lag
+	o = newOutbox(2, time.Minute)
+	for i := 0; i < 2*maxQueueGrowth; i++ {
+		if _, ok := o.push(OutboundMessage{Type: "Chat"}, false); !ok {
+			t.Fatalf("got player disconnected pushing message %d within the max queue growth", i)
+		}
+	}
+	if _, ok := o.push(OutboundMessage{Type: "Chat"}, false); ok {
+		t.Fatalf("got player still connected past the max queue growth")
+	}
+}
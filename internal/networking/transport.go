@@ -0,0 +1,315 @@
+package go_boardgame_networking
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Transport carries messages between a player and their game server
+type Transport interface {
+	// Read blocks until the next message from the player
+	Read() (msgType int, payload []byte, err error)
+
+	// Write sends a message to the player
+	Write(msgType int, payload []byte) error
+
+	// Ping keeps the connection alive and checks the player is still reachable
+	Ping() error
+
+	// Close tells the player the connection is closing, if supported, and closes it
+	Close() error
+
+	// Configure applies the connection options of the game being joined before any message is read or written
+	Configure(options ConnectionOptions)
+
+	// Name identifies the kind of transport in metrics such as websocket or sse
+	Name() string
+}
+
+// websocketTransport sends and receives messages over a websocket connection
+type websocketTransport struct {
+	conn    *websocket.Conn
+	options ConnectionOptions
+}
+
+// NewWebsocketTransport returns a transport over the websocket connection
+func NewWebsocketTransport(conn *websocket.Conn) Transport {
+	t := &websocketTransport{conn: conn}
+	t.Configure(ConnectionOptions{}.withDefaults(ConnectionOptions{}))
+	return t
+}
+
+func (t *websocketTransport) Name() string { return "websocket" }
+
+func (t *websocketTransport) Configure(options ConnectionOptions) {
+	t.options = options
+	_ = t.conn.SetReadDeadline(time.Now().Add(options.PongWait))
+	t.conn.SetPongHandler(func(string) error { _ = t.conn.SetReadDeadline(time.Now().Add(options.PongWait)); return nil })
+}
+
+// Read returns the next message or ErrMessageTooLarge if it is over the max message size
+// the size is checked here rather than with a read limit on the connection, which closes it, so the player may be told why they are disconnected
+func (t *websocketTransport) Read() (int, []byte, error) {
+	msgType, r, err := t.conn.NextReader()
+	if err != nil {
+		return msgType, nil, err
+	}
+	payload, err := io.ReadAll(io.LimitReader(r, t.options.MaxMessageSize+1))
+	if err != nil {
+		return msgType, nil, err
+	}
+	if int64(len(payload)) > t.options.MaxMessageSize {
+		return msgType, nil, ErrMessageTooLarge(t.options.MaxMessageSize)
+	}
+	return msgType, payload, nil
+}
+
+func (t *websocketTransport) Write(msgType int, payload []byte) error {
+	_ = t.conn.SetWriteDeadline(time.Now().Add(t.options.WriteWait))
+	return t.conn.WriteMessage(msgType, payload)
+}
+
+func (t *websocketTransport) Ping() error {
+	return t.Write(websocket.PingMessage, []byte{})
+}
+
+// Close may be called while a write is blocked so the close frame is written as a control message which is safe to send concurrently
+func (t *websocketTransport) Close() error {
+	_ = t.conn.WriteControl(websocket.CloseMessage, []byte{}, time.Now().Add(t.options.WriteWait))
+	return t.conn.Close()
+}
+
+// posted receives messages from a player that are posted in requests separate to those messages are sent on
+type posted struct {
+	inbound chan []byte
+	options ConnectionOptions
+
+	mu     sync.Mutex
+	closed bool
+	done   chan struct{}
+}
+
+func newPosted() posted {
+	return posted{
+		inbound: make(chan []byte),
+		options: ConnectionOptions{}.withDefaults(ConnectionOptions{}),
+		done:    make(chan struct{}),
+	}
+}
+
+func (t *posted) Read() (int, []byte, error) {
+	select {
+	case payload := <-t.inbound:
+		return websocket.TextMessage, payload, nil
+	case <-t.done:
+		return 0, nil, ErrTransportClosed
+	}
+}
+
+func (t *posted) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.closed {
+		t.closed = true
+		close(t.done)
+	}
+	return nil
+}
+
+// Done is closed once the transport is closed
+func (t *posted) Done() <-chan struct{} {
+	return t.done
+}
+
+func (t *posted) Configure(options ConnectionOptions) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.options = options
+}
+
+// Post passes a message from the player to the game server
+func (t *posted) Post(ctx context.Context, payload []byte) error {
+	t.mu.Lock()
+	limit := t.options.MaxMessageSize
+	t.mu.Unlock()
+	if int64(len(payload)) > limit {
+		return ErrMessageTooLarge(limit)
+	}
+	select {
+	case t.inbound <- payload:
+		return nil
+	case <-t.done:
+		return ErrTransportClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SSETransport sends messages as server-sent events with messages from the player posted separately
+type SSETransport struct {
+	posted
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+// NewSSETransport starts an event stream on the response and sends the session ID used to post messages as the first event
+func NewSSETransport(w http.ResponseWriter, sessionID string) (*SSETransport, error) {
+	t := &SSETransport{
+		posted: newPosted(),
+		w:      w,
+		rc:     http.NewResponseController(w),
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // stops proxies such as nginx from buffering events
+	w.WriteHeader(http.StatusOK)
+	if err := t.write([]byte(fmt.Sprintf("event: session\ndata: %s\n\n", sessionID))); err != nil {
+		return nil, ErrStreamingUnsupported
+	}
+	return t, nil
+}
+
+// Write sends the message as an event, binary messages are not supported as events are text only
+func (t *SSETransport) Write(msgType int, payload []byte) error {
+	if msgType != websocket.TextMessage {
+		return ErrBinaryUnsupported
+	}
+	// events end at a blank line so each line of the payload is sent as its own data field
+	var event bytes.Buffer
+	for _, line := range bytes.Split(payload, []byte("\n")) {
+		event.WriteString("data: ")
+		event.Write(line)
+		event.WriteString("\n")
+	}
+	event.WriteString("\n")
+	return t.write(event.Bytes())
+}
+
+// Ping sends a comment which clients ignore
+func (t *SSETransport) Ping() error {
+	return t.write([]byte(": ping\n\n"))
+}
+
+func (t *SSETransport) Name() string { return "sse" }
+
+// Wait blocks until the transport is closed or the context is done which closes the transport
+// the response writer may not be used once the handler returns so handlers must wait before returning
+func (t *SSETransport) Wait(ctx context.Context) {
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+		_ = t.Close()
+	}
+}
+
+func (t *SSETransport) write(payload []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return ErrTransportClosed
+	}
+	_ = t.rc.SetWriteDeadline(time.Now().Add(t.options.WriteWait))
+	if _, err := t.w.Write(payload); err != nil {
+		return err
+	}
+	return t.rc.Flush()
+}
+
+// LongPollTransport queues messages until the player polls for them with messages from the player posted separately
+// the player is disconnected if they do not poll within the pong wait as they are then assumed to be gone
+type LongPollTransport struct {
+	posted
+	messages [][]byte
+	ready    chan struct{} // signalled whenever messages are queued or the transport is closed
+	polling  int           // number of polls waiting on messages
+	lastPoll time.Time
+}
+
+func NewLongPollTransport() *LongPollTransport {
+	return &LongPollTransport{
+		posted:   newPosted(),
+		ready:    make(chan struct{}, 1),
+		lastPoll: time.Now(),
+	}
+}
+
+// Write queues the message until the next poll, binary messages are not supported as polls are answered with json
+// messages are already queued in the player's outbox so this only holds those written between polls
+func (t *LongPollTransport) Write(msgType int, payload []byte) error {
+	if msgType != websocket.TextMessage {
+		return ErrBinaryUnsupported
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return ErrTransportClosed
+	}
+	if len(t.messages) >= t.options.SendBuffer*maxQueueGrowth {
+		return ErrTransportLagging
+	}
+	t.messages = append(t.messages, payload)
+	select {
+	case t.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Ping fails once the player has gone longer than the pong wait without polling
+func (t *LongPollTransport) Ping() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return ErrTransportClosed
+	}
+	if t.polling == 0 && time.Since(t.lastPoll) > t.options.PongWait {
+		return ErrTransportClosed
+	}
+	return nil
+}
+
+func (t *LongPollTransport) Name() string { return "longpoll" }
+
+// Poll waits up to wait for messages returning all those queued
+// it returns ErrTransportClosed once the transport is closed and every queued message has been polled
+func (t *LongPollTransport) Poll(ctx context.Context, wait time.Duration) ([][]byte, error) {
+	t.mu.Lock()
+	t.polling++
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		t.polling--
+		t.lastPoll = time.Now()
+		t.mu.Unlock()
+	}()
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		t.mu.Lock()
+		messages, closed := t.messages, t.closed
+		t.messages = nil
+		t.mu.Unlock()
+		if len(messages) > 0 {
+			return messages, nil
+		}
+		if closed {
+			return nil, ErrTransportClosed
+		}
+		select {
+		case <-t.ready:
+		case <-t.done:
+		case <-timer.C:
+			return [][]byte{}, nil
+		case <-ctx.Done():
+			return [][]byte{}, nil
+		}
+	}
+}
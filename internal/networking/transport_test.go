@@ -0,0 +1,42 @@
+package go_boardgame_networking
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestLongPollTransportPoll(t *testing.T) {
+	transport := NewLongPollTransport()
+	ctx := context.Background()
+
+	messages, err := transport.Poll(ctx, 10*time.Millisecond)
+	if err != nil || len(messages) != 0 {
+		t.Fatalf("got %d messages and %v polling an empty transport, want none", len(messages), err)
+	}
+
+	// a poll waiting on messages returns as soon as one is written
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = transport.Write(websocket.TextMessage, []byte(`{"Type":"Game"}`))
+	}()
+	messages, err = transport.Poll(ctx, time.Second)
+	if err != nil || len(messages) != 1 {
+		t.Fatalf("got %d messages and %v, want the written message", len(messages), err)
+	}
+
+	// messages written before closing are polled before the transport reports it is closed
+	_ = transport.Write(websocket.TextMessage, []byte(`{"Type":"Connected"}`))
+	_ = transport.Close()
+	if messages, err = transport.Poll(ctx, time.Second); err != nil || len(messages) != 1 {
+		t.Fatalf("got %d messages and %v after closing, want the message written before closing", len(messages), err)
+	}
+	if _, err = transport.Poll(ctx, time.Second); err != ErrTransportClosed {
+		t.Errorf("got %v, want %v", err, ErrTransportClosed)
+	}
+	if err := transport.Write(websocket.BinaryMessage, []byte{0}); err != ErrBinaryUnsupported {
+		t.Errorf("got %v writing a binary message, want %v", err, ErrBinaryUnsupported)
+	}
+}
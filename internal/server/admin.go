@@ -0,0 +1,92 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/quibbble/go-quibbble/pkg/logger"
+)
+
+func (h *Handler) AdminListGames(w http.ResponseWriter, r *http.Request) {
+	games, err := h.network.ListGames(r.Context())
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	writeJSONResponse(h.render, w, http.StatusOK, AdminGamesResponse{Games: games})
+}
+
+func (h *Handler) AdminCloseGame(w http.ResponseWriter, r *http.Request) {
+	var req AdminGameRequest
+	if err := unmarshalJSONRequestBody(r, &req); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	if err := h.network.CloseGame(r.Context(), req.GameKey, req.GameID); err != nil {
+		logger.Log.Error().Caller().Err(err).Msgf("failed to close game '%s' for '%s'", req.GameID, req.GameKey)
+		h.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) AdminStoreGame(w http.ResponseWriter, r *http.Request) {
+	var req AdminGameRequest
+	if err := unmarshalJSONRequestBody(r, &req); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	if err := h.network.StoreGame(r.Context(), req.GameKey, req.GameID); err != nil {
+		logger.Log.Error().Caller().Err(err).Msgf("failed to store game '%s' for '%s'", req.GameID, req.GameKey)
+		h.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) AdminKickPlayer(w http.ResponseWriter, r *http.Request) {
+	var req AdminKickRequest
+	if err := unmarshalJSONRequestBody(r, &req); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	if err := h.network.KickPlayer(r.Context(), req.GameKey, req.GameID, req.PlayerName); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) AdminBroadcast(w http.ResponseWriter, r *http.Request) {
+	var req AdminBroadcastRequest
+	if err := unmarshalJSONRequestBody(r, &req); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	if req.Message == "" {
+		h.writeError(w, &validationError{message: "message is required"})
+		return
+	}
+	if req.GameKey == "" && req.GameID != "" {
+		h.writeError(w, &validationError{message: "game key is required when game id is set"})
+		return
+	}
+	if err := h.network.Broadcast(r.Context(), req.GameKey, req.GameID, req.Message); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) AdminMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req AdminMaintenanceRequest
+	if err := unmarshalJSONRequestBody(r, &req); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	if err := h.network.SetMaintenance(r.Context(), req.GameKey, req.Enabled); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	logger.Log.Info().Msgf("maintenance mode set to %t for '%s'", req.Enabled, req.GameKey)
+	w.WriteHeader(http.StatusNoContent)
+}
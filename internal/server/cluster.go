@@ -0,0 +1,126 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/quibbble/go-quibbble/internal/cluster"
+	networking "github.com/quibbble/go-quibbble/internal/networking"
+	"github.com/quibbble/go-quibbble/pkg/logger"
+)
+
+// handoffTimeout bounds how long storing and closing games no longer owned by this node may take
+const handoffTimeout = 30 * time.Second
+
+// gameAffinity forwards requests for games owned by another node in the cluster
+// requests for sessions go to the node named in the session ID as the session lives on that node even once the game has moved
+// requests for games taken over from another node wait until that node has handed them off
+func gameAffinity(c *cluster.Cluster) func(h http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(cluster.ForwardedHeader) != "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+			if node := sessionNode(requestSession(r)); node == c.Addr() {
+				h.ServeHTTP(w, r)
+				return
+			} else if node != "" && slices.Contains(c.Members(), node) {
+				c.Forward(w, r, node)
+				return
+			}
+			gameKey, gameID := requestGame(r)
+			if gameKey == "" || gameID == "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+			if owner := c.Owner(gameKey, gameID); owner != c.Addr() {
+				c.Forward(w, r, owner)
+				return
+			}
+			if err := c.Await(r.Context(), gameKey, gameID); err != nil {
+				logger.Log.Warn().Err(err).Msgf("game '%s' for '%s' is still being handed off", gameID, gameKey)
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requestSession returns the session ID from the path or the query
+func requestSession(r *http.Request) string {
+	if _, after, ok := strings.Cut(r.URL.Path, "/sessions/"); ok {
+		sessionID, _, _ := strings.Cut(after, "/")
+		return sessionID
+	}
+	return r.URL.Query().Get("SessionID")
+}
+
+// requestGame returns the game key and game ID from the path, the query or, for requests with a body, the json body
+func requestGame(r *http.Request) (string, string) {
+	if gameKey, gameID := gameParams(r); gameKey != "" && gameID != "" {
+		return gameKey, gameID
+	}
+	gameKey, gameID := r.URL.Query().Get("GameKey"), r.URL.Query().Get("GameID")
+	if r.Body == nil || r.Method == http.MethodGet || (gameKey != "" && gameID != "") {
+		return gameKey, gameID
+	}
+	body, err := io.ReadAll(r.Body)
+	_ = r.Body.Close()
+	if err != nil {
+		// the handler fails reading the body the same way
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), &failedBody{err: err}))
+		return "", ""
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	var game struct {
+		GameKey string
+		GameID  string
+	}
+	_ = json.Unmarshal(body, &game)
+	return game.GameKey, game.GameID
+}
+
+// handoff stores and closes every game no longer owned by this node so the new owner can load it from the game store
+// it fails if any game could not be handed off so the cluster retries rather than let the new owner load a stale copy
+func handoff(network *networking.GameNetwork, c *cluster.Cluster) error {
+	ctx, cancel := context.WithTimeout(context.Background(), handoffTimeout)
+	defer cancel()
+	activeGameIDs, err := network.GetActiveGameIDs(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for gameKey, gameIDs := range activeGameIDs {
+		for _, gameID := range gameIDs {
+			if c.IsOwner(gameKey, gameID) {
+				continue
+			}
+			logger.Log.Info().Msgf("handing off game '%s' for '%s' to '%s'", gameID, gameKey, c.Owner(gameKey, gameID))
+			// a game that closed in between was stored when it closed
+			if err := network.CloseGame(ctx, gameKey, gameID); err != nil && !errors.Is(err, &networking.Error{Code: networking.CodeGameNotFound}) {
+				logger.Log.Error().Caller().Err(err).Msgf("failed to hand off game '%s' for '%s'", gameID, gameKey)
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// failedBody fails every read with the error reading the body first failed with
+type failedBody struct {
+	err error
+}
+
+func (b *failedBody) Read([]byte) (int, error) {
+	return 0, b.err
+}
@@ -3,24 +3,70 @@ package server
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 
+	"github.com/quibbble/go-quibbble/internal/cluster"
 	"github.com/quibbble/go-quibbble/internal/datastore"
 	"github.com/quibbble/go-quibbble/pkg/http"
 	"github.com/quibbble/go-quibbble/pkg/logger"
+	"github.com/quibbble/go-quibbble/pkg/tracing"
 )
 
 type Config struct {
 	Environment string
 	Log         logger.Config
+	Tracing     tracing.Config
 	Router      http.RouterConfig
 	Server      http.ServerConfig
+	GRPC        GRPCConfig
 	Datastore   datastore.DatastoreConfig
 	Network     NetworkOptions
+	Create      CreateConfig
+	Admin       AdminConfig
+	Cluster     cluster.Config
+	Drain       DrainConfig
+}
+
+type AdminConfig struct {
+	// Token is the bearer token required to access the admin routes - admin routes are disabled if empty
+	Token string
+}
+
+type CreateConfig struct {
+	// IDAlphabet is the characters generated game IDs are made of
+	IDAlphabet string
+
+	// IDLength is the number of characters in generated game IDs
+	IDLength int
+
+	// IdempotencyTTL is how long responses to creates with an Idempotency-Key header are replayed - not replayed if zero
+	IdempotencyTTL time.Duration
+}
+
+type DrainConfig struct {
+	// Delay is how long to keep serving after readiness fails before players are told to reconnect - no delay if zero
+	// load balancers should stop routing traffic here within the delay so reconnecting players reach another server
+	Delay time.Duration
+
+	// Window is the max time to wait for games to pause before storing and closing them - no drain if zero
+	Window time.Duration
+
+	// IdleAfter is how long a game must go without an action to be considered paused
+	IdleAfter time.Duration
+
+	// ReconnectAfter is the hint sent to players for how long to wait before reconnecting
+	ReconnectAfter time.Duration
+
+	// Timeout is the max time to store and close all games and stop the server once draining has finished
+	Timeout time.Duration
 }
 
 func (c Config) Str() string {
 	c.Datastore.Cockroach.Host = "***"
 	c.Datastore.Cockroach.Password = "***"
+	c.Datastore.Redis.Password = "***"
+	c.Admin.Token = "***"
+	c.Cluster.Redis.Password = "***"
 	var str string
 	if c.Environment == "local" {
 		raw, _ := json.MarshalIndent(c, "", "  ")
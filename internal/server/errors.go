@@ -0,0 +1,107 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/quibbble/go-quibbble/internal/datastore"
+	networking "github.com/quibbble/go-quibbble/internal/networking"
+)
+
+const (
+	// codeInvalidRequest is returned when a request cannot be parsed or does not match its schema
+	codeInvalidRequest = "InvalidRequest"
+
+	// codeGameStoreDisabled is returned when a request needs the game store but it is not enabled
+	codeGameStoreDisabled = "GameStoreDisabled"
+
+	// codeSessionNotFound is returned when an action is posted to an event stream that does not exist
+	codeSessionNotFound = "SessionNotFound"
+
+	// codeGameIDUnavailable is returned when no free game ID could be generated
+	codeGameIDUnavailable = "GameIDUnavailable"
+
+	// codeIdempotencyKeyReused is returned when an idempotency key is sent again with a different request body
+	codeIdempotencyKeyReused = "IdempotencyKeyReused"
+)
+
+var (
+	errTooManyTeams = &networking.Error{Code: networking.CodeInvalidOptions, Message: "too many teams"}
+	errKeyMismatch  = &networking.Error{Code: networking.CodeInvalidOptions, Message: "game key does not match bgn key"}
+	errInvalidBGN   = func(err error) error {
+		return &networking.Error{Code: networking.CodeInvalidOptions, Message: err.Error()}
+	}
+	errSessionNotFound = &networking.Error{Code: codeSessionNotFound, Message: "session does not exist"}
+	errNoGameID        = &networking.Error{Code: codeGameIDUnavailable, Message: "failed to generate a free game id"}
+	errWatchTimeout    = &networking.Error{Code: networking.CodeTransportClosed, Message: "timed out sending to the watcher"}
+	errBodyTooLarge    = &networking.Error{Code: networking.CodeMessageTooLarge, Message: "request body is too large"}
+	errInvalidBody     = &validationError{message: "invalid request body"}
+
+	errInvalidIdempotencyKey = &networking.Error{Code: codeInvalidRequest, Message: fmt.Sprintf("%s must be at most %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength)}
+	errIdempotencyKeyReused  = &networking.Error{Code: codeIdempotencyKeyReused, Message: fmt.Sprintf("%s was already used with a different request", idempotencyKeyHeader)}
+
+	errShortIDAlphabet      = fmt.Errorf("game id alphabet must have at least two characters")
+	errDuplicateIDCharacter = func(r rune) error {
+		return fmt.Errorf("game id alphabet has duplicate character '%c'", r)
+	}
+	errInvalidIDLength = func(length int) error {
+		return fmt.Errorf("game id length %d must not be negative", length)
+	}
+)
+
+// errorStatuses maps kinds of errors to the status and code they are returned with, checked in order with errors.Is
+var errorStatuses = []struct {
+	target error
+	status int
+	code   string
+}{
+	{datastore.ErrGameStoreNotFound, http.StatusNotFound, networking.CodeGameNotFound},
+	{datastore.ErrGameStoreCursor, http.StatusBadRequest, codeInvalidRequest},
+	{datastore.ErrGameStoreNotEnabled, http.StatusServiceUnavailable, codeGameStoreDisabled},
+	{errSessionNotFound, http.StatusNotFound, ""},
+	{errNoGameID, http.StatusServiceUnavailable, ""},
+	{errInvalidIdempotencyKey, http.StatusBadRequest, ""},
+	{errIdempotencyKeyReused, http.StatusUnprocessableEntity, ""},
+	{&networking.Error{Code: networking.CodeGameKeyNotFound}, http.StatusNotFound, ""},
+	{&networking.Error{Code: networking.CodeGameNotFound}, http.StatusNotFound, ""},
+	{&networking.Error{Code: networking.CodePlayerNotFound}, http.StatusNotFound, ""},
+	{&networking.Error{Code: networking.CodeGameExists}, http.StatusConflict, ""},
+	{&networking.Error{Code: networking.CodeInvalidOptions}, http.StatusBadRequest, ""},
+	{&networking.Error{Code: networking.CodeInvalidMessage}, http.StatusBadRequest, ""},
+	{&networking.Error{Code: networking.CodeInvalidTeam}, http.StatusBadRequest, ""},
+	{&networking.Error{Code: networking.CodeUnsupported}, http.StatusBadRequest, ""},
+	{&networking.Error{Code: networking.CodeBGNUnsupported}, http.StatusBadRequest, ""},
+	{&networking.Error{Code: networking.CodeUnauthorized}, http.StatusForbidden, ""},
+	{&networking.Error{Code: networking.CodeGameClosed}, http.StatusGone, ""},
+	{&networking.Error{Code: networking.CodeTransportClosed}, http.StatusGone, ""},
+	{&networking.Error{Code: networking.CodeMessageTooLarge}, http.StatusRequestEntityTooLarge, ""},
+	{&networking.Error{Code: networking.CodeRateLimited}, http.StatusTooManyRequests, ""},
+	{&networking.Error{Code: networking.CodeTooManyConnections}, http.StatusTooManyRequests, ""},
+	{&networking.Error{Code: networking.CodeMaintenance}, http.StatusServiceUnavailable, ""},
+	{&networking.Error{Code: networking.CodeDraining}, http.StatusServiceUnavailable, ""},
+	{&networking.Error{Code: networking.CodeRestarted}, http.StatusServiceUnavailable, ""},
+}
+
+// errorStatus returns the http status and machine readable code of an error
+func errorStatus(err error) (int, string) {
+	var verr *validationError
+	if errors.As(err, &verr) {
+		return http.StatusBadRequest, codeInvalidRequest
+	}
+	for _, e := range errorStatuses {
+		if errors.Is(err, e.target) {
+			if e.code != "" {
+				return e.status, e.code
+			}
+			return e.status, networking.ErrorCode(err)
+		}
+	}
+	return http.StatusInternalServerError, networking.ErrorCode(err)
+}
+
+// writeError responds with the status and code of the error
+func (h *Handler) writeError(w http.ResponseWriter, err error) {
+	status, _ := errorStatus(err)
+	writeJSONResponse(h.render, w, status, newErrorResponse(err))
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	bg "github.com/quibbble/go-boardgame"
+	networking "github.com/quibbble/go-quibbble/internal/networking"
+	quill "github.com/quibbble/go-quill"
+)
+
+// moreOptions are the options of games that cannot be created with teams alone
+var moreOptions = map[string]interface{}{
+	quillBuilder.Key(): quill.QuillMoreOptions{Seed: 123, Decks: [][]string{quillDeck(), quillDeck()}},
+}
+
+func quillDeck() []string {
+	deck := make([]string, 0, 30)
+	for i := 0; i < 30; i++ {
+		card := "U0002"
+		if i < 10 {
+			card = "S0001"
+		}
+		deck = append(deck, card)
+	}
+	return deck
+}
+
+// BenchmarkEncode measures encoding a game message holding the snapshot of a new game of each registered game in each encoding
+func BenchmarkEncode(b *testing.B) {
+	for gameKey, builder := range games {
+		payload := gameMessage(b, builder)
+		for _, encoding := range []string{networking.EncodingJSON, networking.EncodingMsgpack, networking.EncodingCBOR} {
+			b.Run(fmt.Sprintf("%s/%s", gameKey, encoding), func(b *testing.B) {
+				b.ReportAllocs()
+				var encoded []byte
+				for i := 0; i < b.N; i++ {
+					var err error
+					if encoded, err = networking.Encode(encoding, payload); err != nil {
+						b.Fatalf("failed to encode: %s", err)
+					}
+				}
+				// json messages are written as marshalled so only the size of each encoding is compared
+				b.ReportMetric(float64(len(encoded)), "bytes/msg")
+			})
+		}
+	}
+}
+
+// gameMessage returns the game message sent to players of a new game with the fewest teams allowed
+func gameMessage(b *testing.B, builder bg.BoardGameBuilder) []byte {
+	b.Helper()
+	teams := make([]string, 0, builder.Info().MinTeams)
+	for i := 0; i < builder.Info().MinTeams; i++ {
+		teams = append(teams, fmt.Sprintf("team-%d", i))
+	}
+	game, err := builder.Create(&bg.BoardGameOptions{Teams: teams, MoreOptions: moreOptions[builder.Key()]})
+	if err != nil {
+		b.Fatalf("failed to create %s: %s", builder.Key(), err)
+	}
+	snapshot, err := game.GetSnapshot(teams[0])
+	if err != nil {
+		b.Fatalf("failed to get %s snapshot: %s", builder.Key(), err)
+	}
+	payload, err := json.Marshal(networking.OutboundMessage{Type: "Game", Seq: 1, Payload: snapshot})
+	if err != nil {
+		b.Fatalf("failed to marshal %s snapshot: %s", builder.Key(), err)
+	}
+	return payload
+}
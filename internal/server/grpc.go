@@ -0,0 +1,421 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	bg "github.com/quibbble/go-boardgame"
+	"github.com/quibbble/go-boardgame/pkg/bgn"
+	quibbblev1 "github.com/quibbble/go-quibbble/api/quibbble/v1"
+	"github.com/quibbble/go-quibbble/internal/datastore"
+	networking "github.com/quibbble/go-quibbble/internal/networking"
+	"github.com/quibbble/go-quibbble/pkg/duration"
+	"github.com/quibbble/go-quibbble/pkg/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// watchBuffer is the number of game events queued for a watcher before writes block and the watcher starts to lag
+	watchBuffer = 16
+
+	// defaultWatchWriteWait is how long a write to a watcher may block before the game's connection options are configured
+	defaultWatchWriteWait = 10 * time.Second
+)
+
+type GRPCConfig struct {
+	// Enabled serves the gRPC API on Port alongside the http server
+	Enabled bool
+	Port    string
+}
+
+// GRPCServer serves the gRPC API on its own port
+type GRPCServer struct {
+	*grpc.Server
+	port string
+}
+
+func NewGRPCServer(cfg GRPCConfig, network *networking.GameNetwork, gameStore datastore.GameStore, ids *gameIDs) *GRPCServer {
+	server := grpc.NewServer()
+	quibbblev1.RegisterQuibbbleServer(server, &grpcService{
+		network:   network,
+		gameStore: gameStore,
+		ids:       ids,
+	})
+	reflection.Register(server)
+	return &GRPCServer{
+		Server: server,
+		port:   cfg.Port,
+	}
+}
+
+func (s *GRPCServer) Start(errCh chan<- error) {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", s.port))
+	if err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to listen for grpc")
+		errCh <- err
+		return
+	}
+	logger.Log.Info().Msg(fmt.Sprintf("grpc server started on 0.0.0.0:%s", s.port))
+	if err := s.Serve(lis); err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("grpc server stopped unexpectedly")
+		errCh <- err
+		return
+	}
+	logger.Log.Info().Msg("grpc server stopped")
+}
+
+// Serve serves the gRPC API on the listener until the server stops, tests serve on an in memory listener
+func (s *GRPCServer) Serve(lis net.Listener) error {
+	return s.Server.Serve(lis)
+}
+
+// Shutdown waits for in flight calls to finish, cancelling any still running once the context is done
+func (s *GRPCServer) Shutdown(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.Stop()
+		return ctx.Err()
+	}
+}
+
+// grpcService implements the gRPC API with the same game network as the http handler
+type grpcService struct {
+	quibbblev1.UnimplementedQuibbbleServer
+	network   *networking.GameNetwork
+	gameStore datastore.GameStore
+	ids       *gameIDs
+}
+
+func (g *grpcService) CreateGame(ctx context.Context, req *quibbblev1.CreateGameRequest) (*quibbblev1.CreateGameResponse, error) {
+	if int(req.GetTeams()) > len(teams) {
+		return nil, status.Error(codes.InvalidArgument, "too many teams")
+	}
+	t := make([]string, 0)
+	for i := 0; i < int(req.GetTeams()); i++ {
+		t = append(t, teams[i])
+	}
+	var moreOptions interface{}
+	if req.GetMoreOptions() != nil {
+		moreOptions = req.GetMoreOptions().AsMap()
+	}
+	options := newNetworkOptions(req.GetNetworkOptions())
+	if err := g.ids.assign(options, func() error {
+		return g.network.CreateGame(ctx, networking.CreateGameOptions{
+			NetworkOptions: options,
+			GameOptions: &bg.BoardGameOptions{
+				Teams:       t,
+				MoreOptions: moreOptions,
+			},
+		})
+	}); err != nil {
+		return nil, grpcError(err)
+	}
+	return &quibbblev1.CreateGameResponse{
+		GameKey: options.GameKey,
+		GameId:  options.GameID,
+	}, nil
+}
+
+func (g *grpcService) LoadGame(ctx context.Context, req *quibbblev1.LoadGameRequest) (*quibbblev1.LoadGameResponse, error) {
+	game, err := bgn.Parse(req.GetBgn())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if game.Tags["Game"] != req.GetNetworkOptions().GetGameKey() {
+		return nil, status.Error(codes.InvalidArgument, "game key does not match bgn key")
+	}
+	if len(strings.Split(game.Tags["Teams"], ", ")) > len(teams) {
+		return nil, status.Error(codes.InvalidArgument, "too many teams")
+	}
+	t := make([]string, 0)
+	for i := range strings.Split(game.Tags["Teams"], ", ") {
+		t = append(t, teams[i])
+	}
+	game.Tags["Teams"] = strings.Join(t, ", ")
+	options := newNetworkOptions(req.GetNetworkOptions())
+	if err := g.ids.assign(options, func() error {
+		return g.network.CreateGame(ctx, networking.CreateGameOptions{
+			NetworkOptions: options,
+			BGN:            game,
+		})
+	}); err != nil {
+		return nil, grpcError(err)
+	}
+	return &quibbblev1.LoadGameResponse{
+		GameKey: options.GameKey,
+		GameId:  options.GameID,
+	}, nil
+}
+
+func (g *grpcService) GetSnapshot(ctx context.Context, req *quibbblev1.GetSnapshotRequest) (*quibbblev1.GetSnapshotResponse, error) {
+	var snapshot interface{}
+	var err error
+	if req.GetTeam() != "" {
+		snapshot, err = g.network.GetSnapshot(ctx, req.GetGameKey(), req.GetGameId(), req.GetTeam())
+	} else {
+		snapshot, err = g.network.GetSnapshot(ctx, req.GetGameKey(), req.GetGameId())
+	}
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	s, err := toStruct(snapshot)
+	if err != nil {
+		logger.Log.Error().Caller().Err(err).Msgf("failed to convert game snapshot '%s' for '%s'", req.GetGameId(), req.GetGameKey())
+		return nil, status.Error(codes.Internal, "failed to convert snapshot")
+	}
+	return &quibbblev1.GetSnapshotResponse{Snapshot: s}, nil
+}
+
+func (g *grpcService) GetBGN(ctx context.Context, req *quibbblev1.GetBGNRequest) (*quibbblev1.GetBGNResponse, error) {
+	game, err := g.network.GetBGN(ctx, req.GetGameKey(), req.GetGameId())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &quibbblev1.GetBGNResponse{Bgn: game.String()}, nil
+}
+
+func (g *grpcService) GetStats(ctx context.Context, _ *quibbblev1.GetStatsRequest) (*quibbblev1.GetStatsResponse, error) {
+	statsStored, err := g.gameStore.GetStats(ctx, g.network.GetGames())
+	if err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to retrieve game stats")
+		statsStored = &datastore.Stats{}
+	}
+	statsCurrent, err := g.network.GetStats(ctx)
+	if err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to retrieve network stats")
+		return nil, grpcError(err)
+	}
+	return &quibbblev1.GetStatsResponse{
+		GamesCreated:  toInt64s(statsStored.GamesCreated),
+		GamesPlayed:   toInt64s(statsStored.GamesPlayed),
+		ActiveGames:   toInt64s(statsCurrent.ActiveGames),
+		ActivePlayers: toInt64s(statsCurrent.ActivePlayers),
+		StoredBytes:   toInt64s(statsStored.StoredBytes),
+		RawBytes:      toInt64s(statsStored.RawBytes),
+	}, nil
+}
+
+func (g *grpcService) GetInfo(_ context.Context, req *quibbblev1.GetInfoRequest) (*quibbblev1.GetInfoResponse, error) {
+	info, err := g.network.GetInfo(req.GetGameKey())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	s, err := toStruct(info)
+	if err != nil {
+		logger.Log.Error().Caller().Err(err).Msgf("failed to convert game info for '%s'", req.GetGameKey())
+		return nil, status.Error(codes.Internal, "failed to convert info")
+	}
+	return &quibbblev1.GetInfoResponse{Info: s}, nil
+}
+
+func (g *grpcService) ListGames(ctx context.Context, _ *quibbblev1.ListGamesRequest) (*quibbblev1.ListGamesResponse, error) {
+	summaries, err := g.network.ListGames(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	games := make([]*quibbblev1.GameSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		games = append(games, &quibbblev1.GameSummary{
+			GameKey:   summary.GameKey,
+			GameId:    summary.GameID,
+			Players:   summary.Players,
+			CreatedAt: timestamppb.New(summary.CreatedAt),
+			UpdatedAt: timestamppb.New(summary.UpdatedAt),
+			PlayCount: int64(summary.PlayCount),
+			ReadOnly:  summary.ReadOnly,
+		})
+	}
+	return &quibbblev1.ListGamesResponse{Games: games}, nil
+}
+
+// WatchGame joins the game as a watcher and streams every message it is sent until the game or stream closes
+func (g *grpcService) WatchGame(req *quibbblev1.WatchGameRequest, stream quibbblev1.Quibbble_WatchGameServer) error {
+	ctx := stream.Context()
+	transport := newWatchTransport()
+	defer transport.Close()
+	if err := g.network.JoinGame(ctx, networking.JoinGameOptions{
+		GameKey:    req.GetGameKey(),
+		GameID:     req.GetGameId(),
+		PlayerName: generateName(),
+		Transport:  transport,
+		Watch:      true,
+		Team:       req.GetTeam(),
+	}); err != nil {
+		return grpcError(err)
+	}
+	for {
+		select {
+		case event := <-transport.events:
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		case <-transport.done:
+			return nil
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// watchTransport passes messages sent to a watcher on to their gRPC stream, watchers never send messages
+type watchTransport struct {
+	events chan *quibbblev1.GameEvent
+	done   chan struct{}
+	once   sync.Once
+
+	mu        sync.Mutex
+	writeWait time.Duration
+}
+
+func newWatchTransport() *watchTransport {
+	return &watchTransport{
+		events:    make(chan *quibbblev1.GameEvent, watchBuffer),
+		done:      make(chan struct{}),
+		writeWait: defaultWatchWriteWait,
+	}
+}
+
+func (t *watchTransport) Read() (int, []byte, error) {
+	<-t.done
+	return 0, nil, networking.ErrTransportClosed
+}
+
+func (t *watchTransport) Write(_ int, data []byte) error {
+	var message struct {
+		Type    string
+		Seq     int64
+		Code    string
+		Payload interface{}
+	}
+	if err := json.Unmarshal(data, &message); err != nil {
+		return err
+	}
+	payload, err := structpb.NewValue(message.Payload)
+	if err != nil {
+		return err
+	}
+	// like a websocket write a watcher whose stream stops taking events within the write wait is disconnected
+	t.mu.Lock()
+	deadline := time.NewTimer(t.writeWait)
+	t.mu.Unlock()
+	defer deadline.Stop()
+	select {
+	case t.events <- &quibbblev1.GameEvent{
+		Type:    message.Type,
+		Seq:     message.Seq,
+		Code:    message.Code,
+		Payload: payload,
+	}:
+		return nil
+	case <-t.done:
+		return networking.ErrTransportClosed
+	case <-deadline.C:
+		return errWatchTimeout
+	}
+}
+
+func (t *watchTransport) Ping() error {
+	select {
+	case <-t.done:
+		return networking.ErrTransportClosed
+	default:
+		return nil
+	}
+}
+
+func (t *watchTransport) Close() error {
+	t.once.Do(func() { close(t.done) })
+	return nil
+}
+
+func (t *watchTransport) Configure(options networking.ConnectionOptions) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if options.WriteWait > 0 {
+		t.writeWait = options.WriteWait
+	}
+}
+
+func (t *watchTransport) Name() string { return "grpc" }
+
+func newNetworkOptions(options *quibbblev1.NetworkOptions) *networking.NetworkingCreateGameOptions {
+	players := make(map[string][]string)
+	for team, ids := range options.GetPlayers() {
+		players[team] = ids.GetPlayerIds()
+	}
+	var turnLength *duration.Duration
+	if options.GetTurnLength() != nil {
+		d := duration.Duration(options.GetTurnLength().AsDuration())
+		turnLength = &d
+	}
+	return &networking.NetworkingCreateGameOptions{
+		GameKey:      options.GetGameKey(),
+		GameID:       options.GetGameId(),
+		Players:      players,
+		TurnLength:   turnLength,
+		SingleDevice: options.GetSingleDevice(),
+		OnConflict:   options.GetOnConflict(),
+	}
+}
+
+// grpcError converts an error from the game network to a gRPC status using its error code
+func grpcError(err error) error {
+	if err == context.DeadlineExceeded || err == context.Canceled {
+		return status.FromContextError(err).Err()
+	}
+	code := codes.Unknown
+	switch networking.ErrorCode(err) {
+	case networking.CodeGameKeyNotFound, networking.CodeGameNotFound, networking.CodePlayerNotFound:
+		code = codes.NotFound
+	case networking.CodeGameExists, networking.CodeAlreadyConnected:
+		code = codes.AlreadyExists
+	case networking.CodeInvalidMessage, networking.CodeInvalidOptions, networking.CodeInvalidTeam,
+		networking.CodeBGNUnsupported, networking.CodeUnsupported:
+		code = codes.InvalidArgument
+	case networking.CodeUnauthorized:
+		code = codes.PermissionDenied
+	case networking.CodeRateLimited, networking.CodeTooManyConnections:
+		code = codes.ResourceExhausted
+	case networking.CodeMaintenance, networking.CodeDraining, networking.CodeGameClosed, networking.CodeRestarted:
+		code = codes.Unavailable
+	}
+	return status.Error(code, err.Error())
+}
+
+// toStruct converts a value to a protobuf struct through its json representation
+func toStruct(v interface{}) (*structpb.Struct, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+	return structpb.NewStruct(m)
+}
+
+func toInt64s(m map[string]int) map[string]int64 {
+	converted := make(map[string]int64, len(m))
+	for k, v := range m {
+		converted[k] = int64(v)
+	}
+	return converted
+}
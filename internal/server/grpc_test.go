@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	bg "github.com/quibbble/go-boardgame"
+	quibbblev1 "github.com/quibbble/go-quibbble/api/quibbble/v1"
+	"github.com/quibbble/go-quibbble/internal/datastore"
+	networking "github.com/quibbble/go-quibbble/internal/networking"
+	tictactoe "github.com/quibbble/go-tictactoe"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestGRPCClient serves the gRPC API for tic-tac-toe games on an in memory listener returning a client and the network behind it
+func newTestGRPCClient(t *testing.T) (quibbblev1.QuibbbleClient, *networking.GameNetwork) {
+	t.Helper()
+	gameStore, err := datastore.NewCockroachClient(&datastore.CockroachConfig{})
+	if err != nil {
+		t.Fatalf("failed to create game store: %s", err)
+	}
+	network := networking.NewGameNetwork(networking.GameNetworkOptions{
+		Games:      []bg.BoardGameBuilder{&tictactoe.Builder{}},
+		GameExpiry: time.Minute,
+		GameStore:  gameStore,
+	})
+	ids, err := newGameIDs(CreateConfig{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create game ids: %s", err)
+	}
+	server := NewGRPCServer(GRPCConfig{}, network, gameStore, ids)
+	lis := bufconn.Listen(1 << 20)
+	go func() { _ = server.Serve(lis) }()
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial grpc server: %s", err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+		server.Stop()
+		_ = network.Close(context.Background())
+	})
+	return quibbblev1.NewQuibbbleClient(conn), network
+}
+
+func createTestGame(t *testing.T, client quibbblev1.QuibbbleClient, gameID string) {
+	t.Helper()
+	if _, err := client.CreateGame(context.Background(), &quibbblev1.CreateGameRequest{
+		NetworkOptions: &quibbblev1.NetworkOptions{GameKey: (&tictactoe.Builder{}).Key(), GameId: gameID},
+		Teams:          2,
+	}); err != nil {
+		t.Fatalf("failed to create game: %s", err)
+	}
+}
+
+func TestGRPCCreateGame(t *testing.T) {
+	client, _ := newTestGRPCClient(t)
+	ctx := context.Background()
+	gameKey := (&tictactoe.Builder{}).Key()
+
+	created, err := client.CreateGame(ctx, &quibbblev1.CreateGameRequest{
+		NetworkOptions: &quibbblev1.NetworkOptions{GameKey: gameKey},
+		Teams:          2,
+	})
+	if err != nil {
+		t.Fatalf("failed to create game: %s", err)
+	}
+	if created.GetGameKey() != gameKey || created.GetGameId() == "" {
+		t.Fatalf("got game '%s' '%s', want a generated id for '%s'", created.GetGameKey(), created.GetGameId(), gameKey)
+	}
+
+	for _, test := range []struct {
+		name string
+		req  *quibbblev1.CreateGameRequest
+		code codes.Code
+	}{
+		{"existing game", &quibbblev1.CreateGameRequest{NetworkOptions: &quibbblev1.NetworkOptions{GameKey: gameKey, GameId: created.GetGameId()}, Teams: 2}, codes.AlreadyExists},
+		{"unknown game key", &quibbblev1.CreateGameRequest{NetworkOptions: &quibbblev1.NetworkOptions{GameKey: "unknown", GameId: "example"}, Teams: 2}, codes.NotFound},
+		{"too many teams", &quibbblev1.CreateGameRequest{NetworkOptions: &quibbblev1.NetworkOptions{GameKey: gameKey, GameId: "example"}, Teams: 100}, codes.InvalidArgument},
+	} {
+		if _, err := client.CreateGame(ctx, test.req); status.Code(err) != test.code {
+			t.Errorf("got %v creating a game with %s, want %s", err, test.name, test.code)
+		}
+	}
+}
+
+func TestGRPCGetSnapshot(t *testing.T) {
+	client, _ := newTestGRPCClient(t)
+	ctx := context.Background()
+	gameKey := (&tictactoe.Builder{}).Key()
+	createTestGame(t, client, "example")
+
+	snapshot, err := client.GetSnapshot(ctx, &quibbblev1.GetSnapshotRequest{GameKey: gameKey, GameId: "example", Team: "red"})
+	if err != nil {
+		t.Fatalf("failed to get snapshot: %s", err)
+	}
+	if turn := snapshot.GetSnapshot().AsMap()["Turn"]; turn != "red" {
+		t.Errorf("got turn %v, want red", turn)
+	}
+	if _, err := client.GetSnapshot(ctx, &quibbblev1.GetSnapshotRequest{GameKey: gameKey, GameId: "missing"}); status.Code(err) != codes.NotFound {
+		t.Errorf("got %v getting a missing game, want %s", err, codes.NotFound)
+	}
+}
+
+func TestGRPCWatchGame(t *testing.T) {
+	client, network := newTestGRPCClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	gameKey := (&tictactoe.Builder{}).Key()
+	createTestGame(t, client, "example")
+
+	stream, err := client.WatchGame(ctx, &quibbblev1.WatchGameRequest{GameKey: gameKey, GameId: "example"})
+	if err != nil {
+		t.Fatalf("failed to watch game: %s", err)
+	}
+	// next returns the next event of the type skipping any others
+	next := func(eventType string) *quibbblev1.GameEvent {
+		t.Helper()
+		for {
+			event, err := stream.Recv()
+			if err != nil {
+				t.Fatalf("failed to receive %s event: %s", eventType, err)
+			}
+			if event.GetType() == eventType {
+				return event
+			}
+		}
+	}
+	next("Game")
+
+	// a player joined over the network takes a turn which the watcher is sent
+	player := networking.NewLongPollTransport()
+	defer player.Close()
+	if err := network.JoinGame(ctx, networking.JoinGameOptions{
+		GameKey:    gameKey,
+		GameID:     "example",
+		PlayerName: "player",
+		Transport:  player,
+	}); err != nil {
+		t.Fatalf("failed to join game: %s", err)
+	}
+	for _, action := range []bg.BoardGameAction{
+		{ActionType: networking.ServerActionSetTeam, MoreDetails: map[string]string{"Team": "red"}},
+		{Team: "red", ActionType: tictactoe.ActionMarkLocation, MoreDetails: tictactoe.MarkLocationActionDetails{Row: 1, Column: 1}},
+	} {
+		payload, _ := json.Marshal(action)
+		if err := player.Post(ctx, payload); err != nil {
+			t.Fatalf("failed to post %s: %s", action.ActionType, err)
+		}
+	}
+	for {
+		snapshot := next("Game").GetPayload().GetStructValue().AsMap()
+		if snapshot["Turn"] == "blue" {
+			break
+		}
+	}
+
+	// the stream ends once the game is closed, closing fails as the disabled game store cannot store the game
+	_ = network.Close(ctx)
+	for {
+		if _, err := stream.Recv(); err != nil {
+			if err != io.EOF {
+				t.Fatalf("got %v once the game closed, want the stream to end", err)
+			}
+			break
+		}
+	}
+}
+
+func TestWatchTransportWriteDeadline(t *testing.T) {
+	transport := newWatchTransport()
+	transport.Configure(networking.ConnectionOptions{WriteWait: 10 * time.Millisecond})
+	// nothing takes events off the stream so writes block once the buffer is full
+	for i := 0; i < watchBuffer; i++ {
+		if err := transport.Write(1, []byte(`{"Type":"Game"}`)); err != nil {
+			t.Fatalf("failed to write event %d: %s", i, err)
+		}
+	}
+	if err := transport.Write(1, []byte(`{"Type":"Game"}`)); err != errWatchTimeout {
+		t.Fatalf("got %v writing to a stalled watcher, want %v", err, errWatchTimeout)
+	}
+}
@@ -1,115 +1,190 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 	bg "github.com/quibbble/go-boardgame"
 	"github.com/quibbble/go-boardgame/pkg/bgn"
+	"github.com/quibbble/go-quibbble/api"
+	"github.com/quibbble/go-quibbble/internal/cluster"
 	"github.com/quibbble/go-quibbble/internal/datastore"
 	networking "github.com/quibbble/go-quibbble/internal/networking"
 	"github.com/quibbble/go-quibbble/pkg/logger"
 	"github.com/unrolled/render"
 )
 
+// healthCheckTimeout is the deadline for each component to respond to a health check
+const healthCheckTimeout = 2 * time.Second
+
 type Handler struct {
 	render    *render.Render
 	network   *networking.GameNetwork
 	gameStore datastore.GameStore
+	upgrader  websocket.Upgrader
+	sessions  *sessions
+	node      string // address of this node in the cluster which is added to session IDs
+	validator *requestValidator
+
+	ids         *gameIDs
+	idempotency idempotencyStore // nil unless responses to creates with an idempotency key are replayed
+	unready     atomic.Bool      // readiness fails once the server starts shutting down ahead of draining
 }
 
-func NewHandler(render *render.Render, network *networking.GameNetwork, gameStore datastore.GameStore) *Handler {
+func NewHandler(render *render.Render, network *networking.GameNetwork, gameStore datastore.GameStore, checkOrigin func(r *http.Request) bool, create CreateConfig, c *cluster.Cluster) (*Handler, error) {
+	validator, err := newRequestValidator(api.OpenAPI)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := newGameIDs(create, c)
+	if err != nil {
+		return nil, err
+	}
+	var node string
+	var idempotency idempotencyStore
+	if create.IdempotencyTTL > 0 {
+		idempotency = newMemoryIdempotency(create.IdempotencyTTL)
+	}
+	if c != nil {
+		node = c.Addr()
+		// retries may reach another node once the game's owner changes so responses are shared by every node
+		if client, keyPrefix := c.Redis(); create.IdempotencyTTL > 0 && client != nil {
+			idempotency = newRedisIdempotency(client, keyPrefix, create.IdempotencyTTL)
+		} else if create.IdempotencyTTL > 0 {
+			logger.Log.Warn().Msg("cluster redis is not configured so retries reaching another node are not replayed")
+		}
+	}
 	return &Handler{
 		render:    render,
 		network:   network,
 		gameStore: gameStore,
-	}
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:    1024,
+			WriteBufferSize:   1024,
+			CheckOrigin:       checkOrigin,
+			EnableCompression: true,
+		},
+		sessions:    newSessions(),
+		node:        node,
+		validator:   validator,
+		ids:         ids,
+		idempotency: idempotency,
+	}, nil
 }
 
 func (h *Handler) CreateGame(w http.ResponseWriter, r *http.Request) {
 	var create CreateGameRequest
-	if err := unmarshalJSONRequestBody(r, &create); err != nil {
-		writeJSONResponse(h.render, w, http.StatusBadRequest, errorResponse{Message: err.Error()})
+	if err := h.validator.decode(r, schemaCreateGameRequest, &create); err != nil {
+		h.writeError(w, err)
 		return
 	}
-	if create.Teams > len(teams) {
-		writeJSONResponse(h.render, w, http.StatusBadRequest, errorResponse{Message: "too many teams"})
-		return
-	}
-	t := make([]string, 0)
-	for i := 0; i < create.Teams; i++ {
-		t = append(t, teams[i])
-	}
-	if err := h.network.CreateGame(networking.CreateGameOptions{
-		NetworkOptions: create.NetworkingCreateGameOptions,
-		GameOptions: &bg.BoardGameOptions{
-			Teams:       t,
-			MoreOptions: create.MoreOptions,
-		},
-	}); err != nil {
+	if err := h.createGame(r.Context(), &create); err != nil {
 		writeJSONResponse(h.render, w, http.StatusBadRequest, errorResponse{Message: err.Error()})
 		return
 	}
-	w.WriteHeader(http.StatusCreated)
+	writeJSONResponse(h.render, w, http.StatusCreated, GameResponse{
+		GameKey: create.GameKey,
+		GameID:  create.GameID,
+	})
 }
 
 func (h *Handler) LoadGame(w http.ResponseWriter, r *http.Request) {
 	var load LoadGameRequest
-	if err := unmarshalJSONRequestBody(r, &load); err != nil {
+	if err := h.validator.decode(r, schemaLoadGameRequest, &load); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	if err := h.loadGame(r.Context(), &load); err != nil {
 		writeJSONResponse(h.render, w, http.StatusBadRequest, errorResponse{Message: err.Error()})
 		return
 	}
+	writeJSONResponse(h.render, w, http.StatusCreated, GameResponse{
+		GameKey: load.GameKey,
+		GameID:  load.GameID,
+	})
+}
+
+// createGame creates a game with the requested number of teams named from teams, generating its game ID if unset
+func (h *Handler) createGame(ctx context.Context, create *CreateGameRequest) error {
+	if create.Teams > len(teams) {
+		return errTooManyTeams
+	}
+	t := make([]string, 0)
+	for i := 0; i < create.Teams; i++ {
+		t = append(t, teams[i])
+	}
+	return h.ids.assign(create.NetworkingCreateGameOptions, func() error {
+		return h.network.CreateGame(ctx, networking.CreateGameOptions{
+			NetworkOptions: create.NetworkingCreateGameOptions,
+			GameOptions: &bg.BoardGameOptions{
+				Teams:       t,
+				MoreOptions: create.MoreOptions,
+			},
+		})
+	})
+}
+
+// loadGame creates a game from BGN renaming its teams to those in teams, generating its game ID if unset
+func (h *Handler) loadGame(ctx context.Context, load *LoadGameRequest) error {
 	game, err := bgn.Parse(load.BGN)
 	if err != nil {
-		writeJSONResponse(h.render, w, http.StatusBadRequest, errorResponse{Message: err.Error()})
-		return
+		return errInvalidBGN(err)
 	}
 	if game.Tags["Game"] != load.GameKey {
-		writeJSONResponse(h.render, w, http.StatusBadRequest, errorResponse{Message: "game key does not match bgn key"})
-		return
+		return errKeyMismatch
 	}
 	if len(strings.Split(game.Tags["Teams"], ", ")) > len(teams) {
-		writeJSONResponse(h.render, w, http.StatusBadRequest, errorResponse{Message: "too many teams"})
-		return
+		return errTooManyTeams
 	}
 	t := make([]string, 0)
 	for i := range strings.Split(game.Tags["Teams"], ", ") {
 		t = append(t, teams[i])
 	}
 	game.Tags["Teams"] = strings.Join(t, ", ")
-	if err := h.network.CreateGame(networking.CreateGameOptions{
-		NetworkOptions: load.NetworkingCreateGameOptions,
-		BGN:            game,
-	}); err != nil {
-		writeJSONResponse(h.render, w, http.StatusBadRequest, errorResponse{Message: err.Error()})
-		return
-	}
-	w.WriteHeader(http.StatusCreated)
+	return h.ids.assign(load.NetworkingCreateGameOptions, func() error {
+		return h.network.CreateGame(ctx, networking.CreateGameOptions{
+			NetworkOptions: load.NetworkingCreateGameOptions,
+			BGN:            game,
+		})
+	})
 }
 
 func (h *Handler) JoinGame(w http.ResponseWriter, r *http.Request) {
-	gameKey := r.URL.Query().Get("GameKey")
-	gameID := r.URL.Query().Get("GameID")
-	conn, err := upgrader.Upgrade(w, r, nil)
+	query := r.URL.Query()
+	h.joinGame(w, r, query.Get("GameKey"), query.Get("GameID"), query.Get("Protocol"), query.Get("Encoding"))
+}
+
+// joinGame upgrades the request to a websocket and joins the game as a newly named player
+func (h *Handler) joinGame(w http.ResponseWriter, r *http.Request, gameKey, gameID, protocol, encoding string) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		writeJSONResponse(h.render, w, http.StatusInternalServerError, errorResponse{Message: "failed to upgrade websocket connection"})
 		return
 	}
-	if err := h.network.JoinGame(networking.JoinGameOptions{
+	if err := h.network.JoinGame(r.Context(), networking.JoinGameOptions{
 		GameKey:    gameKey,
 		GameID:     gameID,
 		PlayerName: generateName(),
-		Conn:       conn,
+		Transport:  networking.NewWebsocketTransport(conn),
+		RemoteAddr: r.RemoteAddr,
+		Protocol:   protocol,
+		Encoding:   encoding,
 	}); err != nil {
-		_ = conn.Close()
+		closeWithError(conn, err)
 	}
 }
 
 func (h *Handler) JoinSecureGame(w http.ResponseWriter, r *http.Request) {
 	gameKey := r.URL.Query().Get("GameKey")
 	gameID := r.URL.Query().Get("GameID")
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		writeJSONResponse(h.render, w, http.StatusInternalServerError, errorResponse{Message: "failed to upgrade websocket connection"})
 		return
@@ -123,14 +198,17 @@ func (h *Handler) JoinSecureGame(w http.ResponseWriter, r *http.Request) {
 	*/
 	playerID := ""
 	playerName := "" // there should be some lookup to get a player name from player ID
-	if err := h.network.JoinGame(networking.JoinGameOptions{
+	if err := h.network.JoinGame(r.Context(), networking.JoinGameOptions{
 		GameKey:    gameKey,
 		GameID:     gameID,
 		PlayerID:   playerID,
 		PlayerName: playerName,
-		Conn:       conn,
+		Transport:  networking.NewWebsocketTransport(conn),
+		RemoteAddr: r.RemoteAddr,
+		Protocol:   r.URL.Query().Get("Protocol"),
+		Encoding:   r.URL.Query().Get("Encoding"),
 	}); err != nil {
-		_ = conn.Close()
+		closeWithError(conn, err)
 	}
 }
 
@@ -142,9 +220,9 @@ func (h *Handler) GetSnapshot(w http.ResponseWriter, r *http.Request) {
 	var snapshot interface{}
 	var err error
 	if team != "" {
-		snapshot, err = h.network.GetSnapshot(gameKey, gameID, team)
+		snapshot, err = h.network.GetSnapshot(r.Context(), gameKey, gameID, team)
 	} else {
-		snapshot, err = h.network.GetSnapshot(gameKey, gameID)
+		snapshot, err = h.network.GetSnapshot(r.Context(), gameKey, gameID)
 	}
 	if err != nil {
 		logger.Log.Error().Caller().Err(err).Msgf("failed to get game snapshot '%s' for '%s'", gameID, gameKey)
@@ -157,7 +235,7 @@ func (h *Handler) GetSnapshot(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GetBGN(w http.ResponseWriter, r *http.Request) {
 	gameKey := r.URL.Query().Get("GameKey")
 	gameID := r.URL.Query().Get("GameID")
-	game, err := h.network.GetBGN(gameKey, gameID)
+	game, err := h.network.GetBGN(r.Context(), gameKey, gameID)
 	if err != nil {
 		writeJSONResponse(h.render, w, http.StatusNotFound, errorResponse{Message: err.Error()})
 		return
@@ -166,19 +244,155 @@ func (h *Handler) GetBGN(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write([]byte(game.String()))
 }
 
+func (h *Handler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	gameKey := r.URL.Query().Get("GameKey")
+	gameID := r.URL.Query().Get("GameID")
+	if _, err := h.network.GetInfo(gameKey); err != nil {
+		writeJSONResponse(h.render, w, http.StatusBadRequest, errorResponse{Message: err.Error()})
+		return
+	}
+	if raw := r.URL.Query().Get("PlayIndex"); raw != "" {
+		playIndex, err := strconv.Atoi(raw)
+		if err != nil {
+			writeJSONResponse(h.render, w, http.StatusBadRequest, errorResponse{Message: "invalid play index"})
+			return
+		}
+		playthrough, err := h.gameStore.GetPlaythrough(r.Context(), gameKey, gameID, playIndex)
+		if err != nil {
+			writeJSONResponse(h.render, w, http.StatusNotFound, errorResponse{Message: err.Error()})
+			return
+		}
+		writeJSONResponse(h.render, w, http.StatusOK, newPlaythroughResponse(playthrough, true))
+		return
+	}
+	playthroughs, err := h.gameStore.GetPlaythroughs(r.Context(), gameKey, gameID)
+	if err != nil {
+		logger.Log.Error().Caller().Err(err).Msgf("failed to get history of game '%s' for '%s'", gameID, gameKey)
+		writeJSONResponse(h.render, w, http.StatusNotFound, errorResponse{Message: err.Error()})
+		return
+	}
+	response := HistoryResponse{
+		Playthroughs: make([]*PlaythroughResponse, 0),
+	}
+	for _, playthrough := range playthroughs {
+		response.Playthroughs = append(response.Playthroughs, newPlaythroughResponse(playthrough, false))
+	}
+	writeJSONResponse(h.render, w, http.StatusOK, response)
+}
+
+func (h *Handler) SearchGames(w http.ResponseWriter, r *http.Request) {
+	query, err := h.gameQuery(r.URL.Query(), func(name string) string { return name })
+	if err != nil {
+		writeJSONResponse(h.render, w, http.StatusBadRequest, errorResponse{Message: err.Error()})
+		return
+	}
+	response, err := h.searchGames(r.Context(), query)
+	if err == datastore.ErrGameStoreCursor {
+		writeJSONResponse(h.render, w, http.StatusBadRequest, errorResponse{Message: err.Error()})
+		return
+	} else if err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to search games")
+		writeJSONResponse(h.render, w, http.StatusInternalServerError, errorResponse{Message: err.Error()})
+		return
+	}
+	writeJSONResponse(h.render, w, http.StatusOK, response)
+}
+
+// gameQuery parses a search of stored games from query parameters named by param
+func (h *Handler) gameQuery(values url.Values, param func(string) string) (*datastore.GameQuery, error) {
+	query := &datastore.GameQuery{
+		GameKeys:     values[param("GameKey")],
+		Participants: values[param("Participant")],
+		Result:       values.Get(param("Result")),
+		Winner:       values.Get(param("Winner")),
+		Ascending:    values.Get(param("Order")) == "asc",
+		Cursor:       values.Get(param("Cursor")),
+	}
+	for _, gameKey := range query.GameKeys {
+		if _, err := h.network.GetInfo(gameKey); err != nil {
+			return nil, &validationError{message: err.Error()}
+		}
+	}
+	for field, target := range map[string]**time.Time{"UpdatedAfter": &query.UpdatedAfter, "UpdatedBefore": &query.UpdatedBefore} {
+		if raw := values.Get(param(field)); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return nil, &validationError{message: "invalid " + param(field)}
+			}
+			*target = &t
+		}
+	}
+	for field, target := range map[string]*int{"MinActions": &query.MinActions, "Limit": &query.Limit} {
+		if raw := values.Get(param(field)); raw != "" {
+			i, err := strconv.Atoi(raw)
+			if err != nil || i < 0 {
+				return nil, &validationError{message: "invalid " + param(field)}
+			}
+			*target = i
+		}
+	}
+	switch query.Result {
+	case datastore.ResultAny, datastore.ResultCompleted, datastore.ResultInProgress:
+	default:
+		return nil, &validationError{message: "invalid " + param("Result")}
+	}
+	return query, nil
+}
+
+func (h *Handler) searchGames(ctx context.Context, query *datastore.GameQuery) (*SearchResponse, error) {
+	page, err := h.gameStore.SearchGames(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	response := &SearchResponse{
+		Games:      make([]*StoredGameResponse, 0),
+		NextCursor: page.NextCursor,
+	}
+	for _, game := range page.Games {
+		response.Games = append(response.Games, &StoredGameResponse{
+			GameKey:      game.GameKey,
+			GameID:       game.GameID,
+			CreatedAt:    game.CreatedAt,
+			UpdatedAt:    game.UpdatedAt,
+			PlayCount:    game.PlayCount,
+			ActionCount:  game.ActionCount,
+			Winners:      game.Winners,
+			Participants: game.Participants,
+		})
+	}
+	return response, nil
+}
+
 func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
-	statsStored, err := h.gameStore.GetStats(h.network.GetGames())
+	stats, err := h.stats(r.Context())
+	if err != nil {
+		writeJSONResponse(h.render, w, http.StatusInternalServerError, errorResponse{Message: err.Error()})
+		return
+	}
+	writeJSONResponse(h.render, w, http.StatusOK, stats)
+}
+
+// stats combines stats of stored games with those of running games, stored stats are empty if they cannot be retrieved
+func (h *Handler) stats(ctx context.Context) (*StatsResponse, error) {
+	statsStored, err := h.gameStore.GetStats(ctx, h.network.GetGames())
 	if err != nil {
 		logger.Log.Error().Caller().Err(err).Msg("failed to retrieve game stats")
 		statsStored = &datastore.Stats{}
 	}
-	statsCurrent := h.network.GetStats()
-	writeJSONResponse(h.render, w, http.StatusOK, StatsResponse{
+	statsCurrent, err := h.network.GetStats(ctx)
+	if err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to retrieve network stats")
+		return nil, err
+	}
+	return &StatsResponse{
 		GamesCreated:  statsStored.GamesCreated,
 		GamesPlayed:   statsStored.GamesPlayed,
 		ActiveGames:   statsCurrent.ActiveGames,
 		ActivePlayers: statsCurrent.ActivePlayers,
-	})
+		StoredBytes:   statsStored.StoredBytes,
+		RawBytes:      statsStored.RawBytes,
+		GameStorePool: h.gameStore.PoolStats(),
+	}, nil
 }
 
 func (h *Handler) GetInfo(w http.ResponseWriter, r *http.Request) {
@@ -186,28 +400,91 @@ func (h *Handler) GetInfo(w http.ResponseWriter, r *http.Request) {
 	info, err := h.network.GetInfo(gameKey)
 	if err != nil {
 		writeJSONResponse(h.render, w, http.StatusBadRequest, errorResponse{Message: err.Error()})
+		return
 	}
 	writeJSONResponse(h.render, w, http.StatusOK, info)
 }
 
 func (h *Handler) GetActiveGameIDs(w http.ResponseWriter, r *http.Request) {
-	activeGameIDs := h.network.GetActiveGameIDs()
+	activeGameIDs, err := h.network.GetActiveGameIDs(r.Context())
+	if err != nil {
+		writeJSONResponse(h.render, w, http.StatusInternalServerError, errorResponse{Message: err.Error()})
+		return
+	}
 	writeJSONResponse(h.render, w, http.StatusOK, activeGameIDs)
 }
 
+// OpenAPI serves the OpenAPI specification of the REST API
+func (h *Handler) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(api.OpenAPI)
+}
+
+// Health is a cheap readiness check that fails once the server starts shutting down
 func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
+	if h.shuttingDown() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(http.StatusText(http.StatusServiceUnavailable)))
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write([]byte(http.StatusText(http.StatusOK)))
 }
 
+// Live reports whether the process is working which fails if any game hub loop stops responding
+func (h *Handler) Live(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+	components := h.checkHubs(ctx)
+	writeHealthResponse(h.render, w, components)
+}
+
+// Ready reports whether the server should receive traffic which fails when draining or if the game store is unreachable
+func (h *Handler) Ready(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+	components := h.checkHubs(ctx)
+	components["drain"] = &ComponentHealth{Status: healthOK}
+	if h.shuttingDown() {
+		components["drain"] = &ComponentHealth{Status: healthUnavailable, Error: "draining"}
+	}
+	start := time.Now()
+	err := h.gameStore.Ping(ctx)
+	components["datastore"] = newComponentHealth(err, time.Since(start))
+	if err == datastore.ErrGameStoreNotEnabled {
+		components["datastore"] = &ComponentHealth{Status: healthDisabled}
+	}
+	writeHealthResponse(h.render, w, components)
+}
+
+func (h *Handler) shuttingDown() bool {
+	return h.unready.Load() || h.network.Draining()
+}
+
+func (h *Handler) checkHubs(ctx context.Context) map[string]*ComponentHealth {
+	components := make(map[string]*ComponentHealth)
+	for gameKey, check := range h.network.CheckHubs(ctx) {
+		components["hub:"+gameKey] = newComponentHealth(check.Err, check.Latency)
+	}
+	return components
+}
+
 type errorResponse struct {
+	// Code identifies the kind of error
+	Code    string `json:",omitempty"`
 	Message string
+
+	// Fields lists why each field is invalid when a request body does not match its schema
+	Fields []*FieldError `json:",omitempty"`
 }
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+func newErrorResponse(err error) errorResponse {
+	_, code := errorStatus(err)
+	response := errorResponse{Code: code, Message: err.Error()}
+	var verr *validationError
+	if errors.As(err, &verr) {
+		response.Fields = verr.fields
+	}
+	return response
 }
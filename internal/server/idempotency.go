@@ -0,0 +1,288 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/quibbble/go-quibbble/pkg/logger"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// idempotencyKeyHeader is set by clients so retrying a request returns the response to the first attempt
+	idempotencyKeyHeader = "Idempotency-Key"
+
+	// idempotentReplayedHeader marks responses replayed for a repeated idempotency key
+	idempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+
+	// idempotencyClaimTTL bounds how long a key stays claimed by a request that never finishes such as one on a node that stopped
+	idempotencyClaimTTL = time.Minute
+
+	// idempotencyPollInterval is how often a request repeated while the first is in flight on another node checks if it finished
+	idempotencyPollInterval = 100 * time.Millisecond
+)
+
+// idempotentResponse is the response to the first request sent with an idempotency key
+type idempotentResponse struct {
+	Fingerprint [sha256.Size]byte
+	Recorded    bool // false while the first request is in flight
+	Status      int
+	Header      http.Header
+	Body        []byte
+}
+
+// idempotencyStore remembers responses by idempotency key
+type idempotencyStore interface {
+	// claim returns the response recorded for the key or nil if the caller claimed the key and must finish it
+	// it waits while another request holds the key and fails with errIdempotencyKeyReused if the key was sent with a different body
+	claim(ctx context.Context, key string, fingerprint [sha256.Size]byte) (*idempotentResponse, error)
+
+	// finish records the response replayed for later requests with the key, or releases the key if response is nil so they are retried
+	finish(ctx context.Context, key string, response *idempotentResponse) error
+}
+
+// idempotencyEntry is a claimed key of the memory idempotency store
+type idempotencyEntry struct {
+	response  *idempotentResponse
+	done      chan struct{} // closed once the request that claimed the key has finished
+	expiresAt time.Time
+}
+
+// memoryIdempotency remembers responses for the ttl on this node only
+type memoryIdempotency struct {
+	ttl       time.Duration
+	mu        sync.Mutex
+	entries   map[string]*idempotencyEntry
+	nextSweep time.Time
+}
+
+func newMemoryIdempotency(ttl time.Duration) *memoryIdempotency {
+	return &memoryIdempotency{
+		ttl:     ttl,
+		entries: make(map[string]*idempotencyEntry),
+	}
+}
+
+func (i *memoryIdempotency) claim(ctx context.Context, key string, fingerprint [sha256.Size]byte) (*idempotentResponse, error) {
+	for {
+		i.mu.Lock()
+		now := time.Now()
+		if now.After(i.nextSweep) {
+			for k, entry := range i.entries {
+				if entry.response.Recorded && now.After(entry.expiresAt) {
+					delete(i.entries, k)
+				}
+			}
+			i.nextSweep = now.Add(time.Minute)
+		}
+		entry, ok := i.entries[key]
+		if !ok || (entry.response.Recorded && now.After(entry.expiresAt)) {
+			i.entries[key] = &idempotencyEntry{
+				response: &idempotentResponse{Fingerprint: fingerprint},
+				done:     make(chan struct{}),
+			}
+			i.mu.Unlock()
+			return nil, nil
+		}
+		response, done := entry.response, entry.done
+		i.mu.Unlock()
+		if response.Fingerprint != fingerprint {
+			return nil, errIdempotencyKeyReused
+		}
+		if response.Recorded {
+			return response, nil
+		}
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (i *memoryIdempotency) finish(_ context.Context, key string, response *idempotentResponse) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	entry, ok := i.entries[key]
+	if !ok {
+		return nil
+	}
+	if response != nil {
+		response.Recorded = true
+		entry.response = response
+		entry.expiresAt = time.Now().Add(i.ttl)
+	} else {
+		delete(i.entries, key)
+	}
+	close(entry.done)
+	return nil
+}
+
+// redisIdempotency remembers responses for the ttl in redis shared by every node in the cluster
+// so a retry is replayed even when it reaches another node after the game's owner changed
+type redisIdempotency struct {
+	ttl    time.Duration
+	client *redis.Client
+	prefix string
+}
+
+func newRedisIdempotency(client *redis.Client, keyPrefix string, ttl time.Duration) *redisIdempotency {
+	return &redisIdempotency{
+		ttl:    ttl,
+		client: client,
+		prefix: keyPrefix + "idempotency:",
+	}
+}
+
+// key hashes the idempotency key as it holds the client's identity
+func (i *redisIdempotency) key(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return i.prefix + hex.EncodeToString(sum[:])
+}
+
+func (i *redisIdempotency) claim(ctx context.Context, key string, fingerprint [sha256.Size]byte) (*idempotentResponse, error) {
+	pending, err := json.Marshal(&idempotentResponse{Fingerprint: fingerprint})
+	if err != nil {
+		return nil, err
+	}
+	ticker := time.NewTicker(idempotencyPollInterval)
+	defer ticker.Stop()
+	for {
+		claimed, err := i.client.SetNX(ctx, i.key(key), pending, idempotencyClaimTTL).Result()
+		if err != nil {
+			return nil, err
+		}
+		if claimed {
+			return nil, nil
+		}
+		raw, err := i.client.Get(ctx, i.key(key)).Bytes()
+		if err == redis.Nil {
+			// the first request released the key in between
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		var response idempotentResponse
+		if err := json.Unmarshal(raw, &response); err != nil {
+			return nil, err
+		}
+		if response.Fingerprint != fingerprint {
+			return nil, errIdempotencyKeyReused
+		}
+		if response.Recorded {
+			return &response, nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (i *redisIdempotency) finish(ctx context.Context, key string, response *idempotentResponse) error {
+	if response == nil {
+		return i.client.Del(ctx, i.key(key)).Err()
+	}
+	response.Recorded = true
+	raw, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	return i.client.Set(ctx, i.key(key), raw, i.ttl).Err()
+}
+
+// idempotencyClient identifies who sent the request by their credentials or else their ip
+// so one client cannot be replayed the response to another that happened to send the same key
+func idempotencyClient(r *http.Request) string {
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		sum := sha256.Sum256([]byte(authorization))
+		return "auth:" + hex.EncodeToString(sum[:])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		// RealIP leaves only the ip
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// Idempotent replays the response to the first request sent by the same client with the same Idempotency-Key header
+// Requests repeated while the first is in flight wait for it and a key reused with a different body is rejected
+func (h *Handler) Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idempotencyKey := r.Header.Get(idempotencyKeyHeader)
+		if idempotencyKey == "" || h.idempotency == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(idempotencyKey) > maxIdempotencyKeyLength {
+			h.writeError(w, errInvalidIdempotencyKey)
+			return
+		}
+		var body []byte
+		if r.Body != nil {
+			var err error
+			if body, err = readBody(r); err != nil {
+				h.writeError(w, err)
+				return
+			}
+		}
+		key := idempotencyClient(r) + " " + r.Method + " " + r.URL.Path + " " + idempotencyKey
+		response, err := h.idempotency.claim(r.Context(), key, sha256.Sum256(body))
+		if r.Context().Err() != nil {
+			return
+		} else if err != nil {
+			if err != errIdempotencyKeyReused {
+				logger.Log.Error().Caller().Err(err).Msg("failed to claim idempotency key")
+			}
+			h.writeError(w, err)
+			return
+		}
+		if response != nil {
+			for name, values := range response.Header {
+				w.Header()[name] = values
+			}
+			w.Header().Set(idempotentReplayedHeader, "true")
+			w.WriteHeader(response.Status)
+			_, _ = w.Write(response.Body)
+			return
+		}
+		var recorded *idempotentResponse
+		defer func() {
+			// the key is released even if the request was cancelled so retries are not stuck waiting on it
+			if err := h.idempotency.finish(context.WithoutCancel(r.Context()), key, recorded); err != nil {
+				logger.Log.Error().Caller().Err(err).Msg("failed to finish idempotency key")
+			}
+		}()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		var buf bytes.Buffer
+		ww.Tee(&buf)
+		next.ServeHTTP(ww, r)
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		// server errors and rate limits are retried rather than replayed
+		if r.Context().Err() == nil && status < http.StatusInternalServerError && status != http.StatusTooManyRequests {
+			recorded = &idempotentResponse{
+				Fingerprint: sha256.Sum256(body),
+				Status:      status,
+				Header:      w.Header().Clone(),
+				Body:        buf.Bytes(),
+			}
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestIdempotencyStores(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	for name, store := range map[string]idempotencyStore{
+		"memory": newMemoryIdempotency(time.Minute),
+		"redis":  newRedisIdempotency(client, "test:", time.Minute),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			fingerprint := sha256.Sum256([]byte("body"))
+			if response, err := store.claim(ctx, "key", fingerprint); err != nil || response != nil {
+				t.Fatalf("got %v and %v claiming a new key, want it claimed", response, err)
+			}
+			if _, err := store.claim(ctx, "key", sha256.Sum256([]byte("other"))); err != errIdempotencyKeyReused {
+				t.Errorf("got %v claiming the key with a different body, want %v", err, errIdempotencyKeyReused)
+			}
+
+			// a repeated request waits for the first to finish and is then replayed its response
+			replayed := make(chan *idempotentResponse)
+			go func() {
+				response, _ := store.claim(ctx, "key", fingerprint)
+				replayed <- response
+			}()
+			time.Sleep(2 * idempotencyPollInterval)
+			if err := store.finish(ctx, "key", &idempotentResponse{Fingerprint: fingerprint, Status: http.StatusCreated, Body: []byte("created")}); err != nil {
+				t.Fatalf("failed to finish key: %s", err)
+			}
+			select {
+			case response := <-replayed:
+				if response == nil || response.Status != http.StatusCreated || string(response.Body) != "created" {
+					t.Errorf("got %+v, want the recorded response", response)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("the repeated request was not replayed once the first finished")
+			}
+
+			// a released key is claimed again by the next request
+			if _, err := store.claim(ctx, "released", fingerprint); err != nil {
+				t.Fatalf("failed to claim key: %s", err)
+			}
+			if err := store.finish(ctx, "released", nil); err != nil {
+				t.Fatalf("failed to release key: %s", err)
+			}
+			if response, err := store.claim(ctx, "released", fingerprint); err != nil || response != nil {
+				t.Errorf("got %v and %v claiming a released key, want it claimed", response, err)
+			}
+		})
+	}
+}
+
+func TestIdempotentByClient(t *testing.T) {
+	h := &Handler{idempotency: newMemoryIdempotency(time.Minute)}
+	var served atomic.Int64
+	handler := h.Idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served.Add(1)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	send := func(remoteAddr, authorization string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/v1/games", strings.NewReader(`{"GameKey":"Tic-Tac-Toe"}`))
+		r.RemoteAddr = remoteAddr
+		r.Header.Set(idempotencyKeyHeader, "key")
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	send("10.0.0.1:1234", "")
+	if w := send("10.0.0.1:4321", ""); w.Header().Get(idempotentReplayedHeader) != "true" {
+		t.Errorf("got a new response for a retry from the same client, want it replayed")
+	}
+	for _, client := range []struct{ remoteAddr, authorization string }{
+		{"10.0.0.2:1234", ""},
+		{"10.0.0.1:1234", "Bearer token"},
+	} {
+		if w := send(client.remoteAddr, client.authorization); w.Header().Get(idempotentReplayedHeader) != "" {
+			t.Errorf("got a replayed response for %+v, want clients to not share keys", client)
+		}
+	}
+	if served.Load() != 3 {
+		t.Errorf("got %d requests served, want 3", served.Load())
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+
+	"github.com/quibbble/go-quibbble/internal/cluster"
+	networking "github.com/quibbble/go-quibbble/internal/networking"
+)
+
+const (
+	// defaultIDAlphabet leaves out characters easily mistaken for one another such as 0, o, 1, l and i
+	defaultIDAlphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+	defaultIDLength   = 6
+
+	// maxIDCollisions is the number of generated game IDs tried before giving up when each is already taken
+	maxIDCollisions = 5
+
+	// maxIDOwnerAttempts bounds how many game IDs are generated looking for one owned by this node
+	maxIDOwnerAttempts = 1000
+)
+
+// gameIDs generates short human friendly game IDs for games created without one
+type gameIDs struct {
+	alphabet []rune
+	length   int
+	cluster  *cluster.Cluster // nil unless clustering is enabled
+}
+
+func newGameIDs(cfg CreateConfig, c *cluster.Cluster) (*gameIDs, error) {
+	alphabet, length := cfg.IDAlphabet, cfg.IDLength
+	if alphabet == "" {
+		alphabet = defaultIDAlphabet
+	}
+	if length == 0 {
+		length = defaultIDLength
+	}
+	unique := make(map[rune]bool)
+	for _, r := range alphabet {
+		if unique[r] {
+			return nil, errDuplicateIDCharacter(r)
+		}
+		unique[r] = true
+	}
+	if len(unique) < 2 {
+		return nil, errShortIDAlphabet
+	}
+	if length < 0 {
+		return nil, errInvalidIDLength(length)
+	}
+	return &gameIDs{
+		alphabet: []rune(alphabet),
+		length:   length,
+		cluster:  c,
+	}, nil
+}
+
+// generate returns a random game ID that, when clustering is enabled, is owned by this node
+// as requests without a game ID are not forwarded to the node owning the game
+func (g *gameIDs) generate(gameKey string) (string, error) {
+	for i := 0; i < maxIDOwnerAttempts; i++ {
+		id := make([]rune, g.length)
+		for j := range id {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(g.alphabet))))
+			if err != nil {
+				return "", err
+			}
+			id[j] = g.alphabet[n.Int64()]
+		}
+		if g.cluster == nil || g.cluster.IsOwner(gameKey, string(id)) {
+			return string(id), nil
+		}
+	}
+	return "", errNoGameID
+}
+
+// assign calls create with the requested game ID or, if none was requested, with generated game IDs until one is free
+// create sees the game ID through options which is left set to the ID of the created game
+func (g *gameIDs) assign(options *networking.NetworkingCreateGameOptions, create func() error) error {
+	if options.GameID != "" {
+		return create()
+	}
+	// a generated game ID must never load or replace someone else's game
+	options.OnConflict = networking.OnConflictError
+	for i := 0; i < maxIDCollisions; i++ {
+		gameID, err := g.generate(options.GameKey)
+		if err != nil {
+			return err
+		}
+		options.GameID = gameID
+		if err := create(); !errors.Is(err, &networking.Error{Code: networking.CodeGameExists}) {
+			return err
+		}
+	}
+	options.GameID = ""
+	return errNoGameID
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	networking "github.com/quibbble/go-quibbble/internal/networking"
+	"github.com/quibbble/go-quibbble/pkg/logger"
+)
+
+const (
+	// defaultPollWait is how long a poll waits for messages when the client does not say
+	defaultPollWait = 25 * time.Second
+
+	// maxPollWait bounds how long a poll may wait so polls finish before proxies close idle requests
+	maxPollWait = 55 * time.Second
+
+	// sessionLinger is how long a closed session is kept so the player can poll the messages sent before it closed
+	sessionLinger = time.Minute
+)
+
+// V1JoinGameSession joins a game for clients that can neither use websockets nor event streams
+// messages are polled from V1PollGameSession and actions are sent to V1PostGameAction with the returned session ID
+func (h *Handler) V1JoinGameSession(w http.ResponseWriter, r *http.Request) {
+	gameKey, gameID := gameParams(r)
+	sessionID, err := newSessionID(h.node)
+	if err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to generate session id")
+		h.writeError(w, err)
+		return
+	}
+	transport := networking.NewLongPollTransport()
+	// the player stays joined after this request so it must not be cancelled with it
+	if err := h.network.JoinGame(context.WithoutCancel(r.Context()), networking.JoinGameOptions{
+		GameKey:    gameKey,
+		GameID:     gameID,
+		PlayerName: generateName(),
+		Transport:  transport,
+		RemoteAddr: r.RemoteAddr,
+		Protocol:   r.URL.Query().Get("protocol"),
+	}); err != nil {
+		_ = transport.Close()
+		h.writeError(w, err)
+		return
+	}
+	h.sessions.add(sessionID, transport)
+	go func() {
+		<-transport.Done()
+		time.AfterFunc(sessionLinger, func() { h.sessions.remove(sessionID) })
+	}()
+	w.Header().Set("Location", gamePath(gameKey, gameID)+"/sessions/"+sessionID+"/messages")
+	writeJSONResponse(h.render, w, http.StatusCreated, SessionResponse{SessionID: sessionID})
+}
+
+// V1PollGameSession waits for messages sent to a player joined through V1JoinGameSession responding with all those waiting
+// the response is an empty list if none are sent within the wait and gone once the player has left the game
+func (h *Handler) V1PollGameSession(w http.ResponseWriter, r *http.Request) {
+	sessionID := chi.URLParam(r, "session")
+	session, ok := h.sessions.get(sessionID)
+	transport, isLongPoll := session.(*networking.LongPollTransport)
+	if !ok || !isLongPoll {
+		h.writeError(w, errSessionNotFound)
+		return
+	}
+	wait := defaultPollWait
+	if raw := r.URL.Query().Get("wait"); raw != "" {
+		var err error
+		if wait, err = time.ParseDuration(raw); err != nil || wait < 0 {
+			h.writeError(w, &validationError{message: "invalid wait"})
+			return
+		}
+		wait = min(wait, maxPollWait)
+	}
+	messages, err := transport.Poll(r.Context(), wait)
+	if err != nil {
+		h.sessions.remove(sessionID)
+		h.writeError(w, err)
+		return
+	}
+	response := make([]json.RawMessage, 0, len(messages))
+	for _, message := range messages {
+		response = append(response, message)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSONResponse(h.render, w, http.StatusOK, response)
+}
@@ -3,6 +3,8 @@ package server
 import (
 	"time"
 
+	"github.com/quibbble/go-quibbble/internal/datastore"
+
 	networking "github.com/quibbble/go-quibbble/internal/networking"
 )
 
@@ -13,6 +15,10 @@ var teams = []string{
 type NetworkOptions struct {
 	Games      []string
 	GameExpiry time.Duration
+	Limits     networking.LimitOptions
+
+	Connection      networking.ConnectionOptions
+	GameConnections map[string]networking.ConnectionOptions
 }
 
 type CreateGameRequest struct {
@@ -26,9 +32,126 @@ type LoadGameRequest struct {
 	BGN string
 }
 
+// GameRequest creates a game from BGN if set or else from the number of teams and game options
+type GameRequest struct {
+	*networking.NetworkingCreateGameOptions
+	Teams       int
+	MoreOptions interface{}
+	BGN         string
+}
+
+type GameResponse struct {
+	GameKey string
+	GameID  string
+}
+
+type SessionResponse struct {
+	SessionID string
+}
+
 type StatsResponse struct {
 	GamesCreated  map[string]int
 	GamesPlayed   map[string]int
 	ActiveGames   map[string]int
 	ActivePlayers map[string]int
+	StoredBytes   map[string]int
+	RawBytes      map[string]int
+	GameStorePool *datastore.PoolStats
+}
+
+type PlaythroughResponse struct {
+	GameKey      string
+	GameID       string
+	PlayIndex    int
+	BGN          string `json:",omitempty"`
+	Winners      []string
+	Participants map[string]string
+	CompletedAt  time.Time
+}
+
+type HistoryResponse struct {
+	Playthroughs []*PlaythroughResponse
+}
+
+func newPlaythroughResponse(playthrough *datastore.Playthrough, withBGN bool) *PlaythroughResponse {
+	response := &PlaythroughResponse{
+		GameKey:      playthrough.GameKey,
+		GameID:       playthrough.GameID,
+		PlayIndex:    playthrough.PlayIndex,
+		Winners:      playthrough.Winners,
+		Participants: playthrough.Participants,
+		CompletedAt:  playthrough.CompletedAt,
+	}
+	if withBGN {
+		response.BGN = playthrough.BGN.String()
+	}
+	return response
+}
+
+type StoredGameResponse struct {
+	GameKey      string
+	GameID       string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	PlayCount    int
+	ActionCount  int
+	Winners      []string
+	Participants map[string]string
+}
+
+type SearchResponse struct {
+	Games      []*StoredGameResponse
+	NextCursor string `json:",omitempty"`
+}
+
+type AdminGamesResponse struct {
+	Games []*networking.GameSummary
+}
+
+type AdminGameRequest struct {
+	GameKey string
+	GameID  string
+}
+
+type AdminKickRequest struct {
+	GameKey    string
+	GameID     string
+	PlayerName string
+}
+
+type AdminBroadcastRequest struct {
+	// GameKey and GameID select the games to message where empty selects all
+	GameKey string
+	GameID  string
+	Message string
+}
+
+type AdminMaintenanceRequest struct {
+	// GameKey selects the hub to toggle where empty selects all
+	GameKey string
+	Enabled bool
+}
+
+const (
+	healthOK          = "ok"
+	healthUnavailable = "unavailable"
+	healthDisabled    = "disabled"
+)
+
+type HealthResponse struct {
+	Status     string
+	Components map[string]*ComponentHealth
+}
+
+type ComponentHealth struct {
+	Status  string
+	Latency string `json:",omitempty"`
+	Error   string `json:",omitempty"`
+}
+
+func newComponentHealth(err error, latency time.Duration) *ComponentHealth {
+	if err != nil {
+		return &ComponentHealth{Status: healthUnavailable, Latency: latency.String(), Error: err.Error()}
+	}
+	return &ComponentHealth{Status: healthOK, Latency: latency.String()}
 }
@@ -1,25 +1,43 @@
 package server
 
 import (
+	nethttp "net/http"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/cors"
 	"github.com/go-chi/httprate"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/quibbble/go-quibbble/internal/cluster"
 	"github.com/quibbble/go-quibbble/pkg/http"
 	"github.com/quibbble/go-quibbble/pkg/logger"
 	pkgMiddleware "github.com/quibbble/go-quibbble/pkg/middleware"
 	"github.com/urfave/negroni"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
+// defaultMaxBodySize is the max number of bytes read from a request body when not configured
+const defaultMaxBodySize = 1 << 20
+
 func NewRouter(cfg http.RouterConfig) *chi.Mux {
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
+	r.Use(otelhttp.NewMiddleware("http",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *nethttp.Request) string {
+			return r.Method + " " + r.URL.Path
+		}),
+		otelhttp.WithFilter(func(r *nethttp.Request) bool {
+			return !strings.HasPrefix(r.URL.Path, "/health") && r.URL.Path != "/metrics"
+		}),
+	))
 	r.Use(pkgMiddleware.RequestLogger(logger.Log))
-	r.Use(middleware.Timeout(time.Duration(cfg.TimeoutSec) * time.Second))
-	r.Use(httprate.LimitAll(cfg.RequestPerSecLimit, time.Second))
+	r.Use(timeout(time.Duration(cfg.TimeoutSec) * time.Second))
+	// RealIP has already replaced the remote address with the client's ip so each client gets their own limit
+	r.Use(httprate.LimitByIP(cfg.RequestPerSecLimit, time.Second))
+	r.Use(limitBody(cfg.MaxBodySize))
 	if !cfg.DisableCors {
 		r.Use(cors.Handler(cors.Options{
 			AllowedOrigins:   cfg.AllowedOrigins,
@@ -31,21 +49,123 @@ func NewRouter(cfg http.RouterConfig) *chi.Mux {
 	return r
 }
 
-func AddRoutes(r *chi.Mux, networkHandler *Handler) *chi.Mux {
+func AddRoutes(r *chi.Mux, networkHandler *Handler, adminCfg AdminConfig, c *cluster.Cluster) *chi.Mux {
+	affinity := func(h nethttp.Handler) nethttp.Handler { return h }
+	if c != nil {
+		affinity = gameAffinity(c)
+	}
+	r.Route("/v1", func(r chi.Router) {
+		r.Get("/games", negroni.New(negroni.WrapFunc(networkHandler.V1GetActiveGameIDs)).ServeHTTP)
+		r.With(affinity, networkHandler.Idempotent).Post("/games", negroni.New(negroni.WrapFunc(networkHandler.V1CreateGame)).ServeHTTP)
+		r.Get("/games/{key}", negroni.New(negroni.WrapFunc(networkHandler.V1GetInfo)).ServeHTTP)
+		r.Route("/games/{key}/{id}", func(r chi.Router) {
+			r.Use(affinity)
+			r.Get("/", negroni.New(negroni.WrapFunc(networkHandler.V1GetGame)).ServeHTTP)
+			r.Get("/bgn", negroni.New(negroni.WrapFunc(networkHandler.V1GetBGN)).ServeHTTP)
+			r.Get("/snapshot", negroni.New(negroni.WrapFunc(networkHandler.V1GetSnapshot)).ServeHTTP)
+			r.Get("/history", negroni.New(negroni.WrapFunc(networkHandler.V1GetHistory)).ServeHTTP)
+			r.Get("/join", negroni.New(negroni.WrapFunc(networkHandler.V1JoinGame)).ServeHTTP)
+			r.Get("/events", negroni.New(negroni.WrapFunc(networkHandler.V1JoinGameEvents)).ServeHTTP)
+			r.Post("/sessions", negroni.New(negroni.WrapFunc(networkHandler.V1JoinGameSession)).ServeHTTP)
+			r.Get("/sessions/{session}/messages", negroni.New(negroni.WrapFunc(networkHandler.V1PollGameSession)).ServeHTTP)
+			r.Post("/sessions/{session}/actions", negroni.New(negroni.WrapFunc(networkHandler.V1PostGameAction)).ServeHTTP)
+		})
+		r.Get("/stats", negroni.New(negroni.WrapFunc(networkHandler.V1GetStats)).ServeHTTP)
+		r.Get("/search", negroni.New(negroni.WrapFunc(networkHandler.V1SearchGames)).ServeHTTP)
+	})
 	r.Route("/game", func(r chi.Router) {
-		r.Post("/create", negroni.New(negroni.WrapFunc(networkHandler.CreateGame)).ServeHTTP)
-		r.Post("/load", negroni.New(negroni.WrapFunc(networkHandler.LoadGame)).ServeHTTP)
+		r.Use(deprecated)
+		if c != nil {
+			r.Use(gameAffinity(c))
+		}
+		r.With(networkHandler.Idempotent).Post("/create", negroni.New(negroni.WrapFunc(networkHandler.CreateGame)).ServeHTTP)
+		r.With(networkHandler.Idempotent).Post("/load", negroni.New(negroni.WrapFunc(networkHandler.LoadGame)).ServeHTTP)
 		r.Get("/join", negroni.New(negroni.WrapFunc(networkHandler.JoinGame)).ServeHTTP)
+		r.Get("/events", negroni.New(negroni.WrapFunc(networkHandler.JoinGameEvents)).ServeHTTP)
+		r.Post("/action", negroni.New(negroni.WrapFunc(networkHandler.PostGameAction)).ServeHTTP)
 		r.Get("/bgn", negroni.New(negroni.WrapFunc(networkHandler.GetBGN)).ServeHTTP)
+		r.Get("/history", negroni.New(negroni.WrapFunc(networkHandler.GetHistory)).ServeHTTP)
 		r.Get("/snapshot", negroni.New(negroni.WrapFunc(networkHandler.GetSnapshot)).ServeHTTP)
 		r.Get("/stats", negroni.New(negroni.WrapFunc(networkHandler.GetStats)).ServeHTTP)
 		r.Get("/info", negroni.New(negroni.WrapFunc(networkHandler.GetInfo)).ServeHTTP)
 		r.Get("/games", negroni.New(negroni.WrapFunc(networkHandler.GetActiveGameIDs)).ServeHTTP)
 	})
+	r.Route("/games", func(r chi.Router) {
+		r.Use(deprecated)
+		r.Get("/search", negroni.New(negroni.WrapFunc(networkHandler.SearchGames)).ServeHTTP)
+	})
+	if adminCfg.Token != "" {
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(pkgMiddleware.BearerAuth(adminCfg.Token))
+			r.Get("/games", negroni.New(negroni.WrapFunc(networkHandler.AdminListGames)).ServeHTTP)
+			r.Post("/game/close", negroni.New(negroni.WrapFunc(networkHandler.AdminCloseGame)).ServeHTTP)
+			r.Post("/game/store", negroni.New(negroni.WrapFunc(networkHandler.AdminStoreGame)).ServeHTTP)
+			r.Post("/game/kick", negroni.New(negroni.WrapFunc(networkHandler.AdminKickPlayer)).ServeHTTP)
+			r.Post("/broadcast", negroni.New(negroni.WrapFunc(networkHandler.AdminBroadcast)).ServeHTTP)
+			r.Post("/maintenance", negroni.New(negroni.WrapFunc(networkHandler.AdminMaintenance)).ServeHTTP)
+		})
+	}
+	if c != nil {
+		r.Get(cluster.NodePath, c.ServeNode)
+	}
+	r.Get("/openapi.json", negroni.New(negroni.WrapFunc(networkHandler.OpenAPI)).ServeHTTP)
 	r.Get("/health", negroni.New(negroni.WrapFunc(networkHandler.Health)).ServeHTTP)
+	r.Get("/health/live", negroni.New(negroni.WrapFunc(networkHandler.Live)).ServeHTTP)
+	r.Get("/health/ready", negroni.New(negroni.WrapFunc(networkHandler.Ready)).ServeHTTP)
+
+	// add prometheus metrics
+	r.Handle("/metrics", promhttp.Handler())
 
 	// add pprof
 	r.Mount("/debug", middleware.Profiler())
 
 	return r
 }
+
+// timeout cancels requests that take longer than the duration except for event streams which stay open while a game is played
+// and polls which wait for messages up to their own wait
+func timeout(d time.Duration) func(h nethttp.Handler) nethttp.Handler {
+	return func(h nethttp.Handler) nethttp.Handler {
+		withTimeout := middleware.Timeout(d)(h)
+		return nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			if isEventStream(r.URL.Path) || isPoll(r) {
+				h.ServeHTTP(w, r)
+				return
+			}
+			withTimeout.ServeHTTP(w, r)
+		})
+	}
+}
+
+// limitBody stops reading request bodies past the max size so no handler reads an unbounded body into memory
+// reads past the limit fail with an error that handlers respond to with 413
+func limitBody(max int64) func(h nethttp.Handler) nethttp.Handler {
+	if max <= 0 {
+		max = defaultMaxBodySize
+	}
+	return func(h nethttp.Handler) nethttp.Handler {
+		return nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			if r.Body != nil {
+				r.Body = nethttp.MaxBytesReader(w, r.Body, max)
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+func isEventStream(path string) bool {
+	return path == "/game/events" || (strings.HasPrefix(path, "/v1/games/") && strings.HasSuffix(path, "/events"))
+}
+
+func isPoll(r *nethttp.Request) bool {
+	return r.Method == nethttp.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/games/") && strings.HasSuffix(r.URL.Path, "/messages")
+}
+
+// deprecated marks responses from routes replaced by /v1 linking to the specification describing their replacements
+func deprecated(h nethttp.Handler) nethttp.Handler {
+	return nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", `</openapi.json>; rel="deprecation"; type="application/json"`)
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/unrolled/render"
+)
+
+func TestLimitBody(t *testing.T) {
+	h := &Handler{render: render.New(), idempotency: newMemoryIdempotency(time.Minute)}
+	handler := limitBody(32)(h.Idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req AdminGameRequest
+		if err := unmarshalJSONRequestBody(r, &req); err != nil {
+			h.writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})))
+	for _, test := range []struct {
+		name           string
+		body           string
+		idempotencyKey string
+		status         int
+	}{
+		{"small body", `{"GameKey":"Tic-Tac-Toe"}`, "", http.StatusCreated},
+		{"invalid body", `{"GameKey":`, "", http.StatusBadRequest},
+		{"large body", `{"GameKey":"` + strings.Repeat("a", 64) + `"}`, "", http.StatusRequestEntityTooLarge},
+		{"large idempotent body", `{"GameKey":"` + strings.Repeat("a", 64) + `"}`, "key", http.StatusRequestEntityTooLarge},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/admin/game/close", strings.NewReader(test.body))
+		if test.idempotencyKey != "" {
+			r.Header.Set(idempotencyKeyHeader, test.idempotencyKey)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("got status %d for a %s, want %d", w.Code, test.name, test.status)
+		}
+	}
+}
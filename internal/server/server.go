@@ -7,19 +7,39 @@ import (
 	"time"
 
 	bg "github.com/quibbble/go-boardgame"
+	"github.com/quibbble/go-quibbble/internal/cluster"
 	"github.com/quibbble/go-quibbble/internal/datastore"
+	"github.com/quibbble/go-quibbble/internal/metrics"
 	networking "github.com/quibbble/go-quibbble/internal/networking"
 	"github.com/quibbble/go-quibbble/pkg/http"
 	"github.com/quibbble/go-quibbble/pkg/logger"
+	"github.com/quibbble/go-quibbble/pkg/tracing"
 	"github.com/unrolled/render"
 )
 
+const (
+	// statsTimeout bounds how long metric collection waits on busy game hubs
+	statsTimeout = 5 * time.Second
+
+	// serverErrors is the number of errors that may be reported as the http, redirect and grpc servers each report at most one
+	serverErrors = 3
+
+	defaultShutdownTimeout = 10 * time.Second
+	defaultDrainIdle       = 30 * time.Second
+	drainPollInterval      = time.Second
+)
+
 type Server struct {
-	cfg      Config
-	server   *http.Server
-	network  *networking.GameNetwork
-	errCh    chan error
-	shutdown sync.Once
+	cfg             Config
+	server          *http.Server
+	handler         *Handler
+	grpc            *GRPCServer // nil unless the gRPC API is enabled
+	network         *networking.GameNetwork
+	cluster         *cluster.Cluster
+	shutdownTracing func(ctx context.Context) error
+	errCh           chan error    // buffered for every error so servers never block reporting one after shutdown started
+	done            chan struct{} // closed once shutdown has finished
+	shutdown        sync.Once
 }
 
 func NewServer(cfg Config) (*Server, error) {
@@ -29,7 +49,12 @@ func NewServer(cfg Config) (*Server, error) {
 		g = append(g, games[game])
 	}
 
-	gameStore, err := datastore.NewCockroachClient(&cfg.Datastore.Cockroach)
+	shutdownTracing, err := tracing.NewTracerProvider(cfg.Tracing, "quibbble")
+	if err != nil {
+		return nil, err
+	}
+
+	gameStore, err := datastore.NewGameStore(&cfg.Datastore)
 	if err != nil {
 		return nil, err
 	}
@@ -39,55 +64,138 @@ func NewServer(cfg Config) (*Server, error) {
 		Adapters:   a,
 		GameExpiry: cfg.Network.GameExpiry,
 		GameStore:  gameStore,
+		Limits:     cfg.Network.Limits,
+
+		Connection:      cfg.Network.Connection,
+		GameConnections: cfg.Network.GameConnections,
 	})
-	handler := NewHandler(render.New(), network, gameStore)
+	if err := metrics.RegisterNetworkStats(func() (map[string]int, map[string]int) {
+		ctx, cancel := context.WithTimeout(context.Background(), statsTimeout)
+		defer cancel()
+		stats, err := network.GetStats(ctx)
+		if err != nil {
+			logger.Log.Error().Caller().Err(err).Msg("failed to collect network stats")
+			return nil, nil
+		}
+		return stats.ActiveGames, stats.ActivePlayers
+	}); err != nil {
+		return nil, err
+	}
+
+	var c *cluster.Cluster
+	if cfg.Cluster.Enabled {
+		if c, err = cluster.NewCluster(&cfg.Cluster); err != nil {
+			return nil, err
+		}
+		c.OnChange(func() error { return handoff(network, c) })
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := c.Start(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	handler, err := NewHandler(render.New(), network, gameStore, http.CheckOrigin(cfg.Router), cfg.Create, c)
+	if err != nil {
+		return nil, err
+	}
 	r := NewRouter(cfg.Router)
-	r = AddRoutes(r, handler)
+	r = AddRoutes(r, handler, cfg.Admin, c)
+	var grpcServer *GRPCServer
+	if cfg.GRPC.Enabled {
+		grpcServer = NewGRPCServer(cfg.GRPC, network, gameStore, handler.ids)
+	}
 	return &Server{
-		cfg:     cfg,
-		server:  http.NewServer(cfg.Server, r),
-		network: network,
-		errCh:   make(chan error),
+		cfg:             cfg,
+		server:          http.NewServer(cfg.Server, r),
+		handler:         handler,
+		grpc:            grpcServer,
+		network:         network,
+		cluster:         c,
+		shutdownTracing: shutdownTracing,
+		errCh:           make(chan error, serverErrors),
+		done:            make(chan struct{}),
 	}, nil
 }
 
 func (s *Server) Start() {
 	go s.server.Start(s.errCh)
-	for err := range s.errCh {
-		if err != nil {
-			logger.Log.Error().Caller().Err(err).Msg("fatal error")
-			s.Shutdown(true)
-		}
+	if s.grpc != nil {
+		go s.grpc.Start(s.errCh)
+	}
+	// only the first error triggers shutdown as any others are caused by it
+	select {
+	case err := <-s.errCh:
+		logger.Log.Error().Caller().Err(err).Msg("fatal error")
+		s.Shutdown(true)
+	case <-s.done:
 	}
 }
 
 func (s *Server) Shutdown(errored bool) {
 	s.shutdown.Do(func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if !errored {
+			s.drain()
+		}
+		timeout := defaultShutdownTimeout
+		if s.cfg.Drain.Timeout > 0 {
+			timeout = s.cfg.Drain.Timeout
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
 		defer cancel()
 		logger.Log.Info().Msg("attempting graceful shutdown")
 		graceful := make(chan bool)
 		go func(graceful <-chan bool) {
-			for {
-				select {
-				case <-ctx.Done():
-					logger.Log.Panic().Msg("timeout so shutdown ungracefully")
-				case <-graceful:
-					return
-				}
+			select {
+			case <-ctx.Done():
+				logger.Log.Error().Msg("timeout so shutdown ungracefully")
+				s.close()
+				os.Exit(1)
+			case <-graceful:
 			}
 		}(graceful)
+		if !s.network.Draining() {
+			// games must not be created or loaded once stored below
+			if err := s.network.Drain(ctx, s.cfg.Drain.ReconnectAfter); err != nil {
+				logger.Log.Error().Caller().Err(err).Msg("failed to stop games from being created")
+			}
+		}
 		if err := s.network.Close(ctx); err != nil {
 			logger.Log.Error().Caller().Err(err).Msg("failed to close out games gracefully")
 		} else {
 			logger.Log.Info().Msg("closed all games gracefully")
 		}
+		if s.cluster != nil {
+			// leave once games are stored as other nodes take ownership and load them from the game store straight away
+			if err := s.cluster.Leave(ctx); err != nil {
+				logger.Log.Error().Caller().Err(err).Msg("failed to leave the cluster")
+			} else {
+				logger.Log.Info().Msg("left the cluster")
+			}
+		}
 		if err := s.server.Shutdown(ctx); err != nil {
 			logger.Log.Error().Caller().Err(err).Msg("failed to shutdown server gracefully")
 		} else {
 			logger.Log.Info().Msg("closed the server gracefully")
 		}
-		close(s.errCh)
+		if s.grpc != nil {
+			// watch streams have already ended as their games were closed above
+			if err := s.grpc.Shutdown(ctx); err != nil {
+				logger.Log.Error().Caller().Err(err).Msg("failed to shutdown grpc server gracefully")
+			} else {
+				logger.Log.Info().Msg("closed the grpc server gracefully")
+			}
+		}
+		if s.cluster != nil {
+			// closed once requests have finished as creates record idempotent responses in redis
+			if err := s.cluster.Close(); err != nil {
+				logger.Log.Error().Caller().Err(err).Msg("failed to close the cluster's redis client")
+			}
+		}
+		if err := s.shutdownTracing(ctx); err != nil {
+			logger.Log.Error().Caller().Err(err).Msg("failed to flush traces")
+		}
+		close(s.done)
 		close(graceful)
 		if errored {
 			logger.Log.Info().Msg("shutdown gracefully but error detected")
@@ -95,3 +203,59 @@ func (s *Server) Shutdown(errored bool) {
 		}
 	})
 }
+
+// close stops serving straight away closing any connections left open
+// websockets are hijacked from the http server so are closed as the process exits
+func (s *Server) close() {
+	if err := s.server.Close(); err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to close server")
+	}
+	if s.grpc != nil {
+		s.grpc.Stop()
+	}
+}
+
+// drain stops new games, tells players the server is restarting and waits up to the drain window for games to pause
+func (s *Server) drain() {
+	// readiness fails first so load balancers stop routing players here before they are told to reconnect
+	s.handler.unready.Store(true)
+	if delay := s.cfg.Drain.Delay; delay > 0 {
+		logger.Log.Info().Msgf("waiting %s for traffic to stop before draining", delay)
+		time.Sleep(delay)
+	}
+	window := s.cfg.Drain.Window
+	if window <= 0 {
+		return
+	}
+	idle := defaultDrainIdle
+	if s.cfg.Drain.IdleAfter > 0 {
+		idle = s.cfg.Drain.IdleAfter
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), window)
+	defer cancel()
+	logger.Log.Info().Msgf("draining for up to %s", window)
+	if err := s.network.Drain(ctx, s.cfg.Drain.ReconnectAfter); err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to start draining")
+		return
+	}
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		active, err := s.network.Active(ctx, idle)
+		if err != nil {
+			logger.Log.Error().Caller().Err(err).Msg("failed to check for active games")
+			return
+		}
+		if active == 0 {
+			logger.Log.Info().Msg("all games paused so finished draining")
+			return
+		}
+		logger.Log.Debug().Msgf("waiting on %d active games to pause", active)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			logger.Log.Info().Msgf("drain window elapsed with %d active games", active)
+			return
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	networking "github.com/quibbble/go-quibbble/internal/networking"
+	"github.com/quibbble/go-quibbble/pkg/logger"
+)
+
+// postTransport is a transport whose messages from the player are posted in separate requests
+type postTransport interface {
+	networking.Transport
+	Post(ctx context.Context, payload []byte) error
+}
+
+// sessions maps session IDs to the transports of players joined without a websocket
+type sessions struct {
+	mu         sync.Mutex
+	transports map[string]postTransport
+}
+
+func newSessions() *sessions {
+	return &sessions{transports: make(map[string]postTransport)}
+}
+
+func (s *sessions) add(id string, transport postTransport) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transports[id] = transport
+}
+
+func (s *sessions) get(id string) (postTransport, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	transport, ok := s.transports[id]
+	return transport, ok
+}
+
+func (s *sessions) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.transports, id)
+}
+
+// JoinGameEvents joins a game streaming messages as server-sent events for clients that cannot use websockets
+// actions are sent to PostGameAction with the session ID sent as the first event
+func (h *Handler) JoinGameEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	h.joinGameEvents(w, r, query.Get("GameKey"), query.Get("GameID"), query.Get("Protocol"))
+}
+
+func (h *Handler) joinGameEvents(w http.ResponseWriter, r *http.Request, gameKey, gameID, protocol string) {
+	sessionID, err := newSessionID(h.node)
+	if err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to generate session id")
+		writeJSONResponse(h.render, w, http.StatusInternalServerError, errorResponse{Message: "failed to start event stream"})
+		return
+	}
+	transport, err := networking.NewSSETransport(w, sessionID)
+	if err != nil {
+		logger.Log.Error().Caller().Err(err).Msg("failed to start event stream")
+		return
+	}
+	h.sessions.add(sessionID, transport)
+	defer h.sessions.remove(sessionID)
+	if err := h.network.JoinGame(r.Context(), networking.JoinGameOptions{
+		GameKey:    gameKey,
+		GameID:     gameID,
+		PlayerName: generateName(),
+		Transport:  transport,
+		RemoteAddr: r.RemoteAddr,
+		Protocol:   protocol,
+	}); err != nil {
+		payload, _ := json.Marshal(networking.OutboundMessage{
+			Type:    "Error",
+			Code:    networking.ErrorCode(err),
+			Payload: err.Error(),
+		})
+		_ = transport.Write(websocket.TextMessage, payload)
+		_ = transport.Close()
+		return
+	}
+	transport.Wait(r.Context())
+}
+
+// PostGameAction sends an action from a player joined through JoinGameEvents
+func (h *Handler) PostGameAction(w http.ResponseWriter, r *http.Request) {
+	if err := h.postGameAction(r, r.URL.Query().Get("SessionID")); err != nil {
+		status := http.StatusBadRequest
+		if err == errSessionNotFound {
+			status = http.StatusNotFound
+		} else if err == networking.ErrTransportClosed {
+			status = http.StatusGone
+		}
+		writeJSONResponse(h.render, w, status, errorResponse{Message: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Handler) postGameAction(r *http.Request, sessionID string) error {
+	transport, ok := h.sessions.get(sessionID)
+	if !ok {
+		return errSessionNotFound
+	}
+	payload, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	return transport.Post(r.Context(), payload)
+}
+
+// newSessionID returns a random session ID followed, when clustered, by the node the session is on
+// so requests posting actions are routed to that node without the client naming the game
+func newSessionID(node string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	sessionID := hex.EncodeToString(b)
+	if node != "" {
+		sessionID += "." + base64.RawURLEncoding.EncodeToString([]byte(node))
+	}
+	return sessionID, nil
+}
+
+// sessionNode returns the node a session is on or an empty string when the session ID does not name one
+func sessionNode(sessionID string) string {
+	_, encoded, ok := strings.Cut(sessionID, ".")
+	if !ok {
+		return ""
+	}
+	node, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ""
+	}
+	return string(node)
+}
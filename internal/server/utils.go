@@ -1,11 +1,17 @@
 package server
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"io"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/gorilla/websocket"
+	networking "github.com/quibbble/go-quibbble/internal/networking"
 	"github.com/unrolled/render"
 )
 
@@ -15,20 +21,77 @@ func writeJSONResponse(render *render.Render, w http.ResponseWriter, statusCode
 	}
 }
 
-func unmarshalJSONRequestBody(r *http.Request, output interface{}) error {
-	if r.Body == nil {
-		return fmt.Errorf("invalid request body")
+// writeWithETag responds with the body tagged by its hash or with not modified if the client already has it
+func writeWithETag(w http.ResponseWriter, r *http.Request, contentType string, body []byte) {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	for _, match := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		match = strings.TrimPrefix(strings.TrimSpace(match), "W/")
+		if match == etag || match == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
 	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+}
 
-	defer r.Body.Close()
+// closeWithError tells the player why they could not join before closing the websocket connection
+func closeWithError(conn *websocket.Conn, err error) {
+	_ = conn.SetWriteDeadline(time.Now().Add(time.Second))
+	_ = conn.WriteJSON(networking.OutboundMessage{
+		Type:    "Error",
+		Code:    networking.ErrorCode(err),
+		Payload: err.Error(),
+	})
+	_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, ""))
+	_ = conn.Close()
+}
 
+// readBody reads the request body failing with errBodyTooLarge if it is over the router's max body size
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, errInvalidBody
+	}
+	defer r.Body.Close()
 	body, err := io.ReadAll(r.Body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return nil, errBodyTooLarge
+	} else if err != nil {
+		return nil, errInvalidBody
+	}
+	return body, nil
+}
+
+func unmarshalJSONRequestBody(r *http.Request, output interface{}) error {
+	body, err := readBody(r)
 	if err != nil {
 		return err
 	}
 
 	if err := json.Unmarshal(body, &output); err != nil {
-		return err
+		return &validationError{message: err.Error()}
 	}
 	return nil
 }
+
+// writeHealthResponse responds with the status of each component failing if any component is unavailable
+func writeHealthResponse(render *render.Render, w http.ResponseWriter, components map[string]*ComponentHealth) {
+	response := HealthResponse{
+		Status:     healthOK,
+		Components: components,
+	}
+	for _, component := range components {
+		if component.Status == healthUnavailable {
+			response.Status = healthUnavailable
+		}
+	}
+	statusCode := http.StatusOK
+	if response.Status != healthOK {
+		statusCode = http.StatusServiceUnavailable
+	}
+	writeJSONResponse(render, w, statusCode, response)
+}
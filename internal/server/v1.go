@@ -0,0 +1,203 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/quibbble/go-quibbble/internal/datastore"
+	"github.com/quibbble/go-quibbble/pkg/logger"
+)
+
+// The /v1 routes address games as resources and respond with typed errors, the routes under /game and /games are deprecated aliases
+
+// V1CreateGame creates a game from BGN if set or else from the number of teams and game options
+func (h *Handler) V1CreateGame(w http.ResponseWriter, r *http.Request) {
+	var req GameRequest
+	if err := h.validator.decode(r, schemaGameRequest, &req); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	var err error
+	if req.BGN != "" {
+		err = h.loadGame(r.Context(), &LoadGameRequest{
+			NetworkingCreateGameOptions: req.NetworkingCreateGameOptions,
+			BGN:                         req.BGN,
+		})
+	} else {
+		err = h.createGame(r.Context(), &CreateGameRequest{
+			NetworkingCreateGameOptions: req.NetworkingCreateGameOptions,
+			Teams:                       req.Teams,
+			MoreOptions:                 req.MoreOptions,
+		})
+	}
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	w.Header().Set("Location", gamePath(req.GameKey, req.GameID))
+	writeJSONResponse(h.render, w, http.StatusCreated, GameResponse{
+		GameKey: req.GameKey,
+		GameID:  req.GameID,
+	})
+}
+
+// V1GetGame returns a summary of the game and its connected players
+func (h *Handler) V1GetGame(w http.ResponseWriter, r *http.Request) {
+	gameKey, gameID := gameParams(r)
+	summary, err := h.network.GetSummary(r.Context(), gameKey, gameID)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	writeJSONResponse(h.render, w, http.StatusOK, summary)
+}
+
+func (h *Handler) V1GetBGN(w http.ResponseWriter, r *http.Request) {
+	gameKey, gameID := gameParams(r)
+	game, err := h.network.GetBGN(r.Context(), gameKey, gameID)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	writeWithETag(w, r, "text/plain; charset=utf-8", []byte(game.String()))
+}
+
+func (h *Handler) V1GetSnapshot(w http.ResponseWriter, r *http.Request) {
+	gameKey, gameID := gameParams(r)
+	var snapshot interface{}
+	var err error
+	if team := r.URL.Query().Get("team"); team != "" {
+		snapshot, err = h.network.GetSnapshot(r.Context(), gameKey, gameID, team)
+	} else {
+		snapshot, err = h.network.GetSnapshot(r.Context(), gameKey, gameID)
+	}
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	body, err := json.Marshal(snapshot)
+	if err != nil {
+		logger.Log.Error().Caller().Err(err).Msgf("failed to marshal game snapshot '%s' for '%s'", gameID, gameKey)
+		h.writeError(w, err)
+		return
+	}
+	writeWithETag(w, r, "application/json; charset=UTF-8", body)
+}
+
+func (h *Handler) V1GetHistory(w http.ResponseWriter, r *http.Request) {
+	gameKey, gameID := gameParams(r)
+	if _, err := h.network.GetInfo(gameKey); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	if raw := r.URL.Query().Get("playIndex"); raw != "" {
+		playIndex, err := strconv.Atoi(raw)
+		if err != nil {
+			h.writeError(w, &validationError{message: "invalid playIndex"})
+			return
+		}
+		playthrough, err := h.gameStore.GetPlaythrough(r.Context(), gameKey, gameID, playIndex)
+		if err != nil {
+			h.writeError(w, err)
+			return
+		}
+		writeJSONResponse(h.render, w, http.StatusOK, newPlaythroughResponse(playthrough, true))
+		return
+	}
+	playthroughs, err := h.gameStore.GetPlaythroughs(r.Context(), gameKey, gameID)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	response := HistoryResponse{
+		Playthroughs: make([]*PlaythroughResponse, 0),
+	}
+	for _, playthrough := range playthroughs {
+		response.Playthroughs = append(response.Playthroughs, newPlaythroughResponse(playthrough, false))
+	}
+	writeJSONResponse(h.render, w, http.StatusOK, response)
+}
+
+func (h *Handler) V1JoinGame(w http.ResponseWriter, r *http.Request) {
+	gameKey, gameID := gameParams(r)
+	h.joinGame(w, r, gameKey, gameID, r.URL.Query().Get("protocol"), r.URL.Query().Get("encoding"))
+}
+
+func (h *Handler) V1JoinGameEvents(w http.ResponseWriter, r *http.Request) {
+	gameKey, gameID := gameParams(r)
+	h.joinGameEvents(w, r, gameKey, gameID, r.URL.Query().Get("protocol"))
+}
+
+func (h *Handler) V1PostGameAction(w http.ResponseWriter, r *http.Request) {
+	if err := h.postGameAction(r, chi.URLParam(r, "session")); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Handler) V1GetInfo(w http.ResponseWriter, r *http.Request) {
+	gameKey, _ := gameParams(r)
+	info, err := h.network.GetInfo(gameKey)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	writeJSONResponse(h.render, w, http.StatusOK, info)
+}
+
+func (h *Handler) V1GetActiveGameIDs(w http.ResponseWriter, r *http.Request) {
+	activeGameIDs, err := h.network.GetActiveGameIDs(r.Context())
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	writeJSONResponse(h.render, w, http.StatusOK, activeGameIDs)
+}
+
+func (h *Handler) V1GetStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.stats(r.Context())
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	writeJSONResponse(h.render, w, http.StatusOK, stats)
+}
+
+func (h *Handler) V1SearchGames(w http.ResponseWriter, r *http.Request) {
+	query, err := h.gameQuery(r.URL.Query(), lowerFirst)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	response, err := h.searchGames(r.Context(), query)
+	if err != nil {
+		if err != datastore.ErrGameStoreCursor {
+			logger.Log.Error().Caller().Err(err).Msg("failed to search games")
+		}
+		h.writeError(w, err)
+		return
+	}
+	writeJSONResponse(h.render, w, http.StatusOK, response)
+}
+
+// gameParams returns the game key and game ID from the path
+func gameParams(r *http.Request) (string, string) {
+	gameKey, _ := url.PathUnescape(chi.URLParam(r, "key"))
+	gameID, _ := url.PathUnescape(chi.URLParam(r, "id"))
+	return gameKey, gameID
+}
+
+// gamePath is the path of a game resource
+func gamePath(gameKey, gameID string) string {
+	return "/v1/games/" + url.PathEscape(gameKey) + "/" + url.PathEscape(gameID)
+}
+
+// lowerFirst names query parameters in camel case
+func lowerFirst(name string) string {
+	return strings.ToLower(name[:1]) + name[1:]
+}
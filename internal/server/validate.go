@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// specURL identifies the OpenAPI specification when resolving schema references
+const specURL = "openapi.json"
+
+const (
+	schemaCreateGameRequest = "CreateGameRequest"
+	schemaLoadGameRequest   = "LoadGameRequest"
+	schemaGameRequest       = "GameRequest"
+)
+
+// validatedSchemas are the request bodies checked against the OpenAPI specification before being decoded
+var validatedSchemas = []string{schemaCreateGameRequest, schemaLoadGameRequest, schemaGameRequest}
+
+// requestValidator checks request bodies against their schemas in the OpenAPI specification
+type requestValidator struct {
+	schemas map[string]*jsonschema.Schema
+	printer *message.Printer
+}
+
+func newRequestValidator(spec []byte) (*requestValidator, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(spec))
+	if err != nil {
+		return nil, err
+	}
+	compiler := jsonschema.NewCompiler()
+	compiler.DefaultDraft(jsonschema.Draft2020)
+	if err := compiler.AddResource(specURL, doc); err != nil {
+		return nil, err
+	}
+	schemas := make(map[string]*jsonschema.Schema)
+	for _, name := range validatedSchemas {
+		schema, err := compiler.Compile(fmt.Sprintf("%s#/components/schemas/%s", specURL, name))
+		if err != nil {
+			return nil, err
+		}
+		schemas[name] = schema
+	}
+	return &requestValidator{
+		schemas: schemas,
+		printer: message.NewPrinter(language.English),
+	}, nil
+}
+
+// FieldError describes why a field of a request body is invalid
+type FieldError struct {
+	// Field is the path to the field with nested fields separated by dots
+	Field   string
+	Message string
+}
+
+// validationError is returned when a request body cannot be parsed or does not match its schema
+type validationError struct {
+	message string
+	fields  []*FieldError
+}
+
+func (e *validationError) Error() string {
+	return e.message
+}
+
+// decode validates the request body against the named schema before unmarshalling it into output
+func (v *requestValidator) decode(r *http.Request, schema string, output interface{}) error {
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(body))
+	if err != nil {
+		return &validationError{message: fmt.Sprintf("invalid json: %s", err)}
+	}
+	if err := v.schemas[schema].Validate(doc); err != nil {
+		verr, ok := err.(*jsonschema.ValidationError)
+		if !ok {
+			return err
+		}
+		return &validationError{message: "invalid request body", fields: v.fieldErrors(verr, make(map[string]bool))}
+	}
+	if err := json.Unmarshal(body, output); err != nil {
+		return &validationError{message: err.Error()}
+	}
+	return nil
+}
+
+// fieldErrors flattens the causes of a validation error to the individual fields that failed
+func (v *requestValidator) fieldErrors(err *jsonschema.ValidationError, seen map[string]bool) []*FieldError {
+	fields := make([]*FieldError, 0)
+	if len(err.Causes) > 0 {
+		for _, cause := range err.Causes {
+			fields = append(fields, v.fieldErrors(cause, seen)...)
+		}
+		return fields
+	}
+	add := func(path []string, msg string) {
+		field := strings.Join(path, ".")
+		if seen[field+msg] {
+			return
+		}
+		seen[field+msg] = true
+		fields = append(fields, &FieldError{Field: field, Message: msg})
+	}
+	if required, ok := err.ErrorKind.(*kind.Required); ok {
+		for _, missing := range required.Missing {
+			add(append(append([]string{}, err.InstanceLocation...), missing), "required")
+		}
+		return fields
+	}
+	add(err.InstanceLocation, err.ErrorKind.LocalizedString(v.printer))
+	return fields
+}
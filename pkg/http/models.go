@@ -2,13 +2,27 @@ package http
 
 type ServerConfig struct {
 	Port string
+	TLS  TLSConfig
+}
+
+type TLSConfig struct {
+	Enabled bool
+
+	// CertFile and KeyFile are reloaded whenever either changes on disk
+	CertFile string
+	KeyFile  string
+
+	// RedirectPort is the port to listen on for http requests to redirect to https - no redirect if empty
+	RedirectPort string
 }
 
 type RouterConfig struct {
 	TimeoutSec         int
 	RequestPerSecLimit int
-	DisableCors        bool
-	AllowedOrigins     []string
-	AllowedMethods     []string
-	AllowedHeaders     []string
+	// MaxBodySize is the max number of bytes read from a request body - defaults to 1MiB
+	MaxBodySize    int64
+	DisableCors    bool
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
 }
@@ -0,0 +1,47 @@
+package http
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CheckOrigin returns whether a websocket upgrade request comes from one of the router's allowed origins
+// origins may use * as the port to allow any port i.e. http://localhost:*
+// requests without an origin come from non browser clients so are always allowed
+func CheckOrigin(cfg RouterConfig) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if cfg.DisableCors || origin == "" {
+			return true
+		}
+		for _, allowed := range cfg.AllowedOrigins {
+			if matchOrigin(allowed, origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func matchOrigin(pattern, origin string) bool {
+	if pattern == "*" {
+		return true
+	}
+	anyPort := strings.HasSuffix(pattern, ":*")
+	if anyPort {
+		pattern = strings.TrimSuffix(pattern, ":*")
+	}
+	p, err := url.Parse(pattern)
+	if err != nil {
+		return false
+	}
+	o, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if !strings.EqualFold(p.Scheme, o.Scheme) || !strings.EqualFold(p.Hostname(), o.Hostname()) {
+		return false
+	}
+	return anyPort || p.Port() == o.Port()
+}
@@ -0,0 +1,40 @@
+package http
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	allowed := RouterConfig{AllowedOrigins: []string{"https://quibbble.com", "http://localhost:*"}}
+	for _, test := range []struct {
+		name   string
+		cfg    RouterConfig
+		origin string
+		want   bool
+	}{
+		{"empty origin", allowed, "", true},
+		{"exact origin", allowed, "https://quibbble.com", true},
+		{"different case", allowed, "HTTPS://Quibbble.com", true},
+		{"different scheme", allowed, "http://quibbble.com", false},
+		{"different port", allowed, "https://quibbble.com:8443", false},
+		{"subdomain", allowed, "https://evil.quibbble.com", false},
+		{"suffix of host", allowed, "https://quibbble.com.evil.com", false},
+		{"wildcard port", allowed, "http://localhost:3000", true},
+		{"wildcard port without port", allowed, "http://localhost", true},
+		{"wildcard port different host", allowed, "http://localhost.evil.com:3000", false},
+		{"wildcard port different scheme", allowed, "https://localhost:3000", false},
+		{"invalid origin", allowed, "://localhost", false},
+		{"any origin", RouterConfig{AllowedOrigins: []string{"*"}}, "https://anywhere.com", true},
+		{"no allowed origins", RouterConfig{}, "https://quibbble.com", false},
+		{"cors disabled", RouterConfig{DisableCors: true}, "https://anywhere.com", true},
+	} {
+		r := httptest.NewRequest("GET", "/game/connect", nil)
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+		if got := CheckOrigin(test.cfg)(r); got != test.want {
+			t.Errorf("got %t checking %s '%s', want %t", got, test.name, test.origin, test.want)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package http
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"net/http"
 
@@ -9,22 +11,51 @@ import (
 
 type Server struct {
 	*http.Server
-	port string
+	port     string
+	tls      TLSConfig
+	redirect *http.Server // redirects http to https if enabled
+	reloader *certReloader
 }
 
 func NewServer(cfg ServerConfig, router http.Handler) *Server {
-	return &Server{
-		&http.Server{
+	s := &Server{
+		Server: &http.Server{
 			Addr:    fmt.Sprintf(":%s", cfg.Port),
 			Handler: router,
 		},
-		cfg.Port,
+		port: cfg.Port,
+		tls:  cfg.TLS,
 	}
+	if cfg.TLS.Enabled && cfg.TLS.RedirectPort != "" {
+		s.redirect = &http.Server{
+			Addr:    fmt.Sprintf(":%s", cfg.TLS.RedirectPort),
+			Handler: redirectToHTTPS(cfg.Port),
+		}
+	}
+	return s
 }
 
 func (s *Server) Start(errCh chan<- error) {
-	logger.Log.Info().Msg(fmt.Sprintf("server started on 0.0.0.0:%s", s.port))
-	err := s.ListenAndServe()
+	var err error
+	if s.tls.Enabled {
+		if s.reloader, err = newCertReloader(s.tls.CertFile, s.tls.KeyFile); err != nil {
+			logger.Log.Error().Caller().Err(err).Msg("failed to load tls certificate")
+			errCh <- err
+			return
+		}
+		s.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: s.reloader.GetCertificate,
+		}
+		if s.redirect != nil {
+			go s.startRedirect(errCh)
+		}
+		logger.Log.Info().Msg(fmt.Sprintf("server started with tls on 0.0.0.0:%s", s.port))
+		err = s.ListenAndServeTLS("", "")
+	} else {
+		logger.Log.Info().Msg(fmt.Sprintf("server started on 0.0.0.0:%s", s.port))
+		err = s.ListenAndServe()
+	}
 	if err != http.ErrServerClosed {
 		logger.Log.Error().Caller().Err(err).Msg("server stopped unexpectedly")
 		errCh <- err
@@ -32,3 +63,35 @@ func (s *Server) Start(errCh chan<- error) {
 		logger.Log.Info().Msg("server stopped")
 	}
 }
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.redirect != nil {
+		if err := s.redirect.Shutdown(ctx); err != nil {
+			logger.Log.Error().Caller().Err(err).Msg("failed to shutdown redirect server gracefully")
+		}
+	}
+	if s.reloader != nil {
+		if err := s.reloader.Close(); err != nil {
+			logger.Log.Error().Caller().Err(err).Msg("failed to stop watching tls certificate")
+		}
+	}
+	return s.Server.Shutdown(ctx)
+}
+
+func (s *Server) startRedirect(errCh chan<- error) {
+	logger.Log.Info().Msg(fmt.Sprintf("redirecting http to https on 0.0.0.0:%s", s.tls.RedirectPort))
+	if err := s.redirect.ListenAndServe(); err != http.ErrServerClosed {
+		logger.Log.Error().Caller().Err(err).Msg("redirect server stopped unexpectedly")
+		errCh <- err
+	}
+}
+
+// Close immediately closes the listeners and connections without waiting for requests to finish
+func (s *Server) Close() error {
+	if s.redirect != nil {
+		if err := s.redirect.Close(); err != nil {
+			logger.Log.Error().Caller().Err(err).Msg("failed to close redirect server")
+		}
+	}
+	return s.Server.Close()
+}
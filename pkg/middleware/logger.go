@@ -2,22 +2,25 @@ package middleware
 
 import (
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/justinas/alice"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/hlog"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func RequestLogger(log zerolog.Logger) func(h http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if r.URL.Path == "/health" {
+			if strings.HasPrefix(r.URL.Path, "/health") || r.URL.Path == "/metrics" {
 				h.ServeHTTP(w, r)
 				return
 			}
 			c := alice.New()
 			c = c.Append(hlog.NewHandler(log))
+			c = c.Append(traceHandler)
 			c = c.Append(hlog.AccessHandler(func(r *http.Request, status, size int, duration time.Duration) {
 				hlog.FromRequest(r).Info().
 					Str("method", r.Method).
@@ -31,3 +34,17 @@ func RequestLogger(log zerolog.Logger) func(h http.Handler) http.Handler {
 		})
 	}
 }
+
+// traceHandler adds the ids of the request's span, if any, to the request's logger
+func traceHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		spanCtx := trace.SpanContextFromContext(r.Context())
+		if spanCtx.IsValid() {
+			log := zerolog.Ctx(r.Context())
+			log.UpdateContext(func(c zerolog.Context) zerolog.Context {
+				return c.Str("trace_id", spanCtx.TraceID().String()).Str("span_id", spanCtx.SpanID().String())
+			})
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,15 @@
+package tracing
+
+type Config struct {
+	Enabled bool
+
+	// Exporter is either "otlp" to send spans to an OTLP/HTTP collector or "stdout" to print them
+	Exporter string
+
+	// Endpoint is the host:port of the OTLP collector
+	Endpoint string
+	Insecure bool
+
+	// SampleRatio is the fraction of new traces sampled between 0 and 1
+	SampleRatio float64
+}